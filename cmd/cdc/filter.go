@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-cdc/pkg/config"
+	"io"
+	"strings"
+)
+
+const filterUsage = "usage: cdc filter test schema.table [schema.table ...]"
+
+// runFilter cdc filter test schema.table：按配置文件中每个数据源的过滤规则输出判定结果和命中的规则，不连接数据库
+func runFilter(w io.Writer, cfg *config.CdcConfig, args []string) error {
+	if len(args) < 2 || args[0] != "test" {
+		return errors.New(filterUsage)
+	}
+	for _, name := range args[1:] {
+		schema, table, ok := strings.Cut(name, ".")
+		if !ok || schema == "" {
+			return fmt.Errorf("invalid table %q, %s", name, filterUsage)
+		}
+		for _, ds := range cfg.DataSourceConfigs {
+			rule, err := ds.Filter()
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(w, "[%s] %s: %s\n", ds.ID, name, rule.Explain(schema, table))
+		}
+	}
+	return nil
+}
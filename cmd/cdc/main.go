@@ -1,10 +1,12 @@
 package main
 
 import (
+	"fmt"
 	"go-cdc/internal/cannal"
 	"go-cdc/internal/db"
-	_ "go-cdc/internal/log"
+	"go-cdc/internal/log"
 	_ "go-cdc/internal/model"
+	"go-cdc/internal/sink"
 	"go-cdc/internal/syncdb"
 	"go-cdc/pkg/config"
 	"os"
@@ -13,21 +15,61 @@ import (
 )
 
 func main() {
-	_, err := config.LoadConfig("config.toml")
+	cfg, err := config.LoadConfig("config.toml")
 	if err != nil {
 		panic(err)
 	}
+	for _, w := range cfg.Warnings() {
+		log.Log.Warn(w)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "filter" {
+		if err := runFilter(os.Stdout, cfg, os.Args[2:]); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "signal" {
+		if err := runSignal(os.Stdout, cfg, os.Args[2:]); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	_ = db.InitCDCDataSource()
 	holder := syncdb.InitOrGetDataSource()
 
-	_ = cannal.NewFullAmountService(syncdb.DataSourceMap).Run()
-	service, err := cannal.NewMySQLIncrementalService(holder["开发环境"])
-	if err != nil {
-		panic(err)
+	// 加载配置时已校验最多只配置了一个下游，都没有配置时输出到控制台
+	var consumer cannal.IncrementalConsumer = cannal.ConsoleIncrementalConsumer{}
+	switch {
+	case cfg.Kafka != nil && cfg.Kafka.Brokers != "":
+		kafka, err := sink.NewKafkaSink(cfg.Kafka)
+		if err != nil {
+			panic(err)
+		}
+		defer kafka.Close()
+		consumer = kafka
+	case cfg.MysqlSink != nil && cfg.MysqlSink.Host != "":
+		mysqlSink, err := sink.NewMysqlSink(cfg.MysqlSink)
+		if err != nil {
+			panic(err)
+		}
+		defer mysqlSink.Close()
+		consumer = mysqlSink
+	case cfg.PostgresSink != nil && cfg.PostgresSink.Host != "":
+		pgSink, err := sink.NewPostgresSink(cfg.PostgresSink)
+		if err != nil {
+			panic(err)
+		}
+		defer pgSink.Close()
+		consumer = pgSink
 	}
-	service.Run()
+
+	pipeline := cannal.NewPipeline(holder, consumer)
+	pipeline.Run()
+	log.Log.Info("pipeline started")
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	service.Stop()
+	pipeline.Stop()
 }
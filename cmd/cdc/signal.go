@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-cdc/internal/cannal"
+	"go-cdc/internal/db"
+	"go-cdc/pkg/config"
+	"io"
+	"strings"
+)
+
+const signalUsage = "usage: cdc signal datasource execute-snapshot|pause-snapshot|resume-snapshot|stop-snapshot [schema.table ...]"
+
+// runSignal cdc signal datasource type schema.table：向数据源的信号表写入命令，由运行中的增量服务读到后执行。
+// pause、resume、stop 不指定表时作用于所有增量快照
+func runSignal(w io.Writer, cfg *config.CdcConfig, args []string) error {
+	if len(args) < 2 {
+		return errors.New(signalUsage)
+	}
+	id, typ, collections := args[0], args[1], args[2:]
+	var ds *config.DataSourceConfig
+	for _, c := range cfg.DataSourceConfigs {
+		if c.ID == id {
+			ds = c
+			break
+		}
+	}
+	if ds == nil {
+		return fmt.Errorf("datasource %s not found", id)
+	}
+	if !ds.IsMysqlCompatible() {
+		return fmt.Errorf("datasource %s does not support signal table", id)
+	}
+	for _, name := range collections {
+		if schema, _, ok := strings.Cut(name, "."); !ok || schema == "" {
+			return fmt.Errorf("invalid table %q, %s", name, signalUsage)
+		}
+	}
+	source, err := sql.Open("mysql", db.GetMysqlDsn(ds))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = source.Close()
+	}()
+	if err := cannal.SendSignal(source, ds, typ, collections...); err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(w, "[%s] %s %s sent\n", id, typ, strings.Join(collections, ","))
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"go-cdc/pkg/config"
+	"strings"
+	"testing"
+)
+
+// TestRunSignalArgs 参数不合法时不连接源库
+func TestRunSignalArgs(t *testing.T) {
+	cfg := &config.CdcConfig{DataSourceConfigs: []*config.DataSourceConfig{
+		{ID: "m1", Type: "mysql", Database: "db", SignalTable: "signal"},
+		{ID: "m2", Type: "mariadb", Database: "db"},
+		{ID: "p1", Type: "postgres", Database: "db", SignalTable: "signal"},
+	}}
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"no args", nil, "usage"},
+		{"no type", []string{"m1"}, "usage"},
+		{"unknown datasource", []string{"x", "execute-snapshot", "db.a"}, "datasource x not found"},
+		{"not mysql", []string{"p1", "execute-snapshot", "db.a"}, "does not support signal table"},
+		{"table without schema", []string{"m1", "execute-snapshot", "a"}, `invalid table "a"`},
+		{"empty schema", []string{"m1", "stop-snapshot", ".a"}, `invalid table ".a"`},
+		{"unknown type", []string{"m1", "snapshot", "db.a"}, "unknown signal type"},
+		{"execute without tables", []string{"m1", "execute-snapshot"}, "at least one"},
+		{"no signal table", []string{"m2", "pause-snapshot"}, "signal_table of m2"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		err := runSignal(&out, cfg, c.args)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+		if out.Len() != 0 {
+			t.Errorf("%s: unexpected output %q", c.name, out.String())
+		}
+	}
+}
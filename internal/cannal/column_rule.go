@@ -0,0 +1,572 @@
+package cannal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+	"github.com/pingcap/tidb/pkg/parser/types"
+)
+
+const (
+	columnMask     = "mask"
+	columnHash     = "hash"
+	columnTruncate = "truncate"
+)
+
+// ColumnRule 表的列裁剪与脱敏规则，作用于全量分块行、binlog 前后镜像和下发的 DDL：
+// 不同步的列从行和 DDL 中删除；hash 列在 DDL 中改为 char(64)，mask 的非字符串列改为 varchar(255)；
+// mask 和 truncate 后的值不再唯一，这些列上的主键和唯一索引在下发的 DDL 中降为普通索引
+type ColumnRule struct {
+	include  map[string]bool // 小写列名
+	exclude  map[string]bool
+	actions  map[string]string // 小写列名 -> mask/hash/truncate
+	truncate map[string]int
+	salt     string
+}
+
+// NewColumnRule 校验并构建列规则，一列只能配置一种脱敏方式
+func NewColumnRule(cc *config.ColumnConfig, salt string) (*ColumnRule, error) {
+	r := &ColumnRule{
+		include:  columnSet(cc.Include),
+		exclude:  columnSet(cc.Exclude),
+		actions:  make(map[string]string),
+		truncate: make(map[string]int),
+		salt:     salt,
+	}
+	add := func(col, action string) error {
+		col = strings.ToLower(strings.TrimSpace(col))
+		if col == "" {
+			return nil
+		}
+		if prev, ok := r.actions[col]; ok && prev != action {
+			return fmt.Errorf("column %s is configured with both %s and %s", col, prev, action)
+		}
+		r.actions[col] = action
+		return nil
+	}
+	for col := range columnSet(cc.Mask) {
+		if err := add(col, columnMask); err != nil {
+			return nil, err
+		}
+	}
+	for col := range columnSet(cc.Hash) {
+		if strings.TrimSpace(salt) == "" {
+			return nil, fmt.Errorf("hash column %s requires hash_salt", col)
+		}
+		if err := add(col, columnHash); err != nil {
+			return nil, err
+		}
+	}
+	for col, n := range cc.Truncate {
+		if n <= 0 {
+			return nil, fmt.Errorf("truncate length of column %s must be positive", col)
+		}
+		if err := add(col, columnTruncate); err != nil {
+			return nil, err
+		}
+		r.truncate[strings.ToLower(strings.TrimSpace(col))] = n
+	}
+	return r, nil
+}
+
+// NewColumnRules 解析数据源配置的所有列规则，返回 schema.table -> 列规则
+func NewColumnRules(cfg *config.DataSourceConfig) (map[string]*ColumnRule, error) {
+	rules := make(map[string]*ColumnRule, len(cfg.ColumnRules))
+	for name, cc := range cfg.ColumnRules {
+		if cc == nil {
+			continue
+		}
+		r, err := NewColumnRule(cc, cfg.HashSalt)
+		if err != nil {
+			return nil, fmt.Errorf("column_rules %s of %s: %w", name, cfg.ID, err)
+		}
+		rules[name] = r
+	}
+	return rules, nil
+}
+
+// columnRuleOf 表的列规则，未配置时返回 nil
+func columnRuleOf(cfg *config.DataSourceConfig, schema, table string) (*ColumnRule, error) {
+	cc := cfg.ColumnRule(schema, table)
+	if cc == nil {
+		return nil, nil
+	}
+	r, err := NewColumnRule(cc, cfg.HashSalt)
+	if err != nil {
+		return nil, fmt.Errorf("column_rules %s.%s: %w", schema, table, err)
+	}
+	return r, nil
+}
+
+func columnSet(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, col := range strings.Split(s, ",") {
+		if col = strings.ToLower(strings.TrimSpace(col)); col != "" {
+			set[col] = true
+		}
+	}
+	return set
+}
+
+// Keep 列是否同步
+func (r *ColumnRule) Keep(col string) bool {
+	if r == nil {
+		return true
+	}
+	col = strings.ToLower(col)
+	if r.exclude[col] {
+		return false
+	}
+	return len(r.include) == 0 || r.include[col]
+}
+
+// lossy 脱敏后的值不能再唯一标识行
+func (r *ColumnRule) lossy(col string) bool {
+	action := r.actions[strings.ToLower(col)]
+	return action == columnMask || action == columnTruncate
+}
+
+// ApplyRow 原地删除不同步的列并脱敏
+func (r *ColumnRule) ApplyRow(row map[string]interface{}) {
+	if r == nil || row == nil {
+		return
+	}
+	for col, v := range row {
+		if !r.Keep(col) {
+			delete(row, col)
+			continue
+		}
+		if action, ok := r.actions[strings.ToLower(col)]; ok {
+			row[col] = r.transform(col, action, v)
+		}
+	}
+}
+
+// ApplyRows 处理全量读取的一批行
+func (r *ColumnRule) ApplyRows(rows []map[string]interface{}) {
+	if r == nil {
+		return
+	}
+	for _, row := range rows {
+		r.ApplyRow(row)
+	}
+}
+
+// Apply 处理同一张表的行事件和 DDL 事件，DDL 裁剪后没有剩余变更时丢弃
+func (r *ColumnRule) Apply(events []*model.Event) ([]*model.Event, error) {
+	if r == nil {
+		return events, nil
+	}
+	kept := events[:0]
+	for _, ev := range events {
+		if ev.DDL != nil {
+			ddl, err := r.ApplyDDL(ev.DDL)
+			if err != nil {
+				return nil, err
+			}
+			if ddl == nil {
+				continue
+			}
+			ev.DDL = ddl
+		}
+		r.ApplyRow(ev.Data)
+		r.ApplyRow(ev.Before)
+		ev.Keys = r.keys(ev.Keys)
+		kept = append(kept, ev)
+	}
+	return kept, nil
+}
+
+// keys 标识列被删除或脱敏后不再唯一时返回空，下游只能按完整的前镜像定位行
+func (r *ColumnRule) keys(keys []string) []string {
+	for _, key := range keys {
+		if !r.Keep(key) || r.lossy(key) {
+			return nil
+		}
+	}
+	return keys
+}
+
+func (r *ColumnRule) transform(col, action string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case []byte:
+		s = string(val)
+	default:
+		s = fmt.Sprint(val)
+	}
+	switch action {
+	case columnHash:
+		sum := sha256.Sum256([]byte(r.salt + s))
+		return hex.EncodeToString(sum[:])
+	case columnMask:
+		return maskString(s)
+	case columnTruncate:
+		runes := []rune(s)
+		if n := r.truncate[strings.ToLower(col)]; len(runes) > n {
+			return string(runes[:n])
+		}
+		return s
+	}
+	return v
+}
+
+// maskString 长度超过 7 时保留前 3 位和后 4 位（如手机号、身份证号），否则全部替换
+func maskString(s string) string {
+	runes := []rune(s)
+	head, tail := 3, 4
+	if len(runes) <= head+tail {
+		head, tail = 0, 0
+	}
+	for i := head; i < len(runes)-tail; i++ {
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// maskedType 脱敏后的列类型，不需要修改时返回空
+func (r *ColumnRule) maskedType(col, typ string) string {
+	switch r.actions[strings.ToLower(col)] {
+	case columnHash:
+		return "char(64)"
+	case columnMask:
+		if !isStringType(typ) {
+			return "varchar(255)"
+		}
+	}
+	return ""
+}
+
+func isStringType(typ string) bool {
+	name := strings.ToLower(strings.TrimSpace(typ))
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	switch name {
+	case "char", "varchar", "binary", "varbinary", "tinytext", "text", "mediumtext", "longtext",
+		"tinyblob", "blob", "mediumblob", "longblob":
+		return true
+	}
+	return false
+}
+
+// ApplyDDL 从结构化 DDL 和原始语句中删除不同步的列并改写脱敏列的类型，返回改写后的副本，
+// 原事件的列定义与结构历史共用不能修改；裁剪后没有剩余变更时返回 nil
+func (r *ColumnRule) ApplyDDL(ddl *model.DDLEvent) (*model.DDLEvent, error) {
+	if r == nil || (ddl.Kind != model.DDLCreateTable && ddl.Kind != model.DDLAlterTable && ddl.Kind != model.DDLCreateIndex) {
+		return ddl, nil
+	}
+	query, ok, err := r.RewriteDDL(ddl.Query, ddl.Schema, ddl.Table)
+	if err != nil || !ok {
+		return nil, err
+	}
+	out := *ddl
+	out.Query = query
+	out.Columns = r.columnDefs(ddl.Columns)
+	out.AddedColumns = r.columnDefs(ddl.AddedColumns)
+	out.ModifiedColumns = r.columnDefs(ddl.ModifiedColumns)
+	out.DroppedColumns = nil
+	for _, col := range ddl.DroppedColumns {
+		if r.Keep(col) {
+			out.DroppedColumns = append(out.DroppedColumns, col)
+		}
+	}
+	out.RenamedColumns = nil
+	for _, rn := range ddl.RenamedColumns {
+		if r.Keep(rn.From) && r.Keep(rn.To) {
+			out.RenamedColumns = append(out.RenamedColumns, rn)
+		}
+	}
+	for _, col := range ddl.PrimaryKey {
+		if !r.Keep(col) || r.lossy(col) {
+			out.PrimaryKey = nil
+			break
+		}
+	}
+	return &out, nil
+}
+
+func (r *ColumnRule) columnDefs(defs []*model.ColumnDef) []*model.ColumnDef {
+	var kept []*model.ColumnDef
+	for _, def := range defs {
+		if !r.Keep(def.Name) || (def.OldName != "" && !r.Keep(def.OldName)) {
+			continue
+		}
+		c := *def
+		if typ := r.maskedType(c.Name, c.Type); typ != "" {
+			c.Type = typ
+		}
+		if c.After != "" && !r.Keep(c.After) {
+			c.After = ""
+		}
+		kept = append(kept, &c)
+	}
+	return kept
+}
+
+// RewriteDDL 改写语句中作用于 schema.table 的 CREATE TABLE、ALTER TABLE、CREATE INDEX，
+// 未受规则影响的语句原样返回；第二个返回值为 false 表示裁剪后语句已没有内容
+func (r *ColumnRule) RewriteDDL(query, schema, table string) (string, bool, error) {
+	if r == nil {
+		return query, true, nil
+	}
+	stmts, _, err := parser.New().Parse(query, "", "")
+	if err != nil {
+		return "", false, fmt.Errorf("parse ddl of %s.%s err: %w", schema, table, err)
+	}
+	match := func(t *ast.TableName) bool {
+		return strings.EqualFold(t.Name.O, table) && (t.Schema.O == "" || strings.EqualFold(t.Schema.O, schema))
+	}
+	changed := false
+	parts := make([]string, 0, len(stmts))
+	for _, stmt := range stmts {
+		keep, dirty := true, false
+		switch t := stmt.(type) {
+		case *ast.CreateTableStmt:
+			if match(t.Table) {
+				dirty = r.rewriteCreateTable(t)
+			}
+		case *ast.AlterTableStmt:
+			if match(t.Table) {
+				dirty = r.rewriteAlterTable(t)
+				keep = len(t.Specs) > 0
+			}
+		case *ast.CreateIndexStmt:
+			if match(t.Table) {
+				keep = r.keepIndex(t.IndexPartSpecifications)
+				if keep && t.KeyType == ast.IndexKeyTypeUnique && r.lossyIndex(t.IndexPartSpecifications) {
+					t.KeyType, dirty = ast.IndexKeyTypeNone, true
+				}
+			}
+		}
+		if !keep {
+			changed = true
+			continue
+		}
+		if !dirty {
+			parts = append(parts, stmt.OriginalText())
+			continue
+		}
+		changed = true
+		var sb strings.Builder
+		if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+			return "", false, err
+		}
+		parts = append(parts, sb.String())
+	}
+	if len(parts) == 0 {
+		return "", false, nil
+	}
+	if !changed {
+		return query, true, nil
+	}
+	return strings.Join(parts, ";\n"), true, nil
+}
+
+func (r *ColumnRule) rewriteCreateTable(t *ast.CreateTableStmt) bool {
+	dirty := false
+	cols := t.Cols[:0]
+	for _, col := range t.Cols {
+		if !r.Keep(col.Name.Name.O) {
+			dirty = true
+			continue
+		}
+		if r.rewriteColumn(col) {
+			dirty = true
+		}
+		cols = append(cols, col)
+	}
+	t.Cols = cols
+	constraints := t.Constraints[:0]
+	for _, c := range t.Constraints {
+		keep, d := r.rewriteConstraint(c)
+		dirty = dirty || d || !keep
+		if keep {
+			constraints = append(constraints, c)
+		}
+	}
+	t.Constraints = constraints
+	return dirty
+}
+
+func (r *ColumnRule) rewriteAlterTable(t *ast.AlterTableStmt) bool {
+	dirty := false
+	specs := t.Specs[:0]
+	for _, spec := range t.Specs {
+		keep := true
+		switch spec.Tp {
+		case ast.AlterTableAddColumns:
+			cols := spec.NewColumns[:0]
+			for _, col := range spec.NewColumns {
+				if !r.Keep(col.Name.Name.O) {
+					dirty = true
+					continue
+				}
+				if r.rewriteColumn(col) {
+					dirty = true
+				}
+				cols = append(cols, col)
+			}
+			spec.NewColumns = cols
+			keep = len(cols) > 0
+			if keep && r.dropPosition(spec.Position) {
+				dirty = true
+			}
+		case ast.AlterTableDropColumn:
+			keep = r.Keep(spec.OldColumnName.Name.O)
+		case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn, ast.AlterTableAlterColumn:
+			for _, col := range spec.NewColumns {
+				if !r.Keep(col.Name.Name.O) {
+					keep = false
+				} else if r.rewriteColumn(col) {
+					dirty = true
+				}
+			}
+			if spec.OldColumnName != nil && !r.Keep(spec.OldColumnName.Name.O) {
+				keep = false
+			}
+			if keep && r.dropPosition(spec.Position) {
+				dirty = true
+			}
+		case ast.AlterTableRenameColumn:
+			keep = r.Keep(spec.OldColumnName.Name.O) && r.Keep(spec.NewColumnName.Name.O)
+		case ast.AlterTableAddConstraint:
+			var d bool
+			keep, d = r.rewriteConstraint(spec.Constraint)
+			dirty = dirty || d
+		}
+		if !keep {
+			dirty = true
+			continue
+		}
+		specs = append(specs, spec)
+	}
+	t.Specs = specs
+	return dirty
+}
+
+// rewriteColumn 改写脱敏列的类型，去掉不适用于新类型的选项；值不再唯一的列去掉列上的主键和唯一约束
+func (r *ColumnRule) rewriteColumn(col *ast.ColumnDef) bool {
+	name := col.Name.Name.O
+	dirty := false
+	// ALTER COLUMN 只修改默认值，没有列类型
+	if col.Tp == nil {
+		return false
+	}
+	if typ := r.maskedType(name, col.Tp.InfoSchemaStr()); typ != "" {
+		tp := types.NewFieldType(mysql.TypeVarchar)
+		tp.SetFlen(255)
+		if r.actions[strings.ToLower(name)] == columnHash {
+			tp = types.NewFieldType(mysql.TypeString)
+			tp.SetFlen(64)
+		}
+		col.Tp = tp
+		opts := col.Options[:0]
+		for _, opt := range col.Options {
+			switch opt.Tp {
+			case ast.ColumnOptionAutoIncrement, ast.ColumnOptionDefaultValue, ast.ColumnOptionOnUpdate, ast.ColumnOptionCollate:
+				continue
+			}
+			opts = append(opts, opt)
+		}
+		col.Options = opts
+		dirty = true
+	}
+	if r.lossy(name) {
+		opts := col.Options[:0]
+		for _, opt := range col.Options {
+			if opt.Tp == ast.ColumnOptionPrimaryKey || opt.Tp == ast.ColumnOptionUniqKey {
+				dirty = true
+				continue
+			}
+			opts = append(opts, opt)
+		}
+		col.Options = opts
+	}
+	return dirty
+}
+
+// rewriteConstraint 引用了不同步列的索引删除，主键和唯一索引含值不唯一的列时降为普通索引
+func (r *ColumnRule) rewriteConstraint(c *ast.Constraint) (keep bool, dirty bool) {
+	if c == nil || len(c.Keys) == 0 {
+		return true, false
+	}
+	if !r.keepIndex(c.Keys) {
+		return false, true
+	}
+	switch c.Tp {
+	case ast.ConstraintPrimaryKey, ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+		if r.lossyIndex(c.Keys) {
+			c.Tp = ast.ConstraintIndex
+			return true, true
+		}
+	}
+	return true, false
+}
+
+func (r *ColumnRule) keepIndex(keys []*ast.IndexPartSpecification) bool {
+	for _, key := range keys {
+		if key.Column != nil && !r.Keep(key.Column.Name.O) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ColumnRule) lossyIndex(keys []*ast.IndexPartSpecification) bool {
+	for _, key := range keys {
+		if key.Column != nil && r.lossy(key.Column.Name.O) {
+			return true
+		}
+	}
+	return false
+}
+
+// dropPosition AFTER 的列不同步时改为追加到末尾
+func (r *ColumnRule) dropPosition(pos *ast.ColumnPosition) bool {
+	if pos == nil || pos.Tp != ast.ColumnPositionAfter || r.Keep(pos.RelativeColumn.Name.O) {
+		return false
+	}
+	pos.Tp, pos.RelativeColumn = ast.ColumnPositionNone, nil
+	return true
+}
+
+// columnDispatcher 全量下发前按列规则改写建表语句和数据
+type columnDispatcher struct {
+	EventDispatcher
+	rule   *ColumnRule
+	schema string
+	table  string
+}
+
+func (d columnDispatcher) DDL(schema, table string, ddl interface{}) error {
+	if query, ok := ddl.(string); ok {
+		rewritten, keep, err := d.rule.RewriteDDL(query, d.schema, d.table)
+		if err != nil {
+			return err
+		}
+		if !keep {
+			return nil
+		}
+		ddl = rewritten
+	}
+	return d.EventDispatcher.DDL(schema, table, ddl)
+}
+
+func (d columnDispatcher) Data(schema, table string, keys []string, rows []map[string]interface{}) error {
+	d.rule.ApplyRows(rows)
+	return d.EventDispatcher.Data(schema, table, d.rule.keys(keys), rows)
+}
@@ -0,0 +1,29 @@
+package cannal
+
+import (
+	"go-cdc/pkg/config"
+	"testing"
+)
+
+func TestColumnRuleHashSalt(t *testing.T) {
+	cc := &config.ColumnConfig{Hash: "phone"}
+	if _, err := NewColumnRule(cc, ""); err == nil {
+		t.Fatal("hash column without salt: expected error")
+	}
+	if _, err := NewColumnRule(cc, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	// 没有 hash 列时不要求盐
+	if _, err := NewColumnRule(&config.ColumnConfig{Mask: "phone"}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ds := &config.DataSourceConfig{ID: "ds1", ColumnRules: map[string]*config.ColumnConfig{"db.user": cc}}
+	if err := ds.CheckColumnRules(); err == nil {
+		t.Fatal("check column rules without salt: expected error")
+	}
+	ds.HashSalt = "s3cret"
+	if err := ds.CheckColumnRules(); err != nil {
+		t.Fatal(err)
+	}
+}
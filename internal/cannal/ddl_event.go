@@ -0,0 +1,263 @@
+package cannal
+
+import (
+	"go-cdc/internal/model"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
+)
+
+// DDLParser 基于 TiDB parser 的 DDL 解析器，非并发安全
+type DDLParser struct {
+	p *parser.Parser
+}
+
+func NewDDLParser() *DDLParser {
+	return &DDLParser{p: parser.New()}
+}
+
+// Parse 解析 binlog 中的 QueryEvent，未限定库名的表使用 defaultSchema 补全
+// isDDL 表示语句是否为 DDL（隐式提交），events 只包含与表结构相关的 DDL
+func (dp *DDLParser) Parse(query, defaultSchema string) (events []*model.DDLEvent, isDDL bool, err error) {
+	stmts, _, err := dp.p.Parse(query, "", "")
+	if err != nil {
+		return nil, false, err
+	}
+	for _, stmt := range stmts {
+		if _, ok := stmt.(ast.DDLNode); !ok {
+			continue
+		}
+		isDDL = true
+		for _, ev := range convertDDLStmt(stmt, defaultSchema) {
+			ev.Query = query
+			events = append(events, ev)
+		}
+	}
+	return events, isDDL, nil
+}
+
+// looksLikeDDL 解析失败时按语句前缀判断是否为 DDL
+func looksLikeDDL(query string) bool {
+	up := strings.ToUpper(stripLeadingComments(query))
+	for _, prefix := range []string{"CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE"} {
+		if strings.HasPrefix(up, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableDDLPattern 修改表或索引结构的语句
+var tableDDLPattern = regexp.MustCompile(`(?i)^(CREATE\s+(TEMPORARY\s+)?TABLE|ALTER\s+(ONLINE\s+)?(IGNORE\s+)?TABLE|DROP\s+(TEMPORARY\s+)?TABLES?|RENAME\s+TABLES?|TRUNCATE|CREATE\s+(ONLINE\s+)?(UNIQUE\s+|FULLTEXT\s+|SPATIAL\s+)?INDEX|DROP\s+INDEX)\b`)
+
+// changesTable 按语句前缀判断是否修改表结构，用于解析失败时区分必须处理的 DDL
+func changesTable(query string) bool {
+	return tableDDLPattern.MatchString(stripLeadingComments(query))
+}
+
+// stripLeadingComments 去掉语句开头的空白和 /* */ 注释，可执行注释 /*! */ 中的语句会被执行，保留
+func stripLeadingComments(query string) string {
+	q := strings.TrimSpace(query)
+	for strings.HasPrefix(q, "/*") && !strings.HasPrefix(q, "/*!") {
+		end := strings.Index(q, "*/")
+		if end < 0 {
+			return q
+		}
+		q = strings.TrimSpace(q[end+2:])
+	}
+	return q
+}
+
+func convertDDLStmt(stmt ast.StmtNode, defaultSchema string) []*model.DDLEvent {
+	schemaOf := func(t *ast.TableName) string {
+		if t.Schema.O != "" {
+			return t.Schema.O
+		}
+		return defaultSchema
+	}
+	switch t := stmt.(type) {
+	case *ast.CreateTableStmt:
+		ev := &model.DDLEvent{
+			Kind:   model.DDLCreateTable,
+			Schema: schemaOf(t.Table),
+			Table:  t.Table.Name.O,
+		}
+		if t.ReferTable != nil {
+			ev.LikeSchema = schemaOf(t.ReferTable)
+			ev.LikeTable = t.ReferTable.Name.O
+		}
+		for _, col := range t.Cols {
+			def, pk := convertColumnDef(col, nil)
+			ev.Columns = append(ev.Columns, def)
+			if pk {
+				ev.PrimaryKey = append(ev.PrimaryKey, def.Name)
+			}
+		}
+		for _, c := range t.Constraints {
+			if c.Tp == ast.ConstraintPrimaryKey {
+				ev.PrimaryKey = indexColumns(c)
+			}
+		}
+		return []*model.DDLEvent{ev}
+	case *ast.AlterTableStmt:
+		return []*model.DDLEvent{convertAlterTable(t, schemaOf(t.Table))}
+	case *ast.DropTableStmt:
+		if t.IsView {
+			return nil
+		}
+		events := make([]*model.DDLEvent, 0, len(t.Tables))
+		for _, table := range t.Tables {
+			events = append(events, &model.DDLEvent{
+				Kind:   model.DDLDropTable,
+				Schema: schemaOf(table),
+				Table:  table.Name.O,
+			})
+		}
+		return events
+	case *ast.RenameTableStmt:
+		events := make([]*model.DDLEvent, 0, len(t.TableToTables))
+		for _, tt := range t.TableToTables {
+			events = append(events, &model.DDLEvent{
+				Kind:      model.DDLRenameTable,
+				Schema:    schemaOf(tt.OldTable),
+				Table:     tt.OldTable.Name.O,
+				NewSchema: schemaOf(tt.NewTable),
+				NewTable:  tt.NewTable.Name.O,
+			})
+		}
+		return events
+	case *ast.TruncateTableStmt:
+		return []*model.DDLEvent{{
+			Kind:   model.DDLTruncateTable,
+			Schema: schemaOf(t.Table),
+			Table:  t.Table.Name.O,
+		}}
+	case *ast.CreateIndexStmt:
+		return []*model.DDLEvent{{
+			Kind:   model.DDLCreateIndex,
+			Schema: schemaOf(t.Table),
+			Table:  t.Table.Name.O,
+		}}
+	case *ast.DropIndexStmt:
+		return []*model.DDLEvent{{
+			Kind:   model.DDLDropIndex,
+			Schema: schemaOf(t.Table),
+			Table:  t.Table.Name.O,
+		}}
+	case *ast.CreateDatabaseStmt:
+		return []*model.DDLEvent{{Kind: model.DDLCreateDatabase, Schema: t.Name.O}}
+	case *ast.DropDatabaseStmt:
+		return []*model.DDLEvent{{Kind: model.DDLDropDatabase, Schema: t.Name.O}}
+	}
+	return nil
+}
+
+func convertAlterTable(t *ast.AlterTableStmt, schema string) *model.DDLEvent {
+	ev := &model.DDLEvent{
+		Kind:   model.DDLAlterTable,
+		Schema: schema,
+		Table:  t.Table.Name.O,
+	}
+	for _, spec := range t.Specs {
+		switch spec.Tp {
+		case ast.AlterTableAddColumns:
+			for i, col := range spec.NewColumns {
+				// 多列添加时位置只作用于第一列，其余依次排在其后
+				pos := spec.Position
+				if i > 0 {
+					pos = &ast.ColumnPosition{
+						Tp:             ast.ColumnPositionAfter,
+						RelativeColumn: spec.NewColumns[i-1].Name,
+					}
+				}
+				def, pk := convertColumnDef(col, pos)
+				ev.AddedColumns = append(ev.AddedColumns, def)
+				if pk {
+					ev.PrimaryKey = append(ev.PrimaryKey, def.Name)
+				}
+			}
+		case ast.AlterTableDropColumn:
+			ev.DroppedColumns = append(ev.DroppedColumns, spec.OldColumnName.Name.O)
+		case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+			for _, col := range spec.NewColumns {
+				def, pk := convertColumnDef(col, spec.Position)
+				if spec.OldColumnName != nil {
+					def.OldName = spec.OldColumnName.Name.O
+				} else {
+					def.OldName = def.Name
+				}
+				ev.ModifiedColumns = append(ev.ModifiedColumns, def)
+				if pk {
+					ev.PrimaryKey = append(ev.PrimaryKey, def.Name)
+				}
+			}
+		case ast.AlterTableRenameColumn:
+			ev.RenamedColumns = append(ev.RenamedColumns, &model.ColumnRename{
+				From: spec.OldColumnName.Name.O,
+				To:   spec.NewColumnName.Name.O,
+			})
+		case ast.AlterTableRenameTable:
+			ev.NewSchema = schema
+			if spec.NewTable.Schema.O != "" {
+				ev.NewSchema = spec.NewTable.Schema.O
+			}
+			ev.NewTable = spec.NewTable.Name.O
+		case ast.AlterTableAddConstraint:
+			if spec.Constraint != nil && spec.Constraint.Tp == ast.ConstraintPrimaryKey {
+				ev.PrimaryKey = indexColumns(spec.Constraint)
+			}
+		case ast.AlterTableDropPrimaryKey:
+			ev.DropPrimaryKey = true
+		}
+	}
+	return ev
+}
+
+// convertColumnDef 转换列定义，第二个返回值表示列上是否声明了 PRIMARY KEY
+func convertColumnDef(col *ast.ColumnDef, pos *ast.ColumnPosition) (*model.ColumnDef, bool) {
+	typ := col.Tp.InfoSchemaStr()
+	// enum/set 的取值区分大小写，保持原样以便按序号还原 binlog 中的值
+	if tp := col.Tp.GetType(); tp != mysql.TypeEnum && tp != mysql.TypeSet {
+		typ = strings.ToLower(typ)
+	}
+	def := &model.ColumnDef{
+		Name:     col.Name.Name.O,
+		Type:     typ,
+		Nullable: !mysql.HasNotNullFlag(col.Tp.GetFlag()),
+	}
+	pk := false
+	for _, opt := range col.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionNotNull:
+			def.Nullable = false
+		case ast.ColumnOptionNull:
+			def.Nullable = true
+		case ast.ColumnOptionPrimaryKey:
+			def.Nullable = false
+			pk = true
+		}
+	}
+	if pos != nil {
+		switch pos.Tp {
+		case ast.ColumnPositionFirst:
+			def.First = true
+		case ast.ColumnPositionAfter:
+			def.After = pos.RelativeColumn.Name.O
+		}
+	}
+	return def, pk
+}
+
+func indexColumns(c *ast.Constraint) []string {
+	cols := make([]string, 0, len(c.Keys))
+	for _, key := range c.Keys {
+		if key.Column != nil {
+			cols = append(cols, key.Column.Name.O)
+		}
+	}
+	return cols
+}
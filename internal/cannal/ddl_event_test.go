@@ -0,0 +1,165 @@
+package cannal
+
+import (
+	"encoding/json"
+	"go-cdc/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestDDLParserTables(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  []model.DDLEvent
+	}{
+		{
+			name:  "drop several tables",
+			query: "DROP TABLE IF EXISTS a, other.b",
+			want: []model.DDLEvent{
+				{Kind: model.DDLDropTable, Schema: "db", Table: "a"},
+				{Kind: model.DDLDropTable, Schema: "other", Table: "b"},
+			},
+		},
+		{
+			name:  "rename several tables",
+			query: "RENAME TABLE a TO a_old, other.b TO db.a",
+			want: []model.DDLEvent{
+				{Kind: model.DDLRenameTable, Schema: "db", Table: "a", NewSchema: "db", NewTable: "a_old"},
+				{Kind: model.DDLRenameTable, Schema: "other", Table: "b", NewSchema: "db", NewTable: "a"},
+			},
+		},
+		{
+			name:  "create table like",
+			query: "CREATE TABLE a_copy LIKE other.a",
+			want: []model.DDLEvent{
+				{Kind: model.DDLCreateTable, Schema: "db", Table: "a_copy", LikeSchema: "other", LikeTable: "a"},
+			},
+		},
+		{
+			name:  "truncate",
+			query: "TRUNCATE TABLE a",
+			want:  []model.DDLEvent{{Kind: model.DDLTruncateTable, Schema: "db", Table: "a"}},
+		},
+		{
+			name:  "create index",
+			query: "CREATE INDEX idx ON other.a (c)",
+			want:  []model.DDLEvent{{Kind: model.DDLCreateIndex, Schema: "other", Table: "a"}},
+		},
+		{
+			name:  "database",
+			query: "CREATE DATABASE IF NOT EXISTS shop",
+			want:  []model.DDLEvent{{Kind: model.DDLCreateDatabase, Schema: "shop"}},
+		},
+	}
+	dp := NewDDLParser()
+	for _, c := range cases {
+		events, isDDL, err := dp.Parse(c.query, "db")
+		if err != nil || !isDDL {
+			t.Errorf("%s: isDDL %v, err %v", c.name, isDDL, err)
+			continue
+		}
+		got := make([]model.DDLEvent, len(events))
+		for i, ev := range events {
+			if ev.Query != c.query {
+				t.Errorf("%s: query %q not kept", c.name, ev.Query)
+			}
+			got[i] = *ev
+			got[i].Query = ""
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestDDLParserAlterTable(t *testing.T) {
+	query := "ALTER TABLE a ADD COLUMN w int FIRST, ADD COLUMN (x int NOT NULL, y varchar(8)), DROP COLUMN z, " +
+		"CHANGE COLUMN c d bigint unsigned NULL AFTER x, MODIFY e ENUM('A','b'), RENAME COLUMN f TO g, " +
+		"DROP PRIMARY KEY, ADD PRIMARY KEY (x, d), RENAME TO other.b"
+	events, isDDL, err := NewDDLParser().Parse(query, "db")
+	if err != nil || !isDDL || len(events) != 1 {
+		t.Fatalf("got %d events, isDDL %v, err %v", len(events), isDDL, err)
+	}
+	ev := events[0]
+	ev.Query = ""
+	want := &model.DDLEvent{
+		Kind:      model.DDLAlterTable,
+		Schema:    "db",
+		Table:     "a",
+		NewSchema: "other",
+		NewTable:  "b",
+		AddedColumns: []*model.ColumnDef{
+			{Name: "w", Type: "int(11)", Nullable: true, First: true},
+			{Name: "x", Type: "int(11)", Nullable: false},
+			{Name: "y", Type: "varchar(8)", Nullable: true, After: "x"},
+		},
+		DroppedColumns: []string{"z"},
+		ModifiedColumns: []*model.ColumnDef{
+			{Name: "d", OldName: "c", Type: "bigint(20) unsigned", Nullable: true, After: "x"},
+			{Name: "e", OldName: "e", Type: "enum('A','b')", Nullable: true},
+		},
+		RenamedColumns: []*model.ColumnRename{{From: "f", To: "g"}},
+		PrimaryKey:     []string{"x", "d"},
+		DropPrimaryKey: true,
+	}
+	if !reflect.DeepEqual(ev, want) {
+		got, _ := json.Marshal(ev)
+		exp, _ := json.Marshal(want)
+		t.Fatalf("got %s\nwant %s", got, exp)
+	}
+}
+
+func TestDDLParserSkipped(t *testing.T) {
+	dp := NewDDLParser()
+	cases := []struct {
+		query string
+		isDDL bool
+	}{
+		// 视图不影响表结构，但仍是隐式提交的 DDL
+		{"DROP VIEW IF EXISTS v", true},
+		{"CREATE VIEW v AS SELECT 1", true},
+		{"SAVEPOINT sp1", false},
+		{"INSERT INTO a VALUES (1)", false},
+	}
+	for _, c := range cases {
+		events, isDDL, err := dp.Parse(c.query, "db")
+		if err != nil {
+			t.Errorf("%s: %v", c.query, err)
+			continue
+		}
+		if len(events) != 0 || isDDL != c.isDDL {
+			t.Errorf("%s: got %d events, isDDL %v", c.query, len(events), isDDL)
+		}
+	}
+}
+
+func TestDDLParserUnparseable(t *testing.T) {
+	cases := []struct {
+		query        string
+		looksLikeDDL bool
+		changesTable bool
+	}{
+		{"ALTER TABLE a ADD COLUMN x int ALGORITHM=FOO", true, true},
+		{"/* gh-ost */ alter online table a engine=foo bar", true, true},
+		{"CREATE TEMPORARY TABLE t (", true, true},
+		{"DROP TABLES a b", true, true},
+		{"CREATE UNIQUE INDEX i ON", true, true},
+		{"CREATE TRIGGER trg BEFORE INSERT ON a FOR EACH ROW BEGIN SET @x = 1; END", true, false},
+		{"CREATE DEFINER=`root`@`%` PROCEDURE p() BEGIN SELECT 1; END", true, false},
+		{"ALTER USER u IDENTIFIED BY", true, false},
+		{"TABLE-ish garbage", false, false},
+	}
+	dp := NewDDLParser()
+	for _, c := range cases {
+		if _, _, err := dp.Parse(c.query, "db"); err == nil {
+			t.Errorf("%s: expected a parse error", c.query)
+		}
+		if got := looksLikeDDL(c.query); got != c.looksLikeDDL {
+			t.Errorf("looksLikeDDL(%s) got %v", c.query, got)
+		}
+		if got := changesTable(c.query); got != c.changesTable {
+			t.Errorf("changesTable(%s) got %v", c.query, got)
+		}
+	}
+}
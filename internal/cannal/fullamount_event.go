@@ -2,7 +2,10 @@ package cannal
 
 import (
 	"context"
+	"fmt"
 	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -10,8 +13,11 @@ import (
 // EventDispatcher 全量同步事件分发器
 type EventDispatcher interface {
 	DDL(schema, table string, ddl interface{}) error
-	Data(schema, table string, rows []map[string]interface{}) error
+	Data(schema, table string, keys []string, rows []map[string]interface{}) error
 	End(schema, table string, pos interface{}) error
+	Checkpoint(schema, table string, lastPK string, rowsCopied int64) error
+	RangeCheckpoint(schema, table string, rangeID int64, lastPK string, rowsCopied int64) error
+	RangeEnd(schema, table string, rangeID int64) error
 	Rollback(schema, table string, err error) error
 }
 
@@ -36,10 +42,12 @@ func (cd *ChannelDispatcher) DDL(schema, table string, ddl interface{}) error {
 	}
 }
 
-func (cd *ChannelDispatcher) Data(schema, table string, rows []map[string]interface{}) error {
+// Data keys 为分块读取使用的键列，整表流式读取时为空
+func (cd *ChannelDispatcher) Data(schema, table string, keys []string, rows []map[string]interface{}) error {
 	msg := map[string]interface{}{
 		"schema": schema,
 		"table":  table,
+		"keys":   keys,
 		"data":   rows,
 		"type":   "insert",
 	}
@@ -66,6 +74,57 @@ func (cd *ChannelDispatcher) End(schema, table string, pos interface{}) error {
 	}
 }
 
+// Checkpoint 分块进度跟随数据进入通道，消费者处理完此前的数据后才落库，lastPK 为 syncdb.EncodeKey 的结果
+func (cd *ChannelDispatcher) Checkpoint(schema, table string, lastPK string, rowsCopied int64) error {
+	msg := map[string]interface{}{
+		"schema": schema,
+		"table":  table,
+		"pk":     lastPK,
+		"rows":   rowsCopied,
+		"type":   "checkpoint",
+	}
+	select {
+	case cd.ch <- msg:
+		return nil
+	case <-cd.ctx.Done():
+		return cd.ctx.Err()
+	}
+}
+
+// RangeCheckpoint 大表切分读取时单个范围的分块进度
+func (cd *ChannelDispatcher) RangeCheckpoint(schema, table string, rangeID int64, lastPK string, rowsCopied int64) error {
+	msg := map[string]interface{}{
+		"schema": schema,
+		"table":  table,
+		"range":  rangeID,
+		"pk":     lastPK,
+		"rows":   rowsCopied,
+		"type":   "range_checkpoint",
+	}
+	select {
+	case cd.ch <- msg:
+		return nil
+	case <-cd.ctx.Done():
+		return cd.ctx.Err()
+	}
+}
+
+// RangeEnd 单个范围读取完成
+func (cd *ChannelDispatcher) RangeEnd(schema, table string, rangeID int64) error {
+	msg := map[string]interface{}{
+		"schema": schema,
+		"table":  table,
+		"range":  rangeID,
+		"type":   "range_end",
+	}
+	select {
+	case cd.ch <- msg:
+		return nil
+	case <-cd.ctx.Done():
+		return cd.ctx.Err()
+	}
+}
+
 func (cd *ChannelDispatcher) Rollback(schema, table string, err error) error {
 	msg := map[string]interface{}{
 		"schema": schema,
@@ -94,3 +153,54 @@ func (cc ConsoleConsumer) Consume(msg map[string]interface{}) error {
 	log.Log.Info("Consume", zap.Any("msg", msg))
 	return nil
 }
+
+// snapshotEventConsumer 将全量事件转换为 model.Event 交给增量消费者，全量与增量共用同一个下游：
+// 建表语句解析为 ddl 事件，数据行转换为 read 事件，end、rollback 只用于记录进度不下发
+type snapshotEventConsumer struct {
+	consumer   IncrementalConsumer
+	dataSource string
+	parser     *DDLParser
+}
+
+func (c *snapshotEventConsumer) Consume(msg map[string]interface{}) error {
+	sc, _ := msg["schema"].(string)
+	tb, _ := msg["table"].(string)
+	ts := time.Now().Unix()
+	var events []*model.Event
+	switch msg["type"] {
+	case "create_table":
+		query, _ := msg["data"].(string)
+		ddls, _, err := c.parser.Parse(query, sc)
+		if err != nil {
+			return fmt.Errorf("parse ddl of %s.%s err: %w", sc, tb, err)
+		}
+		for _, ddl := range ddls {
+			events = append(events, &model.Event{
+				DataSource: c.dataSource,
+				Schema:     ddl.Schema,
+				Table:      ddl.Table,
+				Op:         "ddl",
+				Ts:         ts,
+				DDL:        ddl,
+			})
+		}
+	case "insert":
+		keys, _ := msg["keys"].([]string)
+		rows, _ := msg["data"].([]map[string]interface{})
+		for _, row := range rows {
+			events = append(events, &model.Event{
+				DataSource: c.dataSource,
+				Schema:     sc,
+				Table:      tb,
+				Op:         model.OpRead,
+				Data:       row,
+				Ts:         ts,
+				Keys:       keys,
+			})
+		}
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return c.consumer.Consume(events)
+}
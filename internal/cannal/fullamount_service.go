@@ -2,12 +2,14 @@ package cannal
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"fmt"
 	"go-cdc/internal/log"
 	"go-cdc/internal/model"
 	"go-cdc/internal/syncdb"
 	"go-cdc/pkg/config"
+	"strings"
+	"sync"
 
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
@@ -15,27 +17,25 @@ import (
 
 // FullAmountService 全量同步服务
 type FullAmountService struct {
-	ds         map[string]*syncdb.DataSourceHolder
-	dispatcher ChannelDispatcher
-	snapshot   SnapshotReader
-	consumer   Consumer
-	eg         *errgroup.Group
+	ds            map[string]*syncdb.DataSourceHolder
+	snapshot      SnapshotReader
+	eventConsumer EventConsumer
+	consumer      IncrementalConsumer // 非空时全量事件转换为 model.Event 与增量投递到同一个下游
+}
+
+// SnapshotResult 数据源全量同步结果
+type SnapshotResult struct {
+	Tables map[string]*model.Position // schema.table -> 表快照位点
+	Start  *model.Position            // 各表位点中最早的位置，增量同步从这里开始
+	Final  *model.Position            // 各表位点中最晚的位置，即全量结束位点 Gfinal
 }
 
 // NewFullAmountService 创建全量同步服务
 func NewFullAmountService(ds map[string]*syncdb.DataSourceHolder) *FullAmountService {
-	ch := make(chan map[string]interface{}, 1000)
-	eg, ctx := errgroup.WithContext(context.Background())
 	return &FullAmountService{
-		ds:         ds,
-		dispatcher: ChannelDispatcher{ch: ch, ctx: ctx},
-		snapshot:   SnapshotReader{chunkSize: 100, concurrency: 10},
-		consumer: Consumer{
-			eventConsumer: ConsoleConsumer{},
-			ch:            ch,
-			ctx:           ctx,
-		},
-		eg: eg,
+		ds:            ds,
+		snapshot:      SnapshotReader{chunkSize: 100, concurrency: 10},
+		eventConsumer: ConsoleConsumer{},
 	}
 }
 
@@ -45,33 +45,92 @@ func (s *FullAmountService) Run() error {
 		if !holder.IsMysql() {
 			continue
 		}
-		if err := s.handleSource(holder); err != nil {
+		if _, err := s.RunSource(context.Background(), holder, false); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// RunSource 全量同步单个数据源，任一表失败即返回错误，schemaOnly 时只下发建表 DDL
+func (s *FullAmountService) RunSource(ctx context.Context, holder *syncdb.DataSourceHolder, schemaOnly bool) (*SnapshotResult, error) {
+	reader := s.snapshot
+	reader.schemaOnly = schemaOnly
+	reader.consistent = holder.Config.SnapshotConsistent
+	return s.handleSource(ctx, holder, reader)
+}
+
 // handleSource 执行主流程
-func (s *FullAmountService) handleSource(holder *syncdb.DataSourceHolder) error {
-	parser := FilterRuleParser{
-		rule: holder.Config.ParseFilterConfig(),
+func (s *FullAmountService) handleSource(ctx context.Context, holder *syncdb.DataSourceHolder, reader SnapshotReader) (*SnapshotResult, error) {
+	rule, err := holder.Config.ParseFilterConfig()
+	if err != nil {
+		return nil, err
 	}
+	parser := FilterRuleParser{rule: rule}
 
 	schemas, err := parser.LoadAndFilterSchemas(*holder)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	tables, err := parser.LoadAndFilterTables(*holder, schemas)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	go s.consumer.Run()
-	if err := s.snapshot.ReadAll(s.eg, *holder, tables, &s.dispatcher); err != nil {
-		return err
+
+	// 每个数据源使用独立的通道，消费者以外层 ctx 运行，保证 Wait 返回后仍能消费完剩余事件
+	ch := make(chan map[string]interface{}, 1000)
+	eg, egCtx := errgroup.WithContext(ctx)
+	eventConsumer := s.eventConsumer
+	if s.consumer != nil {
+		eventConsumer = &snapshotEventConsumer{consumer: s.consumer, dataSource: holder.Config.ID, parser: NewDDLParser()}
 	}
-	defer close(s.dispatcher.ch)
-	return nil
+	consumer := Consumer{
+		eventConsumer: eventConsumer,
+		ch:            ch,
+		ctx:           ctx,
+		dataSourceID:  holder.Config.ID,
+		failed:        make(map[string]bool),
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		consumer.Run()
+	}()
+	positions, err := reader.ReadAll(eg, *holder, tables, &ChannelDispatcher{ch: ch, ctx: egCtx})
+	close(ch)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	if len(consumer.failed) > 0 {
+		return nil, fmt.Errorf("snapshot of %d tables failed to consume", len(consumer.failed))
+	}
+	return s.result(holder, positions)
+}
+
+// result 汇总各表快照位点，没有需要同步的表时以当前位置作为起止位点
+func (s *FullAmountService) result(holder *syncdb.DataSourceHolder, positions map[string]*model.Position) (*SnapshotResult, error) {
+	res := &SnapshotResult{Tables: positions}
+	list := make([]*model.Position, 0, len(positions))
+	for _, pos := range positions {
+		list = append(list, pos)
+	}
+	var err error
+	if res.Start, err = model.MinPosition(list...); err != nil {
+		return nil, err
+	}
+	if res.Final, err = model.MaxPosition(list...); err != nil {
+		return nil, err
+	}
+	if res.Start == nil {
+		source := holder.Source.(*syncdb.MysqlDataSource)
+		pos, err := syncdb.BinlogInitializer{}.Position(source.Db, source.PosMode)
+		if err != nil {
+			return nil, err
+		}
+		res.Start, res.Final = pos, pos.Clone()
+	}
+	return res, nil
 }
 
 // FilterRuleParser 全量或增量同步过滤库和表的规则解析器
@@ -107,103 +166,338 @@ func (f FilterRuleParser) LoadAndFilterTables(holder syncdb.DataSourceHolder, sc
 type SnapshotReader struct {
 	chunkSize   int
 	concurrency int
+	schemaOnly  bool // 只下发建表 DDL，不读取数据
+	consistent  bool // 所有表共用一组同一位点的一致性快照
 }
 
-func (sr SnapshotReader) ReadAll(eg *errgroup.Group, holder syncdb.DataSourceHolder, tables map[string][]string, dispatch EventDispatcher) error {
+// ReadAll 并发读取所有表，返回 schema.table -> 表快照位点
+func (sr SnapshotReader) ReadAll(eg *errgroup.Group, holder syncdb.DataSourceHolder, tables map[string][]string, dispatch EventDispatcher) (map[string]*model.Position, error) {
+	// 一致性模式下事务池兼做并发控制，每张表占用一个快照事务读完后归还
+	var pool chan *syncdb.TxSnapshot
+	if sr.consistent {
+		snapshots, err := holder.Source.BeginConsistentSnapshots(sr.concurrency)
+		if err != nil {
+			log.Log.Error("begin consistent snapshots error", zap.String("datasource", holder.Config.ID), zap.Error(err))
+			return nil, err
+		}
+		log.Log.Info("consistent snapshot opened", zap.String("datasource", holder.Config.ID),
+			zap.Int("connections", len(snapshots)), zap.String("pos", snapshots[0].Pos.String()))
+		pool = make(chan *syncdb.TxSnapshot, len(snapshots))
+		for _, snap := range snapshots {
+			pool <- snap
+		}
+		defer func() {
+			for _, snap := range snapshots {
+				_ = snap.Commit()
+			}
+		}()
+	}
+
 	sem := make(chan struct{}, sr.concurrency)
+	var lock sync.Mutex
+	positions := make(map[string]*model.Position)
 	for schema, list := range tables {
 		for _, table := range list {
 			sc, tb := schema, table
-			sem <- struct{}{}
+			var shared *syncdb.TxSnapshot
+			if pool != nil {
+				shared = <-pool
+			} else {
+				sem <- struct{}{}
+			}
 
 			eg.Go(func() error {
-				defer func() { <-sem }()
-				err := sr.readOneTable(holder, sc, tb, dispatch)
+				defer func() {
+					if shared != nil {
+						pool <- shared
+					} else {
+						<-sem
+					}
+				}()
+				pos, err := sr.readOneTable(holder, sc, tb, shared, dispatch)
 				if err != nil {
 					if err := dispatch.Rollback(sc, tb, err); err != nil {
 						log.Log.Error("dispatch rollback error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
 						return err
 					}
+					return err
 				}
-				return err
+				lock.Lock()
+				positions[sc+"."+tb] = pos
+				lock.Unlock()
+				return nil
 			})
 		}
 	}
 
-	return eg.Wait()
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return positions, nil
 }
 
-func (sr SnapshotReader) readOneTable(holder syncdb.DataSourceHolder, sc, tb string, dispatcher EventDispatcher) error {
-	snap, err := holder.Source.BeginTransactionSnapshot()
+// readOneTable 读取单表，shared 非空时在共享的一致性快照中读取，不沿用上次的进度也不切分范围
+func (sr SnapshotReader) readOneTable(holder syncdb.DataSourceHolder, sc, tb string, shared *syncdb.TxSnapshot, dispatcher EventDispatcher) (*model.Position, error) {
+	service := model.GetTableMetaService()
+	meta, err := service.GetTableMeta(holder.Config.ID, sc, tb)
 	if err != nil {
-		log.Log.Error("begin snapshot error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
-		return err
+		log.Log.Error("load table meta error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return nil, err
+	}
+	var ranges []*model.SnapshotRange
+	snap := shared
+	if snap == nil {
+		// 本轮已完成的表直接使用记录的快照位点
+		if meta != nil && meta.SnapshotStatus == model.SnapshotDone && meta.SnapshotKind != model.SnapshotKindIncremental {
+			return model.ParsePosition(meta.PosMode, meta.LastPos)
+		}
+		if ranges, err = service.ListSnapshotRanges(holder.Config.ID, sc, tb); err != nil {
+			log.Log.Error("load snapshot ranges error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return nil, err
+		}
+		if snap, err = holder.Source.BeginTransactionSnapshot(); err != nil {
+			log.Log.Error("begin snapshot error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return nil, err
+		}
+		defer func() {
+			_ = snap.Commit()
+		}()
+	} else {
+		// 之前的进度读自其他位点，一致性模式下整表重读
+		meta = nil
 	}
 	tx := snap.Tx
-	defer model.GetTableMetaService().SaveOrUpdateTableMeta(holder.Config.ID, sc, tb, model.ParseGTID(snap.Pos.(map[string][]string)))
-	defer func() {
-		_ = tx.Commit()
-	}()
+
+	// 分页键：主键 > 非空唯一索引 > 代理键，键的列序决定分页顺序，续传时需要按同样的列序解析进度
+	var keys []*syncdb.KeyColumn
+	if !sr.schemaOnly {
+		if keys, err = sr.chunkKeys(holder, tx, sc, tb); err != nil {
+			log.Log.Error("get table chunk keys error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return nil, err
+		}
+	}
+
+	// 从上次中断的分块继续：之前分块的数据读自更早的快照，表快照位点沿用首次的位点，
+	// 两次快照之间的事务由增量重放到已读取的行上，保证不丢数据
+	pos := snap.Pos
+	var lastPK []interface{}
+	var rowsCopied int64
+	resume, resumed := resumeState(meta, snap.Pos.Mode, keys)
+	resumeRanges := !resumed && len(ranges) > 0 && len(keys) > 0 && ranges[0].Col == keys[0].Name && meta != nil &&
+		(meta.SnapshotStatus == model.SnapshotRunning || meta.SnapshotStatus == model.SnapshotFailed)
+	switch {
+	case resumed:
+		pos, lastPK, rowsCopied = resume.pos, resume.lastPK, resume.rows
+		log.Log.Info("resume table snapshot", zap.String("schema", sc), zap.String("table", tb), zap.Int64("rows", rowsCopied))
+		err = service.SetTableSnapshotStatus(holder.Config.ID, sc, tb, model.SnapshotRunning)
+	case resumeRanges:
+		log.Log.Info("resume table snapshot ranges", zap.String("schema", sc), zap.String("table", tb), zap.Int("ranges", len(ranges)))
+		err = service.SetTableSnapshotStatus(holder.Config.ID, sc, tb, model.SnapshotRunning)
+	default:
+		ranges = nil
+		if err = service.SaveSnapshotRanges(holder.Config.ID, sc, tb, nil); err == nil {
+			err = service.StartTableSnapshot(holder.Config.ID, sc, tb, snap.Pos)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 列裁剪与脱敏在下发前进行，结构历史仍以源表结构为准
+	rule, err := columnRuleOf(holder.Config, sc, tb)
+	if err != nil {
+		log.Log.Error("parse column rule error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return nil, err
+	}
+	if rule != nil {
+		dispatcher = columnDispatcher{EventDispatcher: dispatcher, rule: rule, schema: sc, table: tb}
+	}
+
 	// 1. 获取表的建表语句
 	ddl, err := holder.Source.GetTableDDL(tx, sc, tb)
 	if err != nil {
 		log.Log.Error("get table ddl error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
-		return err
+		return nil, err
 	}
-	if err = dispatcher.DDL(sc, tb, ddl); err != nil {
-		log.Log.Error("dispatch ddl error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
-		return err
+	if !resumed && !resumeRanges {
+		// 以快照时的表结构作为增量解析行数据的初始版本
+		if err = NewSchemaTracker(&holder).Seed(sc, tb, ddl, snap.Pos); err != nil {
+			log.Log.Warn("seed schema history error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		}
+		if err = dispatcher.DDL(sc, tb, ddl); err != nil {
+			log.Log.Error("dispatch ddl error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return nil, err
+		}
 	}
-	// 2. 获取表的主键
-	keys, err := holder.Source.GetTablePrimaryKeys(tx, sc, tb)
+	if sr.schemaOnly {
+		if err := dispatcher.End(sc, tb, pos); err != nil {
+			log.Log.Error("dispatch end error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return nil, err
+		}
+		return pos, nil
+	}
+	// 配置的行过滤条件下推到快照查询中
+	filter, err := rowFilterSQL(holder.Config, sc, tb)
 	if err != nil {
-		log.Log.Error("get table primary keys error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
-		return err
+		log.Log.Error("parse row filter error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return nil, err
 	}
-	lastPK := make(map[string]interface{}, len(keys))
-	for _, key := range keys {
-		lastPK[key] = nil
+	switch {
+	case len(keys) == 0:
+		// 没有可分页的键，整表一次流式读取，中断后只能从头重读
+		log.Log.Warn("table has no usable key, read whole table in one query", zap.String("schema", sc), zap.String("table", tb))
+		err = holder.Source.FetchTableStream(tx, sc, tb, filter, sr.chunkSize, func(rows []map[string]interface{}) error {
+			return dispatcher.Data(sc, tb, nil, rows)
+		})
+		if err != nil {
+			log.Log.Error("fetch table stream error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return nil, err
+		}
+	default:
+		// 2. 大表切分为多个键范围并行读取，表快照位点取各范围位点中最早的位置
+		if shared == nil && !resumed && len(ranges) == 0 {
+			if ranges, err = sr.splitTable(holder, tx, sc, tb, keys[0]); err != nil {
+				log.Log.Error("split table error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+				return nil, err
+			}
+		}
+		if len(ranges) > 0 {
+			_ = snap.Commit()
+			positions, err := sr.readRanges(holder, sc, tb, keys, filter, ranges, dispatcher)
+			if err != nil {
+				return nil, err
+			}
+			if pos, err = model.MinPosition(positions...); err != nil {
+				return nil, err
+			}
+			break
+		}
+		// 3. 分块读取数据，每个分块之后记录进度
+		err = sr.readChunks(holder, tx, sc, tb, keys, lastPK, nil, filter, rowsCopied, dispatcher, func(lastPK string, rows int64) error {
+			return dispatcher.Checkpoint(sc, tb, lastPK, rows)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := dispatcher.End(sc, tb, pos); err != nil {
+		log.Log.Error("dispatch end error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return nil, err
 	}
-	// 3. 分块读取数据
-	total, err := sr.countRows(tx, sc, tb)
+	return pos, nil
+}
+
+// chunkKeys 分页读取使用的键，依次取主键、所有列非空的唯一索引、配置的代理键，都没有或代理键含可空列时返回空
+func (sr SnapshotReader) chunkKeys(holder syncdb.DataSourceHolder, tx syncdb.Querier, sc, tb string) ([]*syncdb.KeyColumn, error) {
+	keys, err := holder.Source.GetTablePrimaryKeys(tx, sc, tb)
+	if err != nil || len(keys) > 0 {
+		return keys, err
+	}
+	keys, err = holder.Source.GetTableUniqueKeys(tx, sc, tb)
+	if err != nil || len(keys) > 0 {
+		return keys, err
+	}
+	names := holder.Config.SurrogateKey(sc, tb)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	keys, err = holder.Source.GetKeyColumns(tx, sc, tb, names)
 	if err != nil {
-		log.Log.Error("count rows error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
-		return err
+		return nil, err
+	}
+	// 可空列上的行比较结果为 NULL，按键分页会漏掉数据
+	for _, key := range keys {
+		if key.Nullable {
+			log.Log.Warn("surrogate key column is nullable, ignore it", zap.String("schema", sc), zap.String("table", tb), zap.String("column", key.Name))
+			return nil, nil
+		}
 	}
+	return keys, nil
+}
 
-	for i := 0; i < *total; i += sr.chunkSize {
-		rows, newPK, err := holder.Source.FetchTableChunk(tx, sc, tb, lastPK, sr.chunkSize)
+// readChunks 在事务快照中从 lastPK 之后分块读取，lastPK 为 nil 时从头读取，filter 为行过滤条件，每个分块下发后调用 checkpoint 记录进度
+func (sr SnapshotReader) readChunks(holder syncdb.DataSourceHolder, tx syncdb.Querier, sc, tb string, keys []*syncdb.KeyColumn, lastPK []interface{}, r *syncdb.ChunkRange, filter string,
+	rowsCopied int64, dispatcher EventDispatcher, checkpoint func(lastPK string, rows int64) error) error {
+	for {
+		rows, newPK, err := holder.Source.FetchTableRangeChunk(tx, sc, tb, keys, lastPK, r, filter, sr.chunkSize)
 		if err != nil {
 			log.Log.Error("fetch table chunk error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
 			return err
 		}
-		if err := dispatcher.Data(sc, tb, rows); err != nil {
+		if len(rows) == 0 {
+			return nil
+		}
+		if err := dispatcher.Data(sc, tb, syncdb.KeyNames(keys), rows); err != nil {
 			log.Log.Error("dispatch data error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
 			return err
 		}
 		lastPK = newPK
+		rowsCopied += int64(len(rows))
+		pk, err := syncdb.EncodeKey(keys, lastPK)
+		if err != nil {
+			return err
+		}
+		if err := checkpoint(pk, rowsCopied); err != nil {
+			log.Log.Error("dispatch checkpoint error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			return err
+		}
+		if len(rows) < sr.chunkSize {
+			return nil
+		}
 	}
-	if err := dispatcher.End(sc, tb, snap.Pos); err != nil {
-		log.Log.Error("dispatch end error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
-		return err
+}
+
+type snapshotResume struct {
+	pos    *model.Position
+	lastPK []interface{}
+	rows   int64
+}
+
+// resumeState 判断表能否从上次中断的分块继续
+func resumeState(meta *model.TableMeta, mode string, keys []*syncdb.KeyColumn) (*snapshotResume, bool) {
+	if meta == nil {
+		return nil, false
 	}
-	return nil
+	return decodeResume(meta.SnapshotStatus, meta.PosMode, meta.SnapshotPos, meta.LastChunkPK, meta.RowsCopied, mode, keys)
+}
+
+// decodeResume 要求状态为进行中或失败、记录了分块进度、位点类型未变且进度能按当前的键列解析
+func decodeResume(status, posMode, snapshotPos, lastChunkPK string, rows int64, mode string, keys []*syncdb.KeyColumn) (*snapshotResume, bool) {
+	if len(keys) == 0 || lastChunkPK == "" || lastChunkPK == "null" || posMode != mode {
+		return nil, false
+	}
+	if status != model.SnapshotRunning && status != model.SnapshotFailed {
+		return nil, false
+	}
+	pos, err := model.ParsePosition(posMode, snapshotPos)
+	if err != nil || pos.IsEmpty() {
+		return nil, false
+	}
+	lastPK, err := syncdb.DecodeKey(keys, lastChunkPK)
+	if err != nil {
+		return nil, false
+	}
+	return &snapshotResume{pos: pos, lastPK: lastPK, rows: rows}, true
 }
 
-func (sr SnapshotReader) countRows(tx *sql.Tx, sc, tb string) (*int, error) {
-	query := fmt.Sprintf("select count(*) from `%s`.`%s`", sc, tb)
-	var count int
-	if err := tx.QueryRow(query).Scan(&count); err != nil {
-		log.Log.Error("count rows error", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+// decodeJSON 数字解码为 json.Number，避免大整数主键丢失精度
+func decodeJSON(str string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(str))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
 		return nil, err
 	}
-	return &count, nil
+	return v, nil
 }
 
+// Consumer 按顺序消费全量事件，并在此前的数据消费成功后持久化表的全量进度
 type Consumer struct {
 	ch            <-chan map[string]interface{}
 	eventConsumer EventConsumer
 	ctx           context.Context
+	dataSourceID  string
+	failed        map[string]bool // schema.table -> 已有事件消费失败，不再推进进度
 }
 
 func (c *Consumer) Run() {
@@ -213,11 +507,69 @@ func (c *Consumer) Run() {
 			if !ok {
 				return
 			}
-			if err := c.eventConsumer.Consume(msg); err != nil {
-				log.Log.Error("consume message failed", zap.Error(err))
-			}
+			c.handle(msg)
 		case <-c.ctx.Done():
 			return
 		}
 	}
 }
+
+func (c *Consumer) handle(msg map[string]interface{}) {
+	sc, _ := msg["schema"].(string)
+	tb, _ := msg["table"].(string)
+	key := sc + "." + tb
+	service := model.GetTableMetaService()
+	switch msg["type"] {
+	case "checkpoint":
+		if c.failed[key] {
+			return
+		}
+		pk, _ := msg["pk"].(string)
+		rows, _ := msg["rows"].(int64)
+		if err := service.SaveSnapshotChunk(c.dataSourceID, sc, tb, pk, rows); err != nil {
+			log.Log.Error("save snapshot chunk failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		}
+		return
+	case "range_checkpoint":
+		if c.failed[key] {
+			return
+		}
+		id, _ := msg["range"].(int64)
+		pk, _ := msg["pk"].(string)
+		rows, _ := msg["rows"].(int64)
+		if err := service.SaveSnapshotRangeChunk(id, pk, rows); err != nil {
+			log.Log.Error("save snapshot range chunk failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		}
+		return
+	case "range_end":
+		if c.failed[key] {
+			return
+		}
+		id, _ := msg["range"].(int64)
+		if err := service.SetSnapshotRangeStatus(id, model.SnapshotDone); err != nil {
+			c.failed[key] = true
+			log.Log.Error("finish snapshot range failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		}
+		return
+	case "rollback":
+		c.failed[key] = true
+		if err := service.SetTableSnapshotStatus(c.dataSourceID, sc, tb, model.SnapshotFailed); err != nil {
+			log.Log.Error("save snapshot status failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		}
+	}
+	if err := c.eventConsumer.Consume(msg); err != nil {
+		log.Log.Error("consume message failed", zap.Error(err))
+		if !c.failed[key] {
+			c.failed[key] = true
+			_ = service.SetTableSnapshotStatus(c.dataSourceID, sc, tb, model.SnapshotFailed)
+		}
+		return
+	}
+	if msg["type"] == "end" && !c.failed[key] {
+		pos, _ := msg["pos"].(*model.Position)
+		if err := service.FinishTableSnapshot(c.dataSourceID, sc, tb, pos); err != nil {
+			c.failed[key] = true
+			log.Log.Error("finish table snapshot failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		}
+	}
+}
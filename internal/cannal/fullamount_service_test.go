@@ -0,0 +1,102 @@
+package cannal
+
+import (
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeResume(t *testing.T) {
+	const (
+		filePos = `{"file":"mysql-bin.000003","pos":1024}`
+		gtidPos = `"3e11fa47-71ca-11e1-9e33-c80aa9429562:1-5"`
+	)
+	keys := []*syncdb.KeyColumn{{Name: "tenant", DataType: "int"}, {Name: "id", DataType: "bigint", Unsigned: true}}
+	cases := []struct {
+		name        string
+		status      string
+		posMode     string
+		snapshotPos string
+		lastChunkPK string
+		mode        string
+		keys        []*syncdb.KeyColumn
+		lastPK      []interface{}
+	}{
+		{
+			name: "running", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[3,18446744073709551615]`, mode: model.PosModeFile, keys: keys,
+			lastPK: []interface{}{int64(3), uint64(18446744073709551615)},
+		},
+		{
+			name: "failed", status: model.SnapshotFailed, posMode: model.PosModeGTID, snapshotPos: gtidPos,
+			lastChunkPK: `[3,7]`, mode: model.PosModeGTID, keys: keys,
+			lastPK: []interface{}{int64(3), int64(7)},
+		},
+		{
+			name: "done", status: model.SnapshotDone, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[3,7]`, mode: model.PosModeFile, keys: keys,
+		},
+		{
+			name: "pending", status: model.SnapshotPending, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[3,7]`, mode: model.PosModeFile, keys: keys,
+		},
+		{
+			name: "no chunk yet", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: "", mode: model.PosModeFile, keys: keys,
+		},
+		{
+			name: "null chunk", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: "null", mode: model.PosModeFile, keys: keys,
+		},
+		{
+			// 数据源从文件位点切换到 GTID 后，旧位点不能作为增量起点
+			name: "position mode changed", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[3,7]`, mode: model.PosModeGTID, keys: keys,
+		},
+		{
+			name: "empty position", status: model.SnapshotRunning, posMode: model.PosModeGTID, snapshotPos: "",
+			lastChunkPK: `[3,7]`, mode: model.PosModeGTID, keys: keys,
+		},
+		{
+			name: "invalid position", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: `{"file":`,
+			lastChunkPK: `[3,7]`, mode: model.PosModeFile, keys: keys,
+		},
+		{
+			// 中断期间主键增加了列，旧进度不能按新键比较
+			name: "key columns added", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[7]`, mode: model.PosModeFile, keys: keys,
+		},
+		{
+			name: "key columns removed", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[3,7]`, mode: model.PosModeFile, keys: keys[1:],
+		},
+		{
+			name: "key type changed to binary", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `["not base64!"]`, mode: model.PosModeFile, keys: []*syncdb.KeyColumn{{Name: "id", DataType: "varbinary"}},
+		},
+		{
+			name: "no usable key", status: model.SnapshotRunning, posMode: model.PosModeFile, snapshotPos: filePos,
+			lastChunkPK: `[3,7]`, mode: model.PosModeFile, keys: nil,
+		},
+	}
+	for _, c := range cases {
+		resume, ok := decodeResume(c.status, c.posMode, c.snapshotPos, c.lastChunkPK, 42, c.mode, c.keys)
+		if ok != (c.lastPK != nil) {
+			t.Errorf("%s: resume %v", c.name, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if !reflect.DeepEqual(resume.lastPK, c.lastPK) {
+			t.Errorf("%s: lastPK %#v, want %#v", c.name, resume.lastPK, c.lastPK)
+		}
+		if resume.rows != 42 || resume.pos.Mode != c.mode || resume.pos.Marshal() == "" {
+			t.Errorf("%s: got rows %d, position %+v", c.name, resume.rows, resume.pos)
+		}
+	}
+	if _, ok := resumeState(nil, model.PosModeFile, keys); ok {
+		t.Error("table without meta should not resume")
+	}
+}
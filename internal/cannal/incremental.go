@@ -20,26 +20,42 @@ type IncrementalService interface {
 	Run()
 	Stop()
 	IsRunning() bool
+	// IncrementalSnapshot 不停止增量，按水位线分块补读表的全量数据
+	IncrementalSnapshot(schema, table string) error
 }
 
 type MySQLIncrementalEventHandler interface {
 	OnRow(e *rep.RowsEvent) error
-	OnDDL(e *rep.QueryEvent) error
+	OnDDL(e *rep.QueryEvent) (bool, error)
 	OnGTID(e *rep.GTIDEvent) error
+	OnMariadbGTID(e *rep.MariadbGTIDEvent) error
+	OnResume(start *model.Position) error
+	OnPosition(pos model.BinlogPos)
+	OnBegin() error
+	OnCommit() error
+	OnRollback()
 }
 
 type MySQLIncrementalService struct {
-	Cfg          *rep.BinlogSyncerConfig
-	Holder       *syncdb.DataSourceHolder
-	EventHandler MySQLIncrementalEventHandler
-	Running      bool
-	lock         sync.Mutex
-	LastGTID     *model.GTID
-	syncer       *rep.BinlogSyncer
-	streamer     *rep.BinlogStreamer
+	Cfg             *rep.BinlogSyncerConfig
+	Holder          *syncdb.DataSourceHolder
+	EventHandler    MySQLIncrementalEventHandler
+	Running         bool
+	lock            sync.Mutex
+	PosMode         string             // 位点类型 gtid/file/mariadb_gtid
+	LastGTID        *model.GTID        // 已提交的 GTID 集合，gtid 模式下的同步位点
+	LastMariadbGTID *model.MariadbGTID // 已提交的 MariaDB GTID，mariadb_gtid 模式下的同步位点
+	LastBinlogPos   *model.BinlogPos   // 最近提交事务的结束位置，file 模式下的同步位点
+	syncer          *rep.BinlogSyncer
+	streamer        *rep.BinlogStreamer
+	stopCh          chan struct{}
+	snapshots       *IncrementalSnapshotter // 增量快照，未配置信号表时为 nil
+
+	checkpointLock sync.Mutex
+	savedPos       string // 最近一次落库的位点，避免重复写入
 }
 
-func NewMySQLIncrementalService(holder *syncdb.DataSourceHolder) (IncrementalService, error) {
+func NewMySQLIncrementalService(holder *syncdb.DataSourceHolder, consumer IncrementalConsumer) (IncrementalService, error) {
 	source, ok := holder.Source.(*syncdb.MysqlDataSource)
 	if !ok {
 		log.Log.Error("Holder.Source is not *syncdb.MysqlDataSource", zap.Any("Holder", holder))
@@ -48,19 +64,38 @@ func NewMySQLIncrementalService(holder *syncdb.DataSourceHolder) (IncrementalSer
 	cfg := holder.Config
 	binlogCfg := &rep.BinlogSyncerConfig{
 		ServerID: holder.ID,
+		Flavor:   holder.Flavor(),
 		Host:     cfg.Host,
 		Port:     uint16(cfg.Port),
 		User:     cfg.User,
 		Password: cfg.Password,
 	}
+	if consumer == nil {
+		consumer = ConsoleIncrementalConsumer{}
+	}
 
+	impl := NewMySQLIncrementalImpl(holder, consumer)
+	filters, err := NewRowFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	impl.rowFilters = filters
+	rules, err := NewColumnRules(cfg)
+	if err != nil {
+		return nil, err
+	}
+	impl.columnRules = rules
 	service := &MySQLIncrementalService{
 		Cfg:          binlogCfg,
 		Holder:       holder,
-		EventHandler: &MySQLIncrementalImpl{Holder: holder},
-		LastGTID:     source.LastGTID,
+		EventHandler: impl,
+		PosMode:      source.PosMode,
 		Running:      false,
 		lock:         sync.Mutex{},
+		snapshots:    impl.snapshots,
+	}
+	if source.LastPos != nil {
+		service.setPosition(source.LastPos)
 	}
 
 	return service, nil
@@ -74,29 +109,62 @@ func (service *MySQLIncrementalService) Run() {
 		return
 	}
 	service.Running = true
+	service.stopCh = make(chan struct{})
 	service.lock.Unlock()
 	go service.init()
+	go service.checkpointLoop(service.stopCh)
+	if service.snapshots != nil {
+		go service.snapshots.run(service.stopCh)
+	}
 }
 
-// Stop 线程安全地停止服务并关闭 syncer
+// IncrementalSnapshot 登记表的增量快照，服务未运行时在下次启动后执行
+func (service *MySQLIncrementalService) IncrementalSnapshot(schema, table string) error {
+	if service.snapshots == nil {
+		return fmt.Errorf("signal_table of %s is not configured", service.Holder.Config.ID)
+	}
+	return service.snapshots.Enqueue(schema, table)
+}
+
+// Stop 线程安全地停止服务并关闭 syncer，最后持久化一次位点
 func (service *MySQLIncrementalService) Stop() {
 	service.lock.Lock()
-	defer service.lock.Unlock()
 	if !service.Running {
+		service.lock.Unlock()
 		return
 	}
 	service.Running = false
+	close(service.stopCh)
 	// 关闭 syncer 会使 GetEvent 返回 error
 	if service.syncer != nil {
 		service.syncer.Close()
 	}
+	service.lock.Unlock()
+	service.saveCheckpoint()
 }
 
 func (service *MySQLIncrementalService) IsRunning() bool {
+	service.lock.Lock()
+	defer service.lock.Unlock()
 	return service.Running
 }
 
+// exit 重试耗尽等原因自行退出时标记为停止，由 Supervisor 负责重启
+func (service *MySQLIncrementalService) exit() {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	if !service.Running {
+		return
+	}
+	service.Running = false
+	close(service.stopCh)
+	log.Log.Error("MySQLIncrementalService exited", zap.String("datasource", service.Holder.Config.ID))
+}
+
 func (service *MySQLIncrementalService) init() {
+	// 退出前补存一次，覆盖 Stop 之后才提交的事务
+	defer service.saveCheckpoint()
+	defer service.exit()
 	var backoff = 1 * time.Second
 	fallbackTimes := 0
 	allowFallback := func(err error) bool {
@@ -114,16 +182,17 @@ func (service *MySQLIncrementalService) init() {
 	}
 
 	for {
-		if !service.Running {
+		if !service.IsRunning() {
 			return
 		}
 
 		// new syncer per attempt
 		service.syncer = rep.NewBinlogSyncer(*service.Cfg)
 
-		// 如果没有GTID，allowFallback -> 从master pos开始
-		if service.LastGTID == nil || len(*service.LastGTID) == 0 {
-			snapshot, err := service.Holder.Source.BeginTransactionSnapshot()
+		// 如果没有位点，从 go_cdc_meta 恢复，从未同步过的数据源才从master pos开始
+		if service.lastPosition().IsEmpty() {
+			source := service.Holder.Source.(*syncdb.MysqlDataSource)
+			pos, err := syncdb.BinlogInitializer{}.Checkpoint(source.Db, service.Holder.Config, service.PosMode)
 			if err != nil {
 				if allowFallback(err) {
 					continue
@@ -131,22 +200,18 @@ func (service *MySQLIncrementalService) init() {
 					return
 				}
 			}
-			m := snapshot.Pos.(map[string][]string)
-			service.LastGTID = model.ParseGTID(m)
+			service.setPosition(pos)
 		}
 
-		// 构建 GTIDSet 字符串
-		str := service.LastGTID.String()
-
-		GTIDSet, err := mysql.ParseGTIDSet("mysql", str)
-		if err != nil {
+		if err := service.EventHandler.OnResume(service.lastPosition()); err != nil {
 			if allowFallback(err) {
 				continue
 			} else {
 				return
 			}
 		}
-		streamer, err := service.syncer.StartSyncGTID(GTIDSet)
+
+		streamer, err := service.startSync()
 		if err != nil {
 			if allowFallback(err) {
 				continue
@@ -166,8 +231,10 @@ func (service *MySQLIncrementalService) init() {
 		service.syncer.Close()
 		service.streamer = nil
 		service.syncer = nil
+		// 断线后从已提交位置重新拉取，未提交事务的缓冲直接丢弃
+		service.EventHandler.OnRollback()
 
-		if !service.Running {
+		if !service.IsRunning() {
 			return
 		}
 
@@ -177,6 +244,95 @@ func (service *MySQLIncrementalService) init() {
 	}
 }
 
+// startSync 按位点类型从已提交位置开始拉取 binlog
+func (service *MySQLIncrementalService) startSync() (*rep.BinlogStreamer, error) {
+	pos := service.lastPosition()
+	if pos.Mode == model.PosModeFile {
+		return service.syncer.StartSync(mysql.Position{Name: pos.BinlogPos.File, Pos: pos.BinlogPos.Pos})
+	}
+	if pos.Mode == model.PosModeMariaDB {
+		GTIDSet, err := mysql.ParseGTIDSet(mysql.MariaDBFlavor, pos.MariadbGTID.String())
+		if err != nil {
+			return nil, err
+		}
+		return service.syncer.StartSyncGTID(GTIDSet)
+	}
+	GTIDSet, err := mysql.ParseGTIDSet(mysql.MySQLFlavor, pos.GTID.String())
+	if err != nil {
+		return nil, err
+	}
+	return service.syncer.StartSyncGTID(GTIDSet)
+}
+
+// lastPosition 线程安全地获取已提交位点的副本
+func (service *MySQLIncrementalService) lastPosition() *model.Position {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	pos := &model.Position{Mode: service.PosMode}
+	if service.LastGTID != nil {
+		pos.GTID = service.LastGTID.Clone()
+	}
+	if service.LastMariadbGTID != nil {
+		pos.MariadbGTID = service.LastMariadbGTID.Clone()
+	}
+	if service.LastBinlogPos != nil {
+		binlogPos := *service.LastBinlogPos
+		pos.BinlogPos = &binlogPos
+	}
+	return pos
+}
+
+func (service *MySQLIncrementalService) setPosition(pos *model.Position) {
+	service.lock.Lock()
+	defer service.lock.Unlock()
+	if pos.GTID != nil {
+		service.LastGTID = pos.GTID.Clone()
+	}
+	if pos.MariadbGTID != nil {
+		service.LastMariadbGTID = pos.MariadbGTID.Clone()
+	}
+	if pos.BinlogPos != nil {
+		binlogPos := *pos.BinlogPos
+		service.LastBinlogPos = &binlogPos
+	}
+}
+
+// checkpointLoop 定期持久化已提交的位点，直到服务停止
+func (service *MySQLIncrementalService) checkpointLoop(stopCh <-chan struct{}) {
+	interval := time.Duration(service.Holder.Config.CheckpointInterval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			service.saveCheckpoint()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// saveCheckpoint 将已提交位点写回 go_cdc_meta，位点未变化时跳过
+func (service *MySQLIncrementalService) saveCheckpoint() {
+	pos := service.lastPosition()
+	if pos.IsEmpty() {
+		return
+	}
+
+	service.checkpointLock.Lock()
+	defer service.checkpointLock.Unlock()
+	str := pos.String()
+	if str == service.savedPos {
+		return
+	}
+	cfg := service.Holder.Config
+	model.GetTableMetaService().SavaOrUpdateCDCMeta(cfg.ID, cfg.Type, pos)
+	service.savedPos = str
+}
+
 func (service *MySQLIncrementalService) loop() {
 	defer func() {
 		if r := recover(); r != nil {
@@ -185,47 +341,122 @@ func (service *MySQLIncrementalService) loop() {
 	}()
 
 	ctx := context.Background()
-	for service.Running {
+	// 当前事务的 GTID，事务提交后才计入 LastGTID / LastMariadbGTID
+	var (
+		pendingUUID    string
+		pendingGNO     int64
+		pendingMariadb *model.MariadbGTIDItem
+	)
+	// 当前所在 binlog 文件，由 RotateEvent 维护
+	var file string
+	if pos := service.lastPosition(); pos.BinlogPos != nil {
+		file = pos.BinlogPos.File
+	}
+	commit := func(logPos uint32) {
+		service.lock.Lock()
+		defer service.lock.Unlock()
+		if file != "" && logPos > 0 {
+			service.LastBinlogPos = &model.BinlogPos{File: file, Pos: logPos}
+		}
+		if pendingMariadb != nil {
+			if service.LastMariadbGTID == nil {
+				service.LastMariadbGTID = &model.MariadbGTID{}
+			}
+			service.LastMariadbGTID.Update(pendingMariadb.DomainID, pendingMariadb.ServerID, pendingMariadb.SeqNo)
+			pendingMariadb = nil
+		}
+		if pendingUUID == "" {
+			return
+		}
+		if service.LastGTID == nil {
+			service.LastGTID = &model.GTID{}
+		}
+		service.LastGTID.SetGTID(pendingUUID, pendingGNO)
+		pendingUUID = ""
+	}
+	for service.IsRunning() {
 		ev, err := service.streamer.GetEvent(ctx)
 		if err != nil {
 			log.Log.Error("MySQLIncrementalService.loop: get event failed", zap.Error(err))
 			return
 		}
+		if e, ok := ev.Event.(*rep.RotateEvent); ok {
+			// 切换文件时不处于事务中，位点直接推进到新文件
+			file = string(e.NextLogName)
+			service.lock.Lock()
+			service.LastBinlogPos = &model.BinlogPos{File: file, Pos: uint32(e.Position)}
+			service.lock.Unlock()
+			continue
+		}
+		logPos := ev.Header.LogPos
+		service.EventHandler.OnPosition(model.BinlogPos{File: file, Pos: logPos})
+
 		switch e := ev.Event.(type) {
 		case *rep.GTIDEvent:
-			guuid := uuid.Must(uuid.FromBytes(e.SID[:])).String()
-			gno := e.GNO
-			service.lock.Lock()
-			if service.LastGTID == nil {
-				service.LastGTID = &model.GTID{}
+			// 以 GRANT、FLUSH、ANALYZE 等非 DDL 语句结束的事务没有经过 commit，在下一个事务开始时补记，避免位点集合出现空洞
+			if pendingUUID != "" || pendingMariadb != nil {
+				commit(logPos - ev.Header.EventSize)
 			}
-			service.LastGTID.SetGTID(guuid, gno)
-			service.lock.Unlock()
-			if service.EventHandler != nil {
-				if err := service.EventHandler.OnGTID(e); err != nil {
-					log.Log.Error("OnGTID handler error", zap.Error(err))
-				}
+			pendingUUID = uuid.Must(uuid.FromBytes(e.SID[:])).String()
+			pendingGNO = e.GNO
+			if err := service.EventHandler.OnGTID(e); err != nil {
+				log.Log.Error("OnGTID handler error", zap.Error(err))
+			}
+
+		case *rep.MariadbGTIDEvent:
+			// MariaDB 的 GTID 事件同时标志事务开始，没有单独的 BEGIN
+			if pendingUUID != "" || pendingMariadb != nil {
+				commit(logPos - ev.Header.EventSize)
+			}
+			pendingMariadb = &model.MariadbGTIDItem{
+				DomainID: e.GTID.DomainID,
+				ServerID: e.GTID.ServerID,
+				SeqNo:    e.GTID.SequenceNumber,
 			}
+			if err := service.EventHandler.OnMariadbGTID(e); err != nil {
+				log.Log.Error("OnMariadbGTID handler error", zap.Error(err))
+			}
+
+		case *rep.XIDEvent:
+			if err := service.EventHandler.OnCommit(); err != nil {
+				log.Log.Error("OnCommit handler error", zap.Error(err))
+				return
+			}
+			commit(logPos)
 
 		case *rep.QueryEvent:
 			q := string(e.Query)
 			up := strings.ToUpper(strings.TrimSpace(q))
-			if strings.HasPrefix(up, "CREATE") ||
-				strings.HasPrefix(up, "ALTER") ||
-				strings.HasPrefix(up, "DROP") ||
-				strings.HasPrefix(up, "RENAME") ||
-				strings.HasPrefix(up, "TRUNCATE") {
-				if service.EventHandler != nil {
-					if err := service.EventHandler.OnDDL(e); err != nil {
-						log.Log.Error("OnDDL handler error", zap.Error(err))
-					}
+			switch {
+			case up == "BEGIN":
+				if err := service.EventHandler.OnBegin(); err != nil {
+					log.Log.Error("OnBegin handler error", zap.Error(err))
+				}
+			case up == "COMMIT":
+				if err := service.EventHandler.OnCommit(); err != nil {
+					log.Log.Error("OnCommit handler error", zap.Error(err))
+					return
+				}
+				commit(logPos)
+			case up == "ROLLBACK":
+				service.EventHandler.OnRollback()
+			case strings.HasPrefix(up, "ROLLBACK"):
+				// ROLLBACK TO SAVEPOINT 回滚掉的行不会写入 binlog，事务仍在进行
+			default:
+				isDDL, err := service.EventHandler.OnDDL(e)
+				if err != nil {
+					log.Log.Error("OnDDL handler error", zap.Error(err))
+					return
+				}
+				// DDL 隐式提交，没有 XIDEvent
+				if isDDL {
+					commit(logPos)
 				}
 			}
 		case *rep.RowsEvent:
-			if service.EventHandler != nil {
-				if err := service.EventHandler.OnRow(e); err != nil {
-					log.Log.Error("OnRow handler error", zap.Error(err))
-				}
+			if err := service.EventHandler.OnRow(e); err != nil {
+				log.Log.Error("OnRow handler error", zap.Error(err))
+				return
 			}
 		}
 	}
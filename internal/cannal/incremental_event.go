@@ -1,38 +1,585 @@
 package cannal
 
 import (
+	"fmt"
 	"go-cdc/internal/log"
+	"go-cdc/internal/model"
 	"go-cdc/internal/syncdb"
+	"strconv"
+	"strings"
+	"time"
 
 	rep "github.com/go-mysql-org/go-mysql/replication"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// IncrementalConsumer 增量事件消费者，一次调用投递一批事件
+type IncrementalConsumer interface {
+	Consume(events []*model.Event) error
+}
+
+// TxConsumer 消费者可选实现的接口，增量事务按批投递时带上批次标记：first 为事务的第一批，last 为最后一批。
+// 溢写到磁盘的大事务分多批回放，各批的事件带有相同的事务位点，需要整个事务原子应用的消费者据此在最后一批时提交并记录位点；
+// 第一批到达时之前未收到最后一批的事务已中断，应丢弃。未实现时每批调用 Consume
+type TxConsumer interface {
+	ConsumeTx(events []*model.Event, first, last bool) error
+}
+
+// ConsoleIncrementalConsumer 增量事件控制台消费实现
+type ConsoleIncrementalConsumer struct{}
+
+func (cc ConsoleIncrementalConsumer) Consume(events []*model.Event) error {
+	for _, ev := range events {
+		log.Log.Info("Consume", zap.Any("event", ev))
+	}
+	return nil
+}
+
 type MySQLIncrementalImpl struct {
-	Holder *syncdb.DataSourceHolder
+	Holder         *syncdb.DataSourceHolder
+	Consumer       IncrementalConsumer
+	currentGTID    string                 // 当前事务的 GTID，格式 uuid:gno 或 MariaDB 的 domain-server-seq
+	currentUUID    string                 // 当前事务 GTID 的 server uuid
+	currentGNO     int64                  // 当前事务 GTID 的事务序号
+	currentMariadb *model.MariadbGTIDItem // 当前事务的 MariaDB GTID
+	currentPos     model.BinlogPos        // 当前事件的结束位置
+	txBuffer       *TxBuffer              // 当前事务未提交的行事件
+	ddlParser      *DDLParser
+	schemas        *SchemaTracker          // 当前 binlog 位置上的表结构
+	posMode        string                  // 增量起点的位点类型，DDL 版本按该类型记录位点
+	snapshots      *IncrementalSnapshotter // 增量快照，未配置信号表时为 nil
+	rowFilters     map[string]*RowFilter   // schema.table -> 行过滤条件
+	columnRules    map[string]*ColumnRule  // schema.table -> 列裁剪与脱敏规则
+
+	tablePositions map[string]*model.Position // schema.table -> 全量快照时的位点，nil 表示未做过全量
+}
+
+func NewMySQLIncrementalImpl(holder *syncdb.DataSourceHolder, consumer IncrementalConsumer) *MySQLIncrementalImpl {
+	return &MySQLIncrementalImpl{
+		Holder:         holder,
+		Consumer:       consumer,
+		txBuffer:       NewTxBuffer(holder.Config.TxBufferSize, holder.Config.TxSpillDir),
+		ddlParser:      NewDDLParser(),
+		schemas:        NewSchemaTracker(holder),
+		snapshots:      NewIncrementalSnapshotter(holder),
+		tablePositions: make(map[string]*model.Position),
+	}
 }
 
 func (impl *MySQLIncrementalImpl) OnRow(e *rep.RowsEvent) error {
 	table := string(e.Table.Table)
 	schema := string(e.Table.Schema)
-	rule := impl.Holder.Config.FilterRule
-	if rule == nil {
-		rule = impl.Holder.Config.ParseFilterConfig()
+	if impl.snapshots.IsSignal(schema, table) {
+		return impl.onSignal(e)
 	}
-	allow := rule.Allow(schema, table)
-	if !allow {
+	rule, err := impl.Holder.Config.Filter()
+	if err != nil {
+		return err
+	}
+	if !rule.Allow(schema, table) {
 		return nil
 	}
-	log.Log.Info("allow table", zap.String("schema", schema), zap.String("table", table),
-		zap.Any("data", e.Rows), zap.String("type", e.Type().String()))
-	return nil
+	pos, err := impl.tablePosition(schema, table)
+	if err != nil {
+		return err
+	}
+	// 全量快照已包含该事务的数据，丢弃避免重复
+	if impl.coveredBy(pos) {
+		return nil
+	}
+	ts, err := impl.schemas.Get(schema, table, impl.eventPosition())
+	if err != nil {
+		return err
+	}
+	events, err := impl.convertRowEvent(e, ts)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	// 先按行过滤条件裁剪，移出范围的行也需要从增量快照窗口的分块中剔除
+	events = impl.rowFilter(schema, table).Apply(events)
+	if len(events) == 0 {
+		return nil
+	}
+	impl.snapshots.Touch(schema, table, events)
+	if events, err = impl.columnRules[schema+"."+table].Apply(events); err != nil {
+		return err
+	}
+	return impl.txBuffer.Append(events...)
+}
+
+// rowFilter 表的行过滤条件，首次使用时从数据库读取引用列的排序规则，使字符串比较与全量的 SQL 一致
+func (impl *MySQLIncrementalImpl) rowFilter(schema, table string) *RowFilter {
+	f := impl.rowFilters[schema+"."+table]
+	if f == nil || f.HasCollations() {
+		return f
+	}
+	collations, err := impl.loadCollations(schema, table, f.Columns())
+	if err != nil {
+		log.Log.Warn("load collations of row filter columns failed, compare strings case-insensitively",
+			zap.String("schema", schema), zap.String("table", table), zap.Error(err))
+		collations = map[string]string{}
+	}
+	f.SetCollations(collations)
+	return f
 }
 
-func (impl *MySQLIncrementalImpl) OnDDL(e *rep.QueryEvent) error {
+func (impl *MySQLIncrementalImpl) loadCollations(schema, table string, columns []string) (map[string]string, error) {
+	tx, err := impl.Holder.Source.GetDataSourceTemplate().Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Commit()
+	}()
+	keys, err := impl.Holder.Source.GetKeyColumns(tx, schema, table, columns)
+	if err != nil {
+		return nil, err
+	}
+	collations := make(map[string]string, len(keys))
+	for _, k := range keys {
+		collations[k.Name] = k.Collation
+	}
+	return collations, nil
+}
+
+// onSignal 处理信号表的插入：水位线推进增量快照窗口，读到高水位时将分块行追加到当前事务随事务一起投递；
+// 其余行作为命令交给增量快照执行
+func (impl *MySQLIncrementalImpl) onSignal(e *rep.RowsEvent) error {
+	if e.Type() != rep.EnumRowsEventTypeInsert {
+		return nil
+	}
+	for _, row := range e.Rows {
+		// 信号表的列依次为 id、type、data
+		if len(row) < 2 {
+			continue
+		}
+		id, typ := signalValue(row[0]), signalValue(row[1])
+		if typ != signalWindowOpen && typ != signalWindowClose {
+			var data string
+			if len(row) > 2 {
+				data = signalValue(row[2])
+			}
+			impl.snapshots.Command(id, typ, data)
+			continue
+		}
+		chunk := impl.snapshots.Watermark(id, typ)
+		if chunk == nil {
+			continue
+		}
+		events, err := impl.chunkEvents(chunk)
+		if err != nil {
+			return err
+		}
+		if err := impl.txBuffer.Append(events...); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// chunkEvents 增量快照分块转换为事件，表的首个分块先下发建表 DDL
+func (impl *MySQLIncrementalImpl) chunkEvents(chunk *snapshotChunk) ([]*model.Event, error) {
+	ts := time.Now().Unix()
+	events := make([]*model.Event, 0, len(chunk.rows)+1)
+	if chunk.ddl != "" {
+		ddls, _, err := impl.ddlParser.Parse(chunk.ddl, chunk.schema)
+		if err != nil {
+			return nil, fmt.Errorf("parse ddl of %s.%s err: %w", chunk.schema, chunk.table, err)
+		}
+		for _, ddl := range ddls {
+			events = append(events, &model.Event{
+				DataSource: impl.Holder.Config.ID,
+				Schema:     ddl.Schema,
+				Table:      ddl.Table,
+				Op:         "ddl",
+				Ts:         ts,
+				Pos:        impl.position(),
+				DDL:        ddl,
+			})
+		}
+	}
+	keys := syncdb.KeyNames(chunk.keys)
+	for _, row := range chunk.rows {
+		events = append(events, &model.Event{
+			DataSource: impl.Holder.Config.ID,
+			Schema:     chunk.schema,
+			Table:      chunk.table,
+			Op:         model.OpRead,
+			Data:       row,
+			Ts:         ts,
+			Pos:        impl.position(),
+			Keys:       keys,
+		})
+	}
+	return impl.columnRules[chunk.schema+"."+chunk.table].Apply(events)
+}
+
+// OnDDL 解析 DDL 并直接投递下游（DDL 隐式提交，不经过事务缓冲），返回语句是否为 DDL。
+// 触发器、存储过程等不影响表结构的语句解析失败时跳过，表结构变更解析失败时返回错误
+func (impl *MySQLIncrementalImpl) OnDDL(e *rep.QueryEvent) (bool, error) {
+	query := string(e.Query)
+	ddls, isDDL, err := impl.ddlParser.Parse(query, string(e.Schema))
+	if err != nil {
+		// 无法解析的表结构变更会使结构缓存和下游与源库不一致，停止同步，位点停在该语句之前
+		if changesTable(query) {
+			return true, fmt.Errorf("parse ddl %s err: %w", query, err)
+		}
+		log.Log.Warn("parse ddl failed, skip", zap.String("query", query), zap.Error(err))
+		return looksLikeDDL(query), nil
+	}
+	// SAVEPOINT、XA、statement 格式的 DML 等可能出现在事务中间，不能丢弃已缓冲的行和增量快照窗口
+	if !isDDL {
+		return false, nil
+	}
+	impl.discard()
+	ts := time.Now().Unix()
+	events := make([]*model.Event, 0, len(ddls))
+	for _, ddl := range ddls {
+		allow, err := impl.allowDDL(ddl)
+		if err != nil {
+			return isDDL, err
+		}
+		if !allow {
+			continue
+		}
+		// 列的排序规则可能被修改，下次过滤前重新读取
+		if f := impl.rowFilters[ddl.Schema+"."+ddl.Table]; f != nil {
+			f.SetCollations(nil)
+		}
+		if err := impl.schemas.Apply(ddl, impl.eventPosition()); err != nil {
+			// 结构无法推导时丢弃该表的结构缓存，下次读取时以数据库当前结构为准
+			log.Log.Warn("apply ddl to schema history failed", zap.String("query", query), zap.Error(err))
+			impl.schemas.Forget(ddl.Schema, ddl.Table)
+		}
+		if ddl, err = impl.columnRules[ddl.Schema+"."+ddl.Table].ApplyDDL(ddl); err != nil {
+			return isDDL, err
+		}
+		if ddl == nil {
+			continue
+		}
+		events = append(events, &model.Event{
+			DataSource: impl.Holder.Config.ID,
+			Schema:     ddl.Schema,
+			Table:      ddl.Table,
+			Op:         "ddl",
+			Ts:         ts,
+			Pos:        impl.position(),
+			DDL:        ddl,
+		})
+	}
+	if len(events) == 0 {
+		return isDDL, nil
+	}
+	return isDDL, impl.Consumer.Consume(events)
+}
+
+// allowDDL 按过滤规则判断是否下发 DDL，rename 的源表或目标表任一命中即下发，
+// 已包含在表快照中的 DDL 不再下发
+func (impl *MySQLIncrementalImpl) allowDDL(ddl *model.DDLEvent) (bool, error) {
+	if impl.snapshots.IsSignal(ddl.Schema, ddl.Table) {
+		return false, nil
+	}
+	rule, err := impl.Holder.Config.Filter()
+	if err != nil {
+		return false, err
+	}
+	if ddl.Table == "" {
+		return rule.Allow(ddl.Schema, ""), nil
+	}
+	allow := rule.Allow(ddl.Schema, ddl.Table)
+	if !allow && ddl.NewTable != "" {
+		allow = rule.Allow(ddl.NewSchema, ddl.NewTable)
+	}
+	if !allow {
+		return false, nil
+	}
+	pos, err := impl.tablePosition(ddl.Schema, ddl.Table)
+	if err != nil {
+		return false, err
+	}
+	return !impl.coveredBy(pos), nil
+}
+
 func (impl *MySQLIncrementalImpl) OnGTID(e *rep.GTIDEvent) error {
+	guuid := uuid.Must(uuid.FromBytes(e.SID[:])).String()
+	impl.currentUUID = guuid
+	impl.currentGNO = e.GNO
+	impl.currentGTID = guuid + ":" + strconv.FormatInt(e.GNO, 10)
+	// 新事务开始，上一个事务若未提交则已不完整
+	impl.discard()
+	return nil
+}
 
+func (impl *MySQLIncrementalImpl) OnMariadbGTID(e *rep.MariadbGTIDEvent) error {
+	impl.currentMariadb = &model.MariadbGTIDItem{
+		DomainID: e.GTID.DomainID,
+		ServerID: e.GTID.ServerID,
+		SeqNo:    e.GTID.SequenceNumber,
+	}
+	impl.currentGTID = impl.currentMariadb.String()
+	impl.discard()
+	return nil
+}
+
+func (impl *MySQLIncrementalImpl) OnBegin() error {
+	impl.discard()
+	return nil
+}
+
+// OnCommit 事务提交（XIDEvent 或 COMMIT 语句），按顺序将整个事务投递下游
+func (impl *MySQLIncrementalImpl) OnCommit() error {
+	if impl.txBuffer.Len() > 0 {
+		if err := impl.txBuffer.Flush(impl.consumeTx); err != nil {
+			return err
+		}
+	}
+	// 高水位所在事务投递后分块才算完成
+	impl.snapshots.Committed()
 	return nil
 }
+
+// consumeTx 按批投递事务，消费者实现 TxConsumer 时带上批次标记
+func (impl *MySQLIncrementalImpl) consumeTx(events []*model.Event, first, last bool) error {
+	if c, ok := impl.Consumer.(TxConsumer); ok {
+		return c.ConsumeTx(events, first, last)
+	}
+	return impl.Consumer.Consume(events)
+}
+
+func (impl *MySQLIncrementalImpl) OnRollback() {
+	impl.discard()
+}
+
+// OnResume 每次(重新)连接前按起点重新加载表结构
+func (impl *MySQLIncrementalImpl) OnResume(start *model.Position) error {
+	impl.posMode = start.Mode
+	impl.tablePositions = make(map[string]*model.Position)
+	impl.snapshots.Reset()
+	return impl.schemas.Reset(start)
+}
+
+func (impl *MySQLIncrementalImpl) OnPosition(pos model.BinlogPos) {
+	impl.currentPos = pos
+}
+
+// tablePosition 从 go_cdc_table_meta 加载并缓存表的全量快照位点
+func (impl *MySQLIncrementalImpl) tablePosition(schema, table string) (*model.Position, error) {
+	key := schema + "." + table
+	if pos, ok := impl.tablePositions[key]; ok {
+		return pos, nil
+	}
+	meta, err := model.GetTableMetaService().GetTableMeta(impl.Holder.Config.ID, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("load table meta %s err: %w", key, err)
+	}
+	var pos *model.Position
+	if meta != nil {
+		if pos, err = model.ParsePosition(meta.PosMode, meta.LastPos); err != nil {
+			return nil, err
+		}
+	}
+	impl.tablePositions[key] = pos
+	return pos, nil
+}
+
+// coveredBy 当前事务是否已包含在表快照位点中
+func (impl *MySQLIncrementalImpl) coveredBy(pos *model.Position) bool {
+	if pos.IsEmpty() {
+		return false
+	}
+	switch pos.Mode {
+	case model.PosModeFile:
+		return impl.currentPos.Compare(*pos.BinlogPos) <= 0
+	case model.PosModeMariaDB:
+		return impl.currentMariadb != nil && pos.MariadbGTID.Contains(impl.currentMariadb.DomainID, impl.currentMariadb.SeqNo)
+	}
+	return pos.GTID.Contains(impl.currentUUID, impl.currentGNO)
+}
+
+func (impl *MySQLIncrementalImpl) discard() {
+	if n := impl.txBuffer.Len(); n > 0 {
+		log.Log.Warn("discard uncommitted transaction", zap.String("gtid", impl.currentGTID), zap.Int("events", n))
+	}
+	impl.txBuffer.Reset()
+	impl.snapshots.Discard()
+}
+
+// position 事件位点，gtid 模式为事务 GTID，file 模式为 file:pos
+func (impl *MySQLIncrementalImpl) position() string {
+	if impl.currentGTID != "" {
+		return impl.currentGTID
+	}
+	return impl.currentPos.String()
+}
+
+// eventPosition 当前事务的位点，用于记录表结构版本
+func (impl *MySQLIncrementalImpl) eventPosition() *model.Position {
+	switch impl.posMode {
+	case model.PosModeFile:
+		return model.NewFilePosition(impl.currentPos)
+	case model.PosModeMariaDB:
+		gtid := model.MariadbGTID{}
+		if impl.currentMariadb != nil {
+			gtid.Update(impl.currentMariadb.DomainID, impl.currentMariadb.ServerID, impl.currentMariadb.SeqNo)
+		}
+		return model.NewMariadbPosition(&gtid)
+	}
+	gtid := model.GTID{}
+	if impl.currentUUID != "" {
+		gtid.SetGTID(impl.currentUUID, impl.currentGNO)
+	}
+	return model.NewGTIDPosition(&gtid)
+}
+
+// convertRowEvent 将 RowsEvent 中的每一行转换为 model.Event，update 事件的前后镜像成对出现
+func (impl *MySQLIncrementalImpl) convertRowEvent(e *rep.RowsEvent, schema *model.TableSchema) ([]*model.Event, error) {
+	events := make([]*model.Event, 0, len(e.Rows))
+	ts := time.Now().Unix()
+	// 没有主键的表由下游按完整的前镜像定位行，要求 binlog_row_image=FULL
+	var keys []string
+	if schema != nil && len(schema.PrimaryKey) > 0 {
+		keys = schema.PrimaryKey
+	}
+	for i := 0; i < len(e.Rows); i++ {
+		data := getRowData(e, schema, e.Rows[i])
+		ev := &model.Event{
+			DataSource: impl.Holder.Config.ID,
+			Schema:     string(e.Table.Schema),
+			Table:      string(e.Table.Table),
+			Ts:         ts,
+			Pos:        impl.position(),
+			Keys:       keys,
+		}
+		switch e.Type() {
+		case rep.EnumRowsEventTypeInsert:
+			ev.Op = "insert"
+			ev.Data = data
+		case rep.EnumRowsEventTypeUpdate:
+			ev.Op = "update"
+			ev.Before = data
+			i++
+			if i >= len(e.Rows) {
+				return nil, fmt.Errorf("update rows incomplete, missing after row")
+			}
+			ev.Data = getRowData(e, schema, e.Rows[i])
+		case rep.EnumRowsEventTypeDelete:
+			ev.Op = "delete"
+			ev.Before = data
+		default:
+			return nil, fmt.Errorf("unknown event type: %v", e.Type())
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// getRowData 按列名组装行数据，列名优先取 binlog_row_metadata=FULL 时 binlog 自带的列名，
+// 否则取 binlog 位置上的表结构，两者都对不上时以列序号代替
+func getRowData(e *rep.RowsEvent, schema *model.TableSchema, row []interface{}) map[string]interface{} {
+	names := e.Table.ColumnNameString()
+	var columns []*model.ColumnDef
+	if schema != nil && len(schema.Columns) == int(e.Table.ColumnCount) {
+		columns = schema.Columns
+	}
+	data := make(map[string]interface{}, len(row))
+	for idx, value := range row {
+		name := fmt.Sprintf("@%d", idx+1)
+		if idx < len(names) && names[idx] != "" {
+			name = names[idx]
+		} else if columns != nil {
+			name = columns[idx].Name
+		}
+		if columns != nil {
+			value = toEnumLabel(columns[idx].Type, toUnsigned(columns[idx].Type, value))
+		}
+		if b, ok := value.([]byte); ok {
+			data[name] = string(b)
+		} else {
+			data[name] = value
+		}
+	}
+	return data
+}
+
+// toEnumLabel binlog 中 enum 为取值的序号、set 为位图，按列定义还原为取值，与全量读取的结果一致
+func toEnumLabel(typ string, value interface{}) interface{} {
+	isEnum := strings.HasPrefix(typ, "enum(")
+	if !isEnum && !strings.HasPrefix(typ, "set(") {
+		return value
+	}
+	n, ok := value.(int64)
+	if !ok {
+		return value
+	}
+	elems := enumElems(typ)
+	if isEnum {
+		// 序号 0 为写入非法值时的空串
+		if n <= 0 || int(n) > len(elems) {
+			return ""
+		}
+		return elems[n-1]
+	}
+	labels := make([]string, 0, len(elems))
+	for i, elem := range elems {
+		if n&(1<<i) != 0 {
+			labels = append(labels, elem)
+		}
+	}
+	return strings.Join(labels, ",")
+}
+
+// enumElems 解析 enum('a','b') / set('a','b') 中的取值，引号内连续两个单引号表示一个单引号
+func enumElems(typ string) []string {
+	start, end := strings.IndexByte(typ, '('), strings.LastIndexByte(typ, ')')
+	if start < 0 || end <= start {
+		return nil
+	}
+	var elems []string
+	var sb strings.Builder
+	quoted := false
+	body := typ[start+1 : end]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case !quoted:
+			if c == '\'' {
+				quoted = true
+				sb.Reset()
+			}
+		case c == '\'' && i+1 < len(body) && body[i+1] == '\'':
+			i++
+			sb.WriteByte(c)
+		case c == '\'':
+			quoted = false
+			elems = append(elems, sb.String())
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return elems
+}
+
+// toUnsigned binlog 中的整数按有符号解码，unsigned 列的负值需按位宽还原
+func toUnsigned(typ string, value interface{}) interface{} {
+	if !strings.Contains(typ, "unsigned") {
+		return value
+	}
+	switch v := value.(type) {
+	case int8:
+		return uint8(v)
+	case int16:
+		return uint16(v)
+	case int32:
+		if v < 0 && strings.HasPrefix(typ, "mediumint") {
+			return uint32(v + 1<<24)
+		}
+		return uint32(v)
+	case int64:
+		return uint64(v)
+	}
+	return value
+}
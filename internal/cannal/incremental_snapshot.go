@@ -0,0 +1,647 @@
+package cannal
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+	"go-cdc/pkg/config"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultIncrementalChunk = 1024                // 默认每个水位线窗口读取的行数
+	signalRetention         = 30 * 24 * time.Hour // 已执行命令的记录保留时长，超过 binlog 保留时长后不会再被重放
+
+	signalWindowOpen  = "snapshot-window-open"  // 低水位
+	signalWindowClose = "snapshot-window-close" // 高水位
+)
+
+// 信号表支持的命令，data 为 {"data-collections": ["schema.table"]}，暂停、恢复、停止未指定表时作用于所有增量快照。
+// 通过 cdc signal datasource type schema.table 发送，或直接在源库执行
+// INSERT INTO 信号表 (id, type, data) VALUES (唯一 id, 命令, data)。
+// 同一 id 的命令只执行一次，重启后从较早的位点重放的 execute-snapshot 不会重置已有进度
+const (
+	SignalExecuteSnapshot = "execute-snapshot" // 增量快照指定的表，进行中的表从头开始
+	SignalPauseSnapshot   = "pause-snapshot"   // 暂停增量快照
+	SignalResumeSnapshot  = "resume-snapshot"  // 从暂停处继续增量快照
+	SignalStopSnapshot    = "stop-snapshot"    // 取消增量快照
+)
+
+// signalData 信号表 data 列的内容
+type signalData struct {
+	DataCollections []string `json:"data-collections"`
+	Type            string   `json:"type"` // 只支持 incremental
+}
+
+var (
+	errWindowAborted   = errors.New("snapshot window aborted")
+	errSnapshotStopped = errors.New("incremental snapshot stopped")
+)
+
+// IncrementalSnapshotter 按 DBLog 水位线算法在增量同步运行中分块读取表：
+// 向信号表写入低水位 -> 读取分块 -> 写入高水位，binlog 中两个水位之间出现过的行以 binlog 为准从分块中剔除，
+// 读到高水位时将分块剩余的行作为 read 事件插入事件流，因此补数据不需要停止增量
+type IncrementalSnapshotter struct {
+	holder       *syncdb.DataSourceHolder
+	signalSchema string
+	signalTable  string
+	chunkSize    int
+
+	lock   sync.Mutex
+	queue  []string // 等待快照的 schema.table
+	wake   chan struct{}
+	window *snapshotWindow // 当前分块的水位线窗口
+}
+
+// snapshotWindow 一个分块的水位线窗口，由读取协程创建，binlog 协程推进
+type snapshotWindow struct {
+	id      string
+	schema  string
+	table   string
+	keys    []*syncdb.KeyColumn
+	ddl     string                   // 表的首个分块携带建表语句，先于数据下发
+	rows    []map[string]interface{} // 分块读取的行
+	lastPK  []interface{}            // 分块最后一行的键
+	open    bool                     // binlog 已读到低水位
+	touched map[string]bool          // 窗口内 binlog 中出现过的键
+	closing bool                     // binlog 已读到高水位，分块随该事务投递
+	done    chan struct{}            // 分块已被消费
+	abort   chan struct{}            // 增量重连或事务被丢弃，需要重读分块
+}
+
+// snapshotChunk 读到高水位时需要插入事件流的分块
+type snapshotChunk struct {
+	schema string
+	table  string
+	keys   []*syncdb.KeyColumn
+	ddl    string
+	rows   []map[string]interface{}
+}
+
+// NewIncrementalSnapshotter 未配置信号表时返回 nil
+func NewIncrementalSnapshotter(holder *syncdb.DataSourceHolder) *IncrementalSnapshotter {
+	schema, table := holder.Config.SignalTableName()
+	if table == "" {
+		return nil
+	}
+	chunkSize := holder.Config.IncrementalChunk
+	if chunkSize <= 0 {
+		chunkSize = defaultIncrementalChunk
+	}
+	return &IncrementalSnapshotter{
+		holder:       holder,
+		signalSchema: schema,
+		signalTable:  table,
+		chunkSize:    chunkSize,
+		wake:         make(chan struct{}, 1),
+	}
+}
+
+// Enqueue 登记表的增量快照并排队，表已在队列中时只重置进度
+func (s *IncrementalSnapshotter) Enqueue(schema, table string) error {
+	if s.IsSignal(schema, table) {
+		return fmt.Errorf("can not snapshot signal table %s.%s", schema, table)
+	}
+	rule, err := s.holder.Config.Filter()
+	if err != nil {
+		return err
+	}
+	if !rule.Allow(schema, table) {
+		return fmt.Errorf("table %s.%s is not allowed by filter", schema, table)
+	}
+	if err := model.GetTableMetaService().StartIncrementalSnapshot(s.holder.Config.ID, schema, table); err != nil {
+		return err
+	}
+	s.push(schema + "." + table)
+	log.Log.Info("incremental snapshot queued", zap.String("datasource", s.holder.Config.ID),
+		zap.String("schema", schema), zap.String("table", table))
+	return nil
+}
+
+func (s *IncrementalSnapshotter) push(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, k := range s.queue {
+		if k == key {
+			return
+		}
+	}
+	s.queue = append(s.queue, key)
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *IncrementalSnapshotter) remove(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, k := range s.queue {
+		if k == key {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *IncrementalSnapshotter) pop() (string, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.queue) == 0 {
+		return "", false
+	}
+	key := s.queue[0]
+	s.queue = s.queue[1:]
+	return key, true
+}
+
+// run 依次处理队列中的表，随增量服务启动和停止
+func (s *IncrementalSnapshotter) run(stopCh <-chan struct{}) {
+	if err := s.ensureSignalTable(); err != nil {
+		log.Log.Warn("create signal table failed", zap.String("datasource", s.holder.Config.ID), zap.Error(err))
+	}
+	if err := model.GetTableMetaService().PruneSignals(s.holder.Config.ID, time.Now().Add(-signalRetention)); err != nil {
+		log.Log.Warn("prune handled signals failed", zap.String("datasource", s.holder.Config.ID), zap.Error(err))
+	}
+	// 继续上次未完成的增量快照
+	list, err := model.GetTableMetaService().ListIncrementalSnapshots(s.holder.Config.ID, model.SnapshotPending, model.SnapshotRunning)
+	if err != nil {
+		log.Log.Error("load incremental snapshots failed", zap.String("datasource", s.holder.Config.ID), zap.Error(err))
+	}
+	for _, meta := range list {
+		s.push(meta.Sc + "." + meta.Tb)
+	}
+	for {
+		key, ok := s.pop()
+		if !ok {
+			select {
+			case <-stopCh:
+				return
+			case <-s.wake:
+				continue
+			}
+		}
+		sc, tb, _ := strings.Cut(key, ".")
+		err := s.snapshotTable(sc, tb, stopCh)
+		if errors.Is(err, errSnapshotStopped) {
+			return
+		}
+		if err != nil {
+			log.Log.Error("incremental snapshot failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			_ = model.GetTableMetaService().SetTableSnapshotStatus(s.holder.Config.ID, sc, tb, model.SnapshotFailed)
+		}
+	}
+}
+
+// snapshotTable 从上次已投递的分块之后逐个窗口读取表，直到读完
+func (s *IncrementalSnapshotter) snapshotTable(sc, tb string, stopCh <-chan struct{}) error {
+	service := model.GetTableMetaService()
+	id := s.holder.Config.ID
+	meta, err := service.GetTableMeta(id, sc, tb)
+	if err != nil {
+		return err
+	}
+	// 排队期间已被暂停、取消或已完成
+	if meta == nil || (meta.SnapshotStatus != model.SnapshotPending && meta.SnapshotStatus != model.SnapshotRunning) {
+		return nil
+	}
+	keys, ddl, err := s.prepare(sc, tb)
+	if err != nil {
+		return err
+	}
+	filter, err := rowFilterSQL(s.holder.Config, sc, tb)
+	if err != nil {
+		return err
+	}
+	var lastPK []interface{}
+	var rowsCopied int64
+	if meta != nil && meta.SnapshotStatus == model.SnapshotRunning && meta.LastChunkPK != "" && meta.LastChunkPK != "null" {
+		if lastPK, err = syncdb.DecodeKey(keys, meta.LastChunkPK); err != nil {
+			log.Log.Warn("discard incremental snapshot progress", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			lastPK = nil
+		} else {
+			rowsCopied = meta.RowsCopied
+			// 建表语句已随首个分块下发
+			ddl = ""
+		}
+	}
+	if err := service.SetTableSnapshotStatus(id, sc, tb, model.SnapshotRunning); err != nil {
+		return err
+	}
+	log.Log.Info("incremental snapshot started", zap.String("schema", sc), zap.String("table", tb), zap.Int64("rows", rowsCopied))
+	for {
+		ok, err := s.proceed(sc, tb, stopCh)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		w, err := s.runWindow(sc, tb, keys, filter, ddl, lastPK, stopCh)
+		if errors.Is(err, errWindowAborted) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ddl = ""
+		if len(w.rows) > 0 {
+			lastPK = w.lastPK
+			rowsCopied += int64(len(w.rows))
+			pk, err := syncdb.EncodeKey(keys, lastPK)
+			if err != nil {
+				return err
+			}
+			if err := service.SaveSnapshotChunk(id, sc, tb, pk, rowsCopied); err != nil {
+				return err
+			}
+		}
+		if len(w.rows) < s.chunkSize {
+			break
+		}
+	}
+	log.Log.Info("incremental snapshot finished", zap.String("schema", sc), zap.String("table", tb), zap.Int64("rows", rowsCopied))
+	return service.FinishIncrementalSnapshot(id, sc, tb)
+}
+
+// proceed 每个窗口之前检查命令修改的表状态，暂停时等待恢复，取消或重新执行时返回 false
+func (s *IncrementalSnapshotter) proceed(sc, tb string, stopCh <-chan struct{}) (bool, error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	paused := false
+	for {
+		meta, err := model.GetTableMetaService().GetTableMeta(s.holder.Config.ID, sc, tb)
+		if err != nil {
+			return false, err
+		}
+		if meta == nil {
+			return false, nil
+		}
+		switch meta.SnapshotStatus {
+		case model.SnapshotRunning:
+			if paused {
+				log.Log.Info("incremental snapshot resumed", zap.String("schema", sc), zap.String("table", tb))
+			}
+			return true, nil
+		case model.SnapshotPaused:
+			if !paused {
+				paused = true
+				log.Log.Info("incremental snapshot paused", zap.String("schema", sc), zap.String("table", tb))
+			}
+		default:
+			// 取消或被重新执行（已重新排队）
+			log.Log.Info("incremental snapshot interrupted", zap.String("schema", sc), zap.String("table", tb),
+				zap.String("status", meta.SnapshotStatus))
+			return false, nil
+		}
+		select {
+		case <-stopCh:
+			return false, errSnapshotStopped
+		case <-ticker.C:
+		}
+	}
+}
+
+// prepare 获取分页键和建表语句，没有可分页的键的表不能按窗口读取
+func (s *IncrementalSnapshotter) prepare(sc, tb string) ([]*syncdb.KeyColumn, string, error) {
+	tx, err := s.holder.Source.GetDataSourceTemplate().BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		_ = tx.Commit()
+	}()
+	keys, err := SnapshotReader{}.chunkKeys(*s.holder, tx, sc, tb)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(keys) == 0 {
+		return nil, "", fmt.Errorf("table %s.%s has no usable key for incremental snapshot", sc, tb)
+	}
+	ddl, err := s.holder.Source.GetTableDDL(tx, sc, tb)
+	if err != nil {
+		return nil, "", err
+	}
+	return keys, ddl, nil
+}
+
+// runWindow 低水位、读取分块、高水位，等待 binlog 协程投递分块
+func (s *IncrementalSnapshotter) runWindow(sc, tb string, keys []*syncdb.KeyColumn, filter, ddl string, lastPK []interface{}, stopCh <-chan struct{}) (*snapshotWindow, error) {
+	w := &snapshotWindow{
+		id:     uuid.NewString(),
+		schema: sc,
+		table:  tb,
+		keys:   keys,
+		ddl:    ddl,
+		done:   make(chan struct{}),
+		abort:  make(chan struct{}),
+	}
+	s.lock.Lock()
+	s.window = w
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		if s.window == w {
+			s.window = nil
+		}
+		s.lock.Unlock()
+	}()
+
+	if err := s.signal(w.id, signalWindowOpen, sc+"."+tb); err != nil {
+		return nil, err
+	}
+	rows, newPK, err := s.readChunk(sc, tb, keys, filter, lastPK)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	w.rows, w.lastPK = rows, newPK
+	s.lock.Unlock()
+	if err := s.signal(w.id, signalWindowClose, sc+"."+tb); err != nil {
+		return nil, err
+	}
+	select {
+	case <-w.done:
+		return w, nil
+	case <-w.abort:
+		return nil, errWindowAborted
+	case <-stopCh:
+		return nil, errSnapshotStopped
+	}
+}
+
+// readChunk 行过滤条件随查询下推，过滤后的分块仍按键连续，不足 chunkSize 行即表示读完
+func (s *IncrementalSnapshotter) readChunk(sc, tb string, keys []*syncdb.KeyColumn, filter string, lastPK []interface{}) ([]map[string]interface{}, []interface{}, error) {
+	tx, err := s.holder.Source.GetDataSourceTemplate().BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		_ = tx.Commit()
+	}()
+	return s.holder.Source.FetchTableChunk(tx, sc, tb, keys, lastPK, filter, s.chunkSize)
+}
+
+// signal 向信号表写入一行，写入的事务会出现在 binlog 中
+func (s *IncrementalSnapshotter) signal(id, typ, data string) error {
+	return insertSignal(s.holder.Source.GetDataSourceTemplate(), s.signalSchema, s.signalTable, id, typ, data)
+}
+
+func insertSignal(db *sql.DB, schema, table, id, typ, data string) error {
+	query := fmt.Sprintf("INSERT INTO `%s`.`%s` (id, type, data) VALUES (?, ?, ?)", schema, table)
+	_, err := db.Exec(query, id, typ, data)
+	return err
+}
+
+func (s *IncrementalSnapshotter) ensureSignalTable() error {
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s`.`%s` ("+
+		"id varchar(64) NOT NULL PRIMARY KEY, type varchar(32) NOT NULL, data varchar(2048) NULL)",
+		s.signalSchema, s.signalTable)
+	_, err := s.holder.Source.GetDataSourceTemplate().Exec(query)
+	return err
+}
+
+// Command 执行信号表中的命令，命令只修改表元数据中的快照状态，由读取协程在窗口之间响应。
+// 执行过的命令 ID 记录在元数据库中，增量重连或重启后从较早的位点重放的命令不再执行
+func (s *IncrementalSnapshotter) Command(id, typ, data string) {
+	if s == nil {
+		return
+	}
+	payload, err := parseSignal(data)
+	if err != nil {
+		log.Log.Warn("invalid signal data, skip", zap.String("id", id), zap.String("type", typ), zap.String("data", data), zap.Error(err))
+		return
+	}
+	first, err := model.GetTableMetaService().MarkSignalHandled(s.holder.Config.ID, id, typ)
+	if err != nil {
+		// 记录失败时仍执行命令，重放时可能再次执行
+		log.Log.Error("save handled signal failed", zap.String("id", id), zap.String("type", typ), zap.Error(err))
+	} else if !first {
+		log.Log.Info("signal already handled, skip", zap.String("id", id), zap.String("type", typ))
+		return
+	}
+	log.Log.Info("signal received", zap.String("id", id), zap.String("type", typ), zap.Strings("tables", payload.DataCollections))
+	switch typ {
+	case SignalExecuteSnapshot:
+		for _, name := range payload.DataCollections {
+			sc, tb, ok := strings.Cut(name, ".")
+			if !ok {
+				log.Log.Warn("data collection should be schema.table", zap.String("name", name))
+				continue
+			}
+			if err := s.Enqueue(sc, tb); err != nil {
+				log.Log.Warn("execute snapshot failed", zap.String("name", name), zap.Error(err))
+			}
+		}
+	case SignalPauseSnapshot:
+		s.transit(payload.DataCollections, model.SnapshotPaused, model.SnapshotPending, model.SnapshotRunning)
+	case SignalResumeSnapshot:
+		// 重启后暂停的表不在队列中，恢复时重新排队
+		for _, meta := range s.transit(payload.DataCollections, model.SnapshotRunning, model.SnapshotPaused) {
+			s.push(meta.Sc + "." + meta.Tb)
+		}
+	case SignalStopSnapshot:
+		for _, meta := range s.transit(payload.DataCollections, model.SnapshotStopped, model.SnapshotPending, model.SnapshotRunning, model.SnapshotPaused) {
+			s.remove(meta.Sc + "." + meta.Tb)
+		}
+	default:
+		log.Log.Warn("unknown signal type, skip", zap.String("id", id), zap.String("type", typ))
+	}
+}
+
+// parseSignal 解析命令的 data 列，data 为空时作用于所有表，只支持增量快照
+func parseSignal(data string) (*signalData, error) {
+	payload := &signalData{}
+	if strings.TrimSpace(data) != "" {
+		if err := json.Unmarshal([]byte(data), payload); err != nil {
+			return nil, err
+		}
+	}
+	if payload.Type != "" && !strings.EqualFold(payload.Type, "incremental") {
+		return nil, fmt.Errorf("unsupported snapshot type %q", payload.Type)
+	}
+	return payload, nil
+}
+
+// transit 将处于 from 状态的增量快照改为 to 状态，collections 为空时作用于所有表，返回被修改的表
+func (s *IncrementalSnapshotter) transit(collections []string, to string, from ...string) []*model.TableMeta {
+	service := model.GetTableMetaService()
+	list, err := service.ListIncrementalSnapshots(s.holder.Config.ID, from...)
+	if err != nil {
+		log.Log.Error("load incremental snapshots failed", zap.String("datasource", s.holder.Config.ID), zap.Error(err))
+		return nil
+	}
+	changed := make([]*model.TableMeta, 0, len(list))
+	for _, meta := range list {
+		if len(collections) > 0 && !slices.Contains(collections, meta.Sc+"."+meta.Tb) {
+			continue
+		}
+		if err := service.SetTableSnapshotStatus(s.holder.Config.ID, meta.Sc, meta.Tb, to); err != nil {
+			continue
+		}
+		changed = append(changed, meta)
+	}
+	return changed
+}
+
+// SendSignal 向数据源的信号表写入命令，运行中的增量服务经 binlog 读到后执行，与数据变更保持顺序。
+// 只依赖源库连接，可以在增量服务之外的进程中调用（cdc signal）
+func SendSignal(db *sql.DB, cfg *config.DataSourceConfig, typ string, collections ...string) error {
+	schema, table := cfg.SignalTableName()
+	if table == "" {
+		return fmt.Errorf("signal_table of %s is not configured", cfg.ID)
+	}
+	switch typ {
+	case SignalExecuteSnapshot, SignalPauseSnapshot, SignalResumeSnapshot, SignalStopSnapshot:
+	default:
+		return fmt.Errorf("unknown signal type %q", typ)
+	}
+	if typ == SignalExecuteSnapshot && len(collections) == 0 {
+		return errors.New("execute-snapshot requires at least one schema.table")
+	}
+	data, err := json.Marshal(signalData{DataCollections: collections, Type: "incremental"})
+	if err != nil {
+		return err
+	}
+	return insertSignal(db, schema, table, uuid.NewString(), typ, string(data))
+}
+
+// IsSignal 是否为信号表，信号表的行不投递下游
+func (s *IncrementalSnapshotter) IsSignal(schema, table string) bool {
+	return s != nil && schema == s.signalSchema && table == s.signalTable
+}
+
+// Watermark binlog 读到信号表中当前窗口的水位线，读到高水位时返回剔除窗口内变更后的分块
+func (s *IncrementalSnapshotter) Watermark(id, typ string) *snapshotChunk {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w := s.window
+	if w == nil || w.id != id {
+		return nil
+	}
+	switch typ {
+	case signalWindowOpen:
+		w.open = true
+		w.touched = make(map[string]bool)
+	case signalWindowClose:
+		if !w.open {
+			return nil
+		}
+		w.open = false
+		w.closing = true
+		rows := make([]map[string]interface{}, 0, len(w.rows))
+		for _, row := range w.rows {
+			if !w.touched[rowKey(w.keys, row)] {
+				rows = append(rows, row)
+			}
+		}
+		return &snapshotChunk{schema: w.schema, table: w.table, keys: w.keys, ddl: w.ddl, rows: rows}
+	}
+	return nil
+}
+
+// Touch 记录窗口内 binlog 中出现过的行，这些行的分块数据已过期
+func (s *IncrementalSnapshotter) Touch(schema, table string, events []*model.Event) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	w := s.window
+	if w == nil || !w.open || w.schema != schema || w.table != table {
+		return
+	}
+	for _, ev := range events {
+		if ev.Data != nil {
+			w.touched[rowKey(w.keys, ev.Data)] = true
+		}
+		if ev.Before != nil {
+			w.touched[rowKey(w.keys, ev.Before)] = true
+		}
+	}
+}
+
+// Committed 高水位所在事务已被消费，分块完成
+func (s *IncrementalSnapshotter) Committed() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if w := s.window; w != nil && w.closing {
+		s.window = nil
+		close(w.done)
+	}
+}
+
+// Discard 高水位所在事务未提交即被丢弃，分块需要重读
+func (s *IncrementalSnapshotter) Discard() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if w := s.window; w != nil && w.closing {
+		s.window = nil
+		close(w.abort)
+	}
+}
+
+// Reset 增量重连后可能跳过或重放水位线，作废当前窗口
+func (s *IncrementalSnapshotter) Reset() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if w := s.window; w != nil {
+		s.window = nil
+		close(w.abort)
+	}
+}
+
+// rowKey 行的键，binlog 与查询结果中的数值类型不同，统一按字符串比较，不区分大小写的排序规则按小写比较
+func rowKey(keys []*syncdb.KeyColumn, row map[string]interface{}) string {
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		v := row[k.Name]
+		var str string
+		if b, ok := v.([]byte); ok {
+			str = string(b)
+		} else {
+			str = fmt.Sprint(v)
+		}
+		if strings.HasSuffix(strings.ToLower(k.Collation), "_ci") {
+			str = strings.ToLower(str)
+		}
+		parts[i] = str
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// signalValue 信号表的列值
+func signalValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	}
+	return fmt.Sprint(v)
+}
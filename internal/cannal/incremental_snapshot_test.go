@@ -0,0 +1,227 @@
+package cannal
+
+import (
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+	"go-cdc/pkg/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newTestWindow 创建等待水位线的窗口，分块读到 id 为 1 到 4 的行
+func newTestWindow() (*IncrementalSnapshotter, *snapshotWindow) {
+	w := &snapshotWindow{
+		id:     "w1",
+		schema: "db",
+		table:  "a",
+		keys:   []*syncdb.KeyColumn{{Name: "id", DataType: "int"}},
+		rows: []map[string]interface{}{
+			{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}, {"id": int64(4)},
+		},
+		done:  make(chan struct{}),
+		abort: make(chan struct{}),
+	}
+	return &IncrementalSnapshotter{signalSchema: "db", signalTable: "signal", window: w}, w
+}
+
+func chunkIDs(chunk *snapshotChunk) []interface{} {
+	ids := make([]interface{}, len(chunk.rows))
+	for i, row := range chunk.rows {
+		ids[i] = row["id"]
+	}
+	return ids
+}
+
+func TestIncrementalSnapshotWindow(t *testing.T) {
+	s, w := newTestWindow()
+	// 低水位之前的变更不影响分块
+	s.Touch("db", "a", []*model.Event{{Op: "update", Data: map[string]interface{}{"id": int32(1)}}})
+	if chunk := s.Watermark("w1", signalWindowClose); chunk != nil {
+		t.Fatal("high watermark before low watermark should be ignored")
+	}
+	if chunk := s.Watermark("other", signalWindowOpen); chunk != nil || w.open {
+		t.Fatal("watermark of another window should be ignored")
+	}
+	s.Watermark("w1", signalWindowOpen)
+	s.Touch("db", "a", []*model.Event{
+		// binlog 中的数值类型与查询结果不同
+		{Op: "update", Before: map[string]interface{}{"id": int32(2)}, Data: map[string]interface{}{"id": int32(2)}},
+		{Op: "delete", Before: map[string]interface{}{"id": uint64(3)}},
+		{Op: "insert", Data: map[string]interface{}{"id": int64(9)}},
+	})
+	// 其他表的变更不影响分块
+	s.Touch("db", "b", []*model.Event{{Op: "delete", Before: map[string]interface{}{"id": int64(4)}}})
+	chunk := s.Watermark("w1", signalWindowClose)
+	if chunk == nil {
+		t.Fatal("high watermark should return the chunk")
+	}
+	if got, want := chunkIDs(chunk), []interface{}{int64(1), int64(4)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got rows %v, want %v", got, want)
+	}
+	// 高水位之后的变更随事件流在分块之后投递
+	s.Touch("db", "a", []*model.Event{{Op: "delete", Before: map[string]interface{}{"id": int64(1)}}})
+	if w.touched[rowKey(w.keys, map[string]interface{}{"id": 1})] {
+		t.Fatal("change after high watermark should not be recorded")
+	}
+	// 重复读到高水位不再下发分块
+	if chunk := s.Watermark("w1", signalWindowClose); chunk != nil {
+		t.Fatal("replayed high watermark should be ignored")
+	}
+	s.Committed()
+	select {
+	case <-w.done:
+	default:
+		t.Fatal("window should be done after commit")
+	}
+	if s.window != nil {
+		t.Fatal("window should be cleared after commit")
+	}
+}
+
+// TestIncrementalSnapshotReopen 重放低水位时重新开始记录窗口内的变更
+func TestIncrementalSnapshotReopen(t *testing.T) {
+	s, w := newTestWindow()
+	s.Watermark("w1", signalWindowOpen)
+	s.Touch("db", "a", []*model.Event{{Op: "delete", Before: map[string]interface{}{"id": int64(1)}}})
+	s.Watermark("w1", signalWindowOpen)
+	s.Touch("db", "a", []*model.Event{{Op: "delete", Before: map[string]interface{}{"id": int64(2)}}})
+	chunk := s.Watermark("w1", signalWindowClose)
+	if got, want := chunkIDs(chunk), []interface{}{int64(1), int64(3), int64(4)}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got rows %v, want %v", got, want)
+	}
+	s.Discard()
+	select {
+	case <-w.abort:
+	default:
+		t.Fatal("window should be aborted after discard")
+	}
+}
+
+func TestIncrementalSnapshotReset(t *testing.T) {
+	s, w := newTestWindow()
+	s.Watermark("w1", signalWindowOpen)
+	// 读到高水位之前提交和丢弃都不影响窗口
+	s.Committed()
+	s.Discard()
+	if s.window != w {
+		t.Fatal("open window should be kept")
+	}
+	s.Reset()
+	select {
+	case <-w.abort:
+	default:
+		t.Fatal("window should be aborted after reset")
+	}
+	if s.Watermark("w1", signalWindowClose) != nil {
+		t.Fatal("watermark after reset should be ignored")
+	}
+	// 未配置信号表时各方法都是空操作
+	var none *IncrementalSnapshotter
+	none.Touch("db", "a", nil)
+	none.Reset()
+	if none.Watermark("w1", signalWindowOpen) != nil || none.IsSignal("db", "signal") {
+		t.Fatal("nil snapshotter should do nothing")
+	}
+	if !s.IsSignal("db", "signal") || s.IsSignal("db", "a") {
+		t.Fatal("IsSignal mismatch")
+	}
+}
+
+func TestRowKey(t *testing.T) {
+	keys := []*syncdb.KeyColumn{
+		{Name: "code", DataType: "varchar", Collation: "utf8mb4_general_ci"},
+		{Name: "name", DataType: "varchar", Collation: "utf8mb4_bin"},
+		{Name: "id", DataType: "bigint", Unsigned: true},
+	}
+	cases := []struct {
+		name string
+		a, b map[string]interface{}
+		same bool
+	}{
+		{
+			name: "numeric types",
+			a:    map[string]interface{}{"code": "x", "name": "n", "id": int64(7)},
+			b:    map[string]interface{}{"code": "x", "name": "n", "id": uint64(7)},
+			same: true,
+		},
+		{
+			name: "bytes and string",
+			a:    map[string]interface{}{"code": []byte("x"), "name": []byte("n"), "id": 7},
+			b:    map[string]interface{}{"code": "x", "name": "n", "id": 7},
+			same: true,
+		},
+		{
+			name: "case insensitive collation",
+			a:    map[string]interface{}{"code": "ABC", "name": "n", "id": 7},
+			b:    map[string]interface{}{"code": "abc", "name": "n", "id": 7},
+			same: true,
+		},
+		{
+			name: "binary collation",
+			a:    map[string]interface{}{"code": "x", "name": "N", "id": 7},
+			b:    map[string]interface{}{"code": "x", "name": "n", "id": 7},
+			same: false,
+		},
+		{
+			name: "column boundary",
+			a:    map[string]interface{}{"code": "ab", "name": "c", "id": 7},
+			b:    map[string]interface{}{"code": "a", "name": "bc", "id": 7},
+			same: false,
+		},
+	}
+	for _, c := range cases {
+		if got := rowKey(keys, c.a) == rowKey(keys, c.b); got != c.same {
+			t.Errorf("%s: same key %v, want %v", c.name, got, c.same)
+		}
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	cases := []struct {
+		data   string
+		tables []string
+		err    bool
+	}{
+		{"", nil, false},
+		{"  ", nil, false},
+		{`{"data-collections": ["db.a", "db.b"], "type": "incremental"}`, []string{"db.a", "db.b"}, false},
+		{`{"data-collections": ["db.a"], "type": "INCREMENTAL"}`, []string{"db.a"}, false},
+		{`{"data-collections": ["db.a"]}`, []string{"db.a"}, false},
+		{`{"data-collections": ["db.a"], "type": "blocking"}`, nil, true},
+		{`{"data-collections": "db.a"}`, nil, true},
+		{`db.a`, nil, true},
+	}
+	for _, c := range cases {
+		payload, err := parseSignal(c.data)
+		if (err != nil) != c.err {
+			t.Errorf("%q: got error %v", c.data, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(payload.DataCollections, c.tables) {
+			t.Errorf("%q: got tables %v, want %v", c.data, payload.DataCollections, c.tables)
+		}
+	}
+}
+
+// TestSendSignalValidate 参数不合法时在写入信号表之前返回错误
+func TestSendSignalValidate(t *testing.T) {
+	cfg := &config.DataSourceConfig{ID: "ds", Database: "db", SignalTable: "signal"}
+	cases := []struct {
+		name        string
+		cfg         *config.DataSourceConfig
+		typ         string
+		collections []string
+		err         string
+	}{
+		{"no signal table", &config.DataSourceConfig{ID: "ds"}, SignalExecuteSnapshot, []string{"db.a"}, "signal_table"},
+		{"unknown type", cfg, "snapshot", []string{"db.a"}, "unknown signal type"},
+		{"execute without tables", cfg, SignalExecuteSnapshot, nil, "at least one"},
+	}
+	for _, c := range cases {
+		err := SendSignal(nil, c.cfg, c.typ, c.collections...)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+	}
+}
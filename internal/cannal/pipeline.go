@@ -0,0 +1,202 @@
+package cannal
+
+import (
+	"context"
+	"fmt"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+	"go-cdc/pkg/config"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	PipelineSnapshotting = "snapshotting" // 全量同步中
+	PipelineStreaming    = "streaming"    // 全量完成，增量同步中
+	PipelineFailed       = "failed"       // 全量失败，拒绝开始增量
+)
+
+// Pipeline 协调每个数据源的全量到增量切换：全量完成后记录 Gfinal、向下游发送全量完成标记，
+// 再从各表快照位点中最早的位置开始增量同步，已包含在表快照中的事务由增量按表位点过滤
+type Pipeline struct {
+	holders    map[string]*syncdb.DataSourceHolder
+	snapshot   *FullAmountService
+	supervisor *Supervisor
+	consumer   IncrementalConsumer
+	ctx        context.Context
+	cancel     context.CancelFunc
+	wg         sync.WaitGroup
+
+	lock  sync.Mutex
+	state map[string]string // 数据源 ID -> 阶段
+}
+
+func NewPipeline(holders map[string]*syncdb.DataSourceHolder, consumer IncrementalConsumer) *Pipeline {
+	if consumer == nil {
+		consumer = ConsoleIncrementalConsumer{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	snapshot := NewFullAmountService(holders)
+	snapshot.consumer = consumer
+	return &Pipeline{
+		holders:    holders,
+		snapshot:   snapshot,
+		supervisor: NewSupervisor(consumer),
+		consumer:   consumer,
+		ctx:        ctx,
+		cancel:     cancel,
+		state:      make(map[string]string),
+	}
+}
+
+// Run 各数据源按全量模式并行执行全量，完成后各自切换到增量
+func (p *Pipeline) Run() {
+	for id, holder := range p.holders {
+		if !holder.Config.IsEnabled() || !holder.IsMysql() {
+			continue
+		}
+		p.setState(id, PipelineSnapshotting)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := p.runSource(holder); err != nil {
+				p.setState(id, PipelineFailed)
+				log.Log.Error("snapshot failed, incremental sync will not start", zap.String("datasource", id), zap.Error(err))
+				return
+			}
+			p.setState(id, PipelineStreaming)
+		}()
+	}
+}
+
+func (p *Pipeline) runSource(holder *syncdb.DataSourceHolder) error {
+	plan, err := PlanSnapshot(holder)
+	if err != nil {
+		return err
+	}
+	log.Log.Info("snapshot plan",
+		zap.String("datasource", holder.Config.ID),
+		zap.String("mode", plan.Mode),
+		zap.Bool("snapshot", plan.Snapshot),
+		zap.Bool("resume", plan.Resume),
+		zap.String("reason", plan.Reason))
+	if !plan.Snapshot {
+		// 不做全量，从 go_cdc_meta 中的位点继续增量
+		if err := p.supervisor.Add(holder); err != nil {
+			return err
+		}
+		if plan.Mode == config.SnapshotInitial || plan.Mode == config.SnapshotWhenNeeded {
+			p.backfill(holder)
+		}
+		return nil
+	}
+	if !plan.Resume {
+		if err := model.GetTableMetaService().ResetSnapshot(holder.Config.ID); err != nil {
+			return err
+		}
+	}
+	res, err := p.snapshot.RunSource(p.ctx, holder, plan.SchemaOnly)
+	if err != nil {
+		return err
+	}
+	return p.handoff(holder, res)
+}
+
+// handoff 记录全量结束位点并发送完成标记，然后从最早的表位点启动增量
+func (p *Pipeline) handoff(holder *syncdb.DataSourceHolder, res *SnapshotResult) error {
+	source, ok := holder.Source.(*syncdb.MysqlDataSource)
+	if !ok {
+		return fmt.Errorf("Holder.Source is not *syncdb.MysqlDataSource")
+	}
+	cfg := holder.Config
+	if err := model.GetTableMetaService().SaveSnapshotPos(cfg.ID, cfg.Type, res.Start, res.Final); err != nil {
+		return err
+	}
+	log.Log.Info("snapshot complete",
+		zap.String("datasource", cfg.ID),
+		zap.Int("tables", len(res.Tables)),
+		zap.String("start", res.Start.String()),
+		zap.String("final", res.Final.String()))
+	marker := &model.Event{
+		DataSource: cfg.ID,
+		Op:         model.OpSnapshotComplete,
+		Ts:         time.Now().Unix(),
+		Pos:        res.Final.String(),
+	}
+	if err := p.consumer.Consume([]*model.Event{marker}); err != nil {
+		return fmt.Errorf("emit snapshot complete marker err: %w", err)
+	}
+	source.LastPos = res.Start
+	return p.supervisor.Add(holder)
+}
+
+// backfill 已完成全量的数据源新增了同步表时，通过增量快照补齐这些表，不需要重新全量
+func (p *Pipeline) backfill(holder *syncdb.DataSourceHolder) {
+	signalSchema, signalTable := holder.Config.SignalTableName()
+	if signalTable == "" {
+		return
+	}
+	rule, err := holder.Config.Filter()
+	if err != nil {
+		log.Log.Warn("parse filter for backfill failed", zap.String("datasource", holder.Config.ID), zap.Error(err))
+		return
+	}
+	parser := FilterRuleParser{rule: rule}
+	schemas, err := parser.LoadAndFilterSchemas(*holder)
+	if err != nil {
+		log.Log.Warn("load schemas for backfill failed", zap.String("datasource", holder.Config.ID), zap.Error(err))
+		return
+	}
+	tables, err := parser.LoadAndFilterTables(*holder, schemas)
+	if err != nil {
+		log.Log.Warn("load tables for backfill failed", zap.String("datasource", holder.Config.ID), zap.Error(err))
+		return
+	}
+	service := model.GetTableMetaService()
+	for sc, list := range tables {
+		for _, tb := range list {
+			if sc == signalSchema && tb == signalTable {
+				continue
+			}
+			meta, err := service.GetTableMeta(holder.Config.ID, sc, tb)
+			if err != nil || meta != nil {
+				continue
+			}
+			if err := p.supervisor.IncrementalSnapshot(holder.Config.ID, sc, tb); err != nil {
+				log.Log.Warn("backfill table failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (p *Pipeline) setState(id, state string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.state[id] = state
+}
+
+// Status 返回各数据源所处阶段
+func (p *Pipeline) Status() map[string]string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	status := make(map[string]string, len(p.state))
+	for id, state := range p.state {
+		status[id] = state
+	}
+	return status
+}
+
+// Supervisor 增量服务的守护者，用于查询增量服务运行状态
+func (p *Pipeline) Supervisor() *Supervisor {
+	return p.supervisor
+}
+
+// Stop 取消进行中的全量，等待切换结束后停止所有增量服务
+func (p *Pipeline) Stop() {
+	p.cancel()
+	p.wg.Wait()
+	p.supervisor.Stop()
+}
@@ -0,0 +1,536 @@
+package cannal
+
+import (
+	"fmt"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	"github.com/pingcap/tidb/pkg/parser/opcode"
+)
+
+// RowFilter 表的行过滤条件。全量时还原为 SQL 拼入分块查询，增量时在 Go 中对 binlog 行镜像求值，
+// 只支持比较、逻辑运算、IN、BETWEEN、LIKE、IS NULL，保证两边语义一致：
+// NULL 按三值逻辑处理，字符串与数字比较时按数字比较。
+// 字符串按参与比较的列的排序规则区分大小写：_bin、_cs 与 binary 区分大小写，其余（包括未知排序规则）按 _ci 忽略大小写；
+// _ci 排序规则的重音不敏感与 PAD SPACE 不做模拟
+type RowFilter struct {
+	expr       ast.ExprNode
+	sql        string
+	columns    []string                      // 条件中引用的列
+	collations map[string]string             // 小写列名 -> 排序规则，SetCollations 设置
+	likes      map[ast.ExprNode]*likeMatcher // LIKE 模式预编译
+}
+
+// likeMatcher 同一 LIKE 模式按忽略大小写和区分大小写分别编译
+type likeMatcher struct {
+	ci, cs *regexp.Regexp
+}
+
+// NewRowFilter 解析并校验 WHERE 条件
+func NewRowFilter(expr string) (*RowFilter, error) {
+	stmt, err := parser.New().ParseOneStmt("SELECT 1 FROM t WHERE "+expr, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("parse row filter %q err: %w", expr, err)
+	}
+	sel, ok := stmt.(*ast.SelectStmt)
+	if !ok || sel.Where == nil || sel.Limit != nil || sel.OrderBy != nil || sel.GroupBy != nil || sel.Having != nil {
+		return nil, fmt.Errorf("row filter %q is not a plain condition", expr)
+	}
+	f := &RowFilter{expr: sel.Where, likes: make(map[ast.ExprNode]*likeMatcher)}
+	if err := f.validate(sel.Where); err != nil {
+		return nil, fmt.Errorf("row filter %q: %w", expr, err)
+	}
+	var sb strings.Builder
+	if err := sel.Where.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return nil, err
+	}
+	f.sql = "(" + sb.String() + ")"
+	return f, nil
+}
+
+// NewRowFilters 解析数据源配置的所有行过滤条件，返回 schema.table -> 过滤条件
+func NewRowFilters(cfg *config.DataSourceConfig) (map[string]*RowFilter, error) {
+	filters := make(map[string]*RowFilter, len(cfg.RowFilters))
+	for name, expr := range cfg.RowFilters {
+		if strings.TrimSpace(expr) == "" {
+			continue
+		}
+		f, err := NewRowFilter(expr)
+		if err != nil {
+			return nil, fmt.Errorf("row_filters %s of %s: %w", name, cfg.ID, err)
+		}
+		filters[name] = f
+	}
+	return filters, nil
+}
+
+// rowFilterSQL 表的行过滤条件 SQL，未配置时返回空
+func rowFilterSQL(cfg *config.DataSourceConfig, schema, table string) (string, error) {
+	expr := cfg.RowFilter(schema, table)
+	if expr == "" {
+		return "", nil
+	}
+	f, err := NewRowFilter(expr)
+	if err != nil {
+		return "", err
+	}
+	return f.SQL(), nil
+}
+
+// SQL 由语法树还原的条件，已加括号
+func (f *RowFilter) SQL() string {
+	return f.sql
+}
+
+// Columns 条件中引用的列
+func (f *RowFilter) Columns() []string {
+	return f.columns
+}
+
+// SetCollations 设置引用列的排序规则，列名 -> 排序规则，非字符串列为空；传入 nil 时清除，使用方在下次求值前重新加载
+func (f *RowFilter) SetCollations(collations map[string]string) {
+	if collations == nil {
+		f.collations = nil
+		return
+	}
+	f.collations = make(map[string]string, len(collations))
+	for name, collation := range collations {
+		f.collations[strings.ToLower(name)] = collation
+	}
+}
+
+// HasCollations 是否已设置排序规则
+func (f *RowFilter) HasCollations() bool {
+	return f.collations != nil
+}
+
+// caseSensitive 比较是否区分大小写：任一侧是区分大小写排序规则的列时区分
+func (f *RowFilter) caseSensitive(nodes ...ast.ExprNode) bool {
+	for _, node := range nodes {
+		for {
+			p, ok := node.(*ast.ParenthesesExpr)
+			if !ok {
+				break
+			}
+			node = p.Expr
+		}
+		col, ok := node.(*ast.ColumnNameExpr)
+		if !ok {
+			continue
+		}
+		collation := strings.ToLower(f.collations[col.Name.Name.L])
+		if collation == "binary" || strings.HasSuffix(collation, "_bin") || strings.HasSuffix(collation, "_cs") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match 行是否满足条件，结果为 NULL 时与 WHERE 一样视为不满足
+func (f *RowFilter) Match(row map[string]interface{}) bool {
+	ok, null := truth(f.eval(f.expr, row))
+	return ok && !null
+}
+
+// Apply 按前后镜像过滤行事件：update 移出条件范围时转为 delete，移入时转为 insert
+func (f *RowFilter) Apply(events []*model.Event) []*model.Event {
+	if f == nil {
+		return events
+	}
+	kept := events[:0]
+	for _, ev := range events {
+		switch ev.Op {
+		case "insert", model.OpRead:
+			if f.Match(ev.Data) {
+				kept = append(kept, ev)
+			}
+		case "delete":
+			if f.Match(ev.Before) {
+				kept = append(kept, ev)
+			}
+		case "update":
+			before, after := f.Match(ev.Before), f.Match(ev.Data)
+			switch {
+			case before && after:
+				kept = append(kept, ev)
+			case before:
+				ev.Op, ev.Data = "delete", nil
+				kept = append(kept, ev)
+			case after:
+				ev.Op, ev.Before = "insert", nil
+				kept = append(kept, ev)
+			}
+		default:
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
+
+func (f *RowFilter) validate(node ast.ExprNode) error {
+	switch n := node.(type) {
+	case *ast.ColumnNameExpr:
+		name := n.Name.Name.O
+		if !slices.ContainsFunc(f.columns, func(c string) bool { return strings.EqualFold(c, name) }) {
+			f.columns = append(f.columns, name)
+		}
+		return nil
+	case ast.ValueExpr:
+		return nil
+	case *ast.ParenthesesExpr:
+		return f.validate(n.Expr)
+	case *ast.BinaryOperationExpr:
+		switch n.Op {
+		case opcode.LogicAnd, opcode.LogicOr, opcode.LogicXor,
+			opcode.EQ, opcode.NE, opcode.LT, opcode.LE, opcode.GT, opcode.GE, opcode.NullEQ:
+		default:
+			return fmt.Errorf("unsupported operator %s", n.Op)
+		}
+		if err := f.validate(n.L); err != nil {
+			return err
+		}
+		return f.validate(n.R)
+	case *ast.UnaryOperationExpr:
+		if n.Op != opcode.Not && n.Op != opcode.Not2 && n.Op != opcode.Minus {
+			return fmt.Errorf("unsupported operator %s", n.Op)
+		}
+		return f.validate(n.V)
+	case *ast.PatternInExpr:
+		if n.Sel != nil {
+			return fmt.Errorf("subquery is not supported")
+		}
+		for _, item := range append([]ast.ExprNode{n.Expr}, n.List...) {
+			if err := f.validate(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.IsNullExpr:
+		return f.validate(n.Expr)
+	case *ast.BetweenExpr:
+		for _, item := range []ast.ExprNode{n.Expr, n.Left, n.Right} {
+			if err := f.validate(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *ast.PatternLikeOrIlikeExpr:
+		pattern, ok := n.Pattern.(ast.ValueExpr)
+		if !ok {
+			return fmt.Errorf("like pattern must be a literal")
+		}
+		ci, err := likeRegexp(normalizeValue(pattern.GetValue()), n.Escape, true)
+		if err != nil {
+			return err
+		}
+		cs, err := likeRegexp(normalizeValue(pattern.GetValue()), n.Escape, false)
+		if err != nil {
+			return err
+		}
+		f.likes[n] = &likeMatcher{ci: ci, cs: cs}
+		return f.validate(n.Expr)
+	}
+	return fmt.Errorf("unsupported expression %T", node)
+}
+
+// eval 求值，nil 表示 NULL，逻辑运算的结果为 int64 0/1
+func (f *RowFilter) eval(node ast.ExprNode, row map[string]interface{}) interface{} {
+	switch n := node.(type) {
+	case *ast.ColumnNameExpr:
+		return normalizeValue(lookupColumn(row, n.Name.Name.O))
+	case ast.ValueExpr:
+		return normalizeValue(n.GetValue())
+	case *ast.ParenthesesExpr:
+		return f.eval(n.Expr, row)
+	case *ast.UnaryOperationExpr:
+		v := f.eval(n.V, row)
+		if n.Op == opcode.Minus {
+			return negate(v)
+		}
+		ok, null := truth(v)
+		return boolValue(!ok, null)
+	case *ast.BinaryOperationExpr:
+		return f.evalBinary(n, row)
+	case *ast.PatternInExpr:
+		x := f.eval(n.Expr, row)
+		if x == nil {
+			return nil
+		}
+		null := false
+		for _, item := range n.List {
+			c, ok := compareValues(x, f.eval(item, row), f.caseSensitive(n.Expr, item))
+			if !ok {
+				null = true
+				continue
+			}
+			if c == 0 {
+				return boolValue(!n.Not, false)
+			}
+		}
+		return boolValue(n.Not, null)
+	case *ast.IsNullExpr:
+		isNull := f.eval(n.Expr, row) == nil
+		return boolValue(isNull != n.Not, false)
+	case *ast.BetweenExpr:
+		x, l, r := f.eval(n.Expr, row), f.eval(n.Left, row), f.eval(n.Right, row)
+		ge, ok1 := compareValues(x, l, f.caseSensitive(n.Expr, n.Left))
+		le, ok2 := compareValues(x, r, f.caseSensitive(n.Expr, n.Right))
+		if (ok1 && ge < 0) || (ok2 && le > 0) {
+			return boolValue(n.Not, false)
+		}
+		if !ok1 || !ok2 {
+			return nil
+		}
+		return boolValue(!n.Not, false)
+	case *ast.PatternLikeOrIlikeExpr:
+		x := f.eval(n.Expr, row)
+		if x == nil {
+			return nil
+		}
+		re := f.likes[n].ci
+		if f.caseSensitive(n.Expr) {
+			re = f.likes[n].cs
+		}
+		matched := re.MatchString(fmt.Sprint(x))
+		return boolValue(matched != n.Not, false)
+	}
+	return nil
+}
+
+func (f *RowFilter) evalBinary(n *ast.BinaryOperationExpr, row map[string]interface{}) interface{} {
+	l, r := f.eval(n.L, row), f.eval(n.R, row)
+	cs := f.caseSensitive(n.L, n.R)
+	switch n.Op {
+	case opcode.LogicAnd:
+		lt, ln := truth(l)
+		rt, rn := truth(r)
+		if (!lt && !ln) || (!rt && !rn) {
+			return int64(0)
+		}
+		return boolValue(true, ln || rn)
+	case opcode.LogicOr:
+		lt, ln := truth(l)
+		rt, rn := truth(r)
+		if (lt && !ln) || (rt && !rn) {
+			return int64(1)
+		}
+		return boolValue(false, ln || rn)
+	case opcode.LogicXor:
+		lt, ln := truth(l)
+		rt, rn := truth(r)
+		return boolValue(lt != rt, ln || rn)
+	case opcode.NullEQ:
+		if l == nil || r == nil {
+			return boolValue(l == nil && r == nil, false)
+		}
+		c, _ := compareValues(l, r, cs)
+		return boolValue(c == 0, false)
+	}
+	c, ok := compareValues(l, r, cs)
+	if !ok {
+		return nil
+	}
+	switch n.Op {
+	case opcode.EQ:
+		return boolValue(c == 0, false)
+	case opcode.NE:
+		return boolValue(c != 0, false)
+	case opcode.LT:
+		return boolValue(c < 0, false)
+	case opcode.LE:
+		return boolValue(c <= 0, false)
+	case opcode.GT:
+		return boolValue(c > 0, false)
+	case opcode.GE:
+		return boolValue(c >= 0, false)
+	}
+	return nil
+}
+
+// lookupColumn 按列名取值，精确匹配失败时忽略大小写
+func lookupColumn(row map[string]interface{}, name string) interface{} {
+	if v, ok := row[name]; ok {
+		return v
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return nil
+}
+
+// normalizeValue 统一为 nil、int64、uint64、float64、string
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case bool:
+		if val {
+			return int64(1)
+		}
+		return int64(0)
+	case int:
+		return int64(val)
+	case int8:
+		return int64(val)
+	case int16:
+		return int64(val)
+	case int32:
+		return int64(val)
+	case int64:
+		return val
+	case uint:
+		return uint64(val)
+	case uint8:
+		return uint64(val)
+	case uint16:
+		return uint64(val)
+	case uint32:
+		return uint64(val)
+	case uint64:
+		return val
+	case float32:
+		return float64(val)
+	case float64:
+		return val
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	}
+	// 小数字面量按数字参与比较，与 DECIMAL 列的字符串值比较时按数字比较；其他类型按字符串表示参与比较
+	str := fmt.Sprint(v)
+	if f, err := strconv.ParseFloat(str, 64); err == nil {
+		return f
+	}
+	return str
+}
+
+// compareValues 比较两个值，任一为 NULL 时 ok 为 false，cs 为 false 时字符串忽略大小写
+func compareValues(a, b interface{}, cs bool) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	if aStr && bStr {
+		if cs {
+			return strings.Compare(as, bs), true
+		}
+		return strings.Compare(strings.ToLower(as), strings.ToLower(bs)), true
+	}
+	if ai, ok := a.(int64); ok {
+		if bi, ok := b.(int64); ok {
+			return cmpOrdered(ai, bi), true
+		}
+	}
+	if au, ok := a.(uint64); ok {
+		if bu, ok := b.(uint64); ok {
+			return cmpOrdered(au, bu), true
+		}
+	}
+	return cmpOrdered(toFloat(a), toFloat(b)), true
+}
+
+func cmpOrdered[T int64 | uint64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// toFloat 字符串按 MySQL 的规则取前导数字，无法转换时为 0
+func toFloat(v interface{}) float64 {
+	switch val := v.(type) {
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case float64:
+		return val
+	case string:
+		s := strings.TrimSpace(val)
+		for i := len(s); i > 0; i-- {
+			if f, err := strconv.ParseFloat(s[:i], 64); err == nil {
+				return f
+			}
+		}
+	}
+	return 0
+}
+
+func negate(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		return -val
+	case uint64:
+		if val <= math.MaxInt64 {
+			return -int64(val)
+		}
+		return -float64(val)
+	}
+	return -toFloat(v)
+}
+
+// truth 值的真假，NULL 时 null 为 true
+func truth(v interface{}) (ok bool, null bool) {
+	if v == nil {
+		return false, true
+	}
+	return toFloat(v) != 0, false
+}
+
+func boolValue(b, null bool) interface{} {
+	if null {
+		return nil
+	}
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+// likeRegexp LIKE 模式转为正则，ci 为 true 时不区分大小写
+func likeRegexp(pattern interface{}, escape byte, ci bool) (*regexp.Regexp, error) {
+	str, ok := pattern.(string)
+	if !ok {
+		return nil, fmt.Errorf("like pattern must be a string")
+	}
+	var sb strings.Builder
+	if ci {
+		sb.WriteString("(?is)^")
+	} else {
+		sb.WriteString("(?s)^")
+	}
+	runes := []rune(str)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == rune(escape) && i+1 < len(runes):
+			i++
+			sb.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case c == '%':
+			sb.WriteString(".*")
+		case c == '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
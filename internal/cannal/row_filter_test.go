@@ -0,0 +1,181 @@
+package cannal
+
+import (
+	"go-cdc/internal/model"
+	"testing"
+)
+
+func mustRowFilter(t *testing.T, expr string) *RowFilter {
+	t.Helper()
+	f, err := NewRowFilter(expr)
+	if err != nil {
+		t.Fatalf("parse %q: %v", expr, err)
+	}
+	return f
+}
+
+func TestRowFilterMatch(t *testing.T) {
+	row := map[string]interface{}{
+		"id":     int64(10),
+		"status": "Paid",
+		"amount": "12.50",
+		"tenant": uint64(3),
+		"note":   nil,
+		"code":   []byte("ab_c"),
+	}
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"id = 10", true},
+		{"id <> 10", false},
+		{"id > 5 AND id <= 10", true},
+		{"id < 5 OR tenant = 3", true},
+		{"id BETWEEN 1 AND 9", false},
+		{"id NOT BETWEEN 1 AND 9", true},
+		{"id IN (1, 2, 10)", true},
+		{"id NOT IN (1, 2)", true},
+		{"-id = -10", true},
+		{"status = 'paid'", true},
+		{"status IN ('PAID', 'refund')", true},
+		{"status LIKE 'pa%'", true},
+		{"status NOT LIKE 'p_id'", false},
+		{"code LIKE 'ab\\_c'", true},
+		{"amount > 12", true},
+		{"amount = 12.5", true},
+		{"note IS NULL", true},
+		{"note IS NOT NULL", false},
+		// NULL 参与比较的结果为 NULL，与 WHERE 一样不满足
+		{"note = 'x'", false},
+		{"NOT (note = 'x')", false},
+		{"note <=> NULL", true},
+		{"note = 'x' OR id = 10", true},
+		{"note = 'x' AND id = 10", false},
+		{"id IN (1, NULL)", false},
+		{"id NOT IN (1, NULL)", false},
+		{"ID = 10", true},
+	}
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			if got := mustRowFilter(t, c.expr).Match(row); got != c.want {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRowFilterCollation(t *testing.T) {
+	row := map[string]interface{}{"status": "Paid", "name": "Alice"}
+	cases := []struct {
+		expr       string
+		collations map[string]string
+		want       bool
+	}{
+		{"status = 'paid'", nil, true},
+		{"status = 'paid'", map[string]string{"status": "utf8mb4_0900_ai_ci"}, true},
+		{"status = 'paid'", map[string]string{"status": "utf8mb4_bin"}, false},
+		{"status = 'Paid'", map[string]string{"status": "utf8mb4_bin"}, true},
+		{"status = 'paid'", map[string]string{"STATUS": "utf8mb4_0900_as_cs"}, false},
+		{"'paid' = (status)", map[string]string{"status": "binary"}, false},
+		{"status > 'a'", map[string]string{"status": "utf8mb4_bin"}, false},
+		{"status IN ('paid', 'x')", map[string]string{"status": "utf8mb4_bin"}, false},
+		{"status BETWEEN 'a' AND 'z'", map[string]string{"status": "utf8mb4_bin"}, false},
+		{"status LIKE 'pa%'", map[string]string{"status": "utf8mb4_bin"}, false},
+		{"status LIKE 'Pa%'", map[string]string{"status": "utf8mb4_bin"}, true},
+		// 其他列的排序规则不影响比较
+		{"status = 'paid'", map[string]string{"name": "utf8mb4_bin"}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.expr, func(t *testing.T) {
+			f := mustRowFilter(t, c.expr)
+			if c.collations != nil {
+				f.SetCollations(c.collations)
+			}
+			if got := f.Match(row); got != c.want {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRowFilterColumns(t *testing.T) {
+	f := mustRowFilter(t, "status = 'a' AND (Status LIKE 'b%' OR id IN (1, tenant))")
+	got := f.Columns()
+	want := []string{"status", "id", "tenant"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRowFilterInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"id = (SELECT 1)",
+		"id IN (SELECT id FROM t)",
+		"upper(status) = 'A'",
+		"id + 1 = 2",
+		"status LIKE name",
+		"1 ORDER BY id",
+	} {
+		if _, err := NewRowFilter(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
+
+func TestRowFilterApply(t *testing.T) {
+	f := mustRowFilter(t, "status = 'paid'")
+	paid := map[string]interface{}{"id": int64(1), "status": "paid"}
+	open := map[string]interface{}{"id": int64(1), "status": "open"}
+	events := []*model.Event{
+		{Op: "insert", Data: paid},
+		{Op: "insert", Data: open},
+		{Op: model.OpRead, Data: paid},
+		{Op: model.OpRead, Data: open},
+		{Op: "delete", Before: paid},
+		{Op: "delete", Before: open},
+		{Op: "update", Before: paid, Data: paid},
+		{Op: "update", Before: open, Data: open},
+		// 移出条件范围，下游需要删除该行
+		{Op: "update", Before: paid, Data: open},
+		// 移入条件范围，下游此前没有该行
+		{Op: "update", Before: open, Data: paid},
+		{Op: "ddl"},
+	}
+	got := f.Apply(events)
+	want := []struct {
+		op            string
+		before, after bool
+	}{
+		{"insert", false, true},
+		{model.OpRead, false, true},
+		{"delete", true, false},
+		{"update", true, true},
+		{"delete", true, false},
+		{"insert", false, true},
+		{"ddl", false, false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		ev := got[i]
+		if ev.Op != w.op || (ev.Before != nil) != w.before || (ev.Data != nil) != w.after {
+			t.Errorf("event %d: got op=%s before=%v data=%v, want %+v", i, ev.Op, ev.Before, ev.Data, w)
+		}
+	}
+	if got[4].Before["status"] != "paid" {
+		t.Errorf("moved out delete should keep the before image, got %v", got[4].Before)
+	}
+	if got[5].Data["status"] != "paid" {
+		t.Errorf("moved in insert should keep the after image, got %v", got[5].Data)
+	}
+	var nilFilter *RowFilter
+	if n := len(nilFilter.Apply([]*model.Event{{Op: "insert"}})); n != 1 {
+		t.Errorf("nil filter should keep all events, got %d", n)
+	}
+}
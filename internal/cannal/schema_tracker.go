@@ -0,0 +1,304 @@
+package cannal
+
+import (
+	"fmt"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// SchemaTracker 维护数据源在当前 binlog 位置上的表结构，历史版本持久化在 go_cdc_schema_history
+type SchemaTracker struct {
+	holder *syncdb.DataSourceHolder
+	parser *DDLParser
+	tables map[string]*model.TableSchema // schema.table -> 当前位置的表结构
+	loaded map[string]*model.Position    // schema.table -> 没有历史版本时从数据库读取结构的位点，早于该位点的 DDL 已体现在结构中
+}
+
+func NewSchemaTracker(holder *syncdb.DataSourceHolder) *SchemaTracker {
+	return &SchemaTracker{
+		holder: holder,
+		parser: NewDDLParser(),
+		tables: make(map[string]*model.TableSchema),
+		loaded: make(map[string]*model.Position),
+	}
+}
+
+// Reset 按增量起点重新加载表结构
+func (st *SchemaTracker) Reset(start *model.Position) error {
+	list, err := model.GetSchemaHistoryService().ListByDataSource(st.holder.Config.ID)
+	if err != nil {
+		return fmt.Errorf("load schema history err: %w", err)
+	}
+	tables, loaded, err := schemasAt(list, start)
+	if err != nil {
+		return err
+	}
+	st.tables, st.loaded = tables, loaded
+	return nil
+}
+
+// schemasAt 从按版本升序的历史中取每张表在 start 上的结构：取起点之前最新的版本，
+// 若表的所有版本都晚于起点（起点之后才做的全量或读取的结构），取最早的版本并记入 loaded，该版本位点之前的 DDL 不再重复应用。
+// 起点上已被删除的表不在返回的结构中
+func schemasAt(list []*model.SchemaHistory, start *model.Position) (map[string]*model.TableSchema, map[string]*model.Position, error) {
+	tables := make(map[string]*model.TableSchema)
+	decided := make(map[string]bool)
+	loaded := make(map[string]*model.Position)
+	for _, h := range list {
+		key := h.Sc + "." + h.Tb
+		pos, err := h.Position()
+		if err != nil {
+			return nil, nil, err
+		}
+		if pos.CoveredBy(start) {
+			decided[key] = true
+			delete(loaded, key)
+		} else if _, ok := tables[key]; ok || decided[key] {
+			continue
+		} else {
+			loaded[key] = pos
+		}
+		if h.Dropped {
+			tables[key] = nil
+			continue
+		}
+		ts, err := h.TableSchema()
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse schema history %s err: %w", key, err)
+		}
+		tables[key] = ts
+	}
+	res := make(map[string]*model.TableSchema, len(tables))
+	for k, v := range tables {
+		if v != nil {
+			res[k] = v
+		}
+	}
+	return res, loaded, nil
+}
+
+// Get 获取表在当前位置的结构，没有历史版本时读取数据库当前的建表语句作为初始版本。
+// 该版本记录在实际读取的位点上，而不是当前事件的位点：当前事件可能远早于读取时刻，之间的 DDL 已经体现在读到的结构中
+func (st *SchemaTracker) Get(schema, table string, pos *model.Position) (*model.TableSchema, error) {
+	key := schema + "." + table
+	if ts, ok := st.tables[key]; ok {
+		return ts, nil
+	}
+	snap, err := st.holder.Source.BeginTransactionSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = snap.Commit()
+	}()
+	ddl, err := st.holder.Source.GetTableDDL(snap.Tx, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	ts, err := st.parseCreateTable(ddl, schema)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := model.GetSchemaHistoryService().Save(st.holder.Config.ID, schema, table, snap.Pos, ts, ddl, false); err != nil {
+		return nil, err
+	}
+	log.Log.Warn("no schema history, load current table structure", zap.String("schema", schema), zap.String("table", table),
+		zap.String("event_pos", pos.String()), zap.String("load_pos", snap.Pos.String()))
+	st.tables[key] = ts
+	st.loaded[key] = snap.Pos
+	return ts, nil
+}
+
+// reflects 表结构是否读取自数据库且读取位点不早于 pos，此时 pos 上的 DDL 已体现在结构中，不能重复应用
+func (st *SchemaTracker) reflects(schema, table string, pos *model.Position) bool {
+	loaded, ok := st.loaded[schema+"."+table]
+	return ok && pos.CoveredBy(loaded)
+}
+
+// Forget 丢弃表的结构缓存
+func (st *SchemaTracker) Forget(schema, table string) {
+	delete(st.tables, schema+"."+table)
+	delete(st.loaded, schema+"."+table)
+}
+
+// Seed 以全量快照时的建表语句作为表结构版本
+func (st *SchemaTracker) Seed(schema, table, ddl string, pos *model.Position) error {
+	ts, err := st.parseCreateTable(ddl, schema)
+	if err != nil {
+		return err
+	}
+	_, err = model.GetSchemaHistoryService().Save(st.holder.Config.ID, schema, table, pos, ts, ddl, false)
+	return err
+}
+
+func (st *SchemaTracker) parseCreateTable(ddl, schema string) (*model.TableSchema, error) {
+	events, _, err := st.parser.Parse(ddl, schema)
+	if err != nil {
+		return nil, fmt.Errorf("parse create table err: %w", err)
+	}
+	if len(events) != 1 || events[0].Kind != model.DDLCreateTable {
+		return nil, fmt.Errorf("not a create table statement: %s", ddl)
+	}
+	return &model.TableSchema{Columns: events[0].Columns, PrimaryKey: events[0].PrimaryKey}, nil
+}
+
+// Apply 将 DDL 作用到当前表结构并记录新版本
+func (st *SchemaTracker) Apply(ddl *model.DDLEvent, pos *model.Position) error {
+	key := ddl.Schema + "." + ddl.Table
+	switch ddl.Kind {
+	case model.DDLCreateTable:
+		ts := &model.TableSchema{Columns: ddl.Columns, PrimaryKey: ddl.PrimaryKey}
+		if ddl.LikeTable != "" {
+			like, err := st.Get(ddl.LikeSchema, ddl.LikeTable, pos)
+			if err != nil {
+				return err
+			}
+			ts = like.Clone()
+		}
+		return st.save(ddl.Schema, ddl.Table, ts, ddl.Query, pos)
+	case model.DDLAlterTable:
+		cur, err := st.Get(ddl.Schema, ddl.Table, pos)
+		if err != nil {
+			return err
+		}
+		if st.reflects(ddl.Schema, ddl.Table, pos) {
+			return nil
+		}
+		ts := alterTableSchema(cur.Clone(), ddl)
+		if ddl.NewTable != "" && (ddl.NewSchema != ddl.Schema || ddl.NewTable != ddl.Table) {
+			if err := st.drop(ddl.Schema, ddl.Table, ddl.Query, pos); err != nil {
+				return err
+			}
+			return st.save(ddl.NewSchema, ddl.NewTable, ts, ddl.Query, pos)
+		}
+		return st.save(ddl.Schema, ddl.Table, ts, ddl.Query, pos)
+	case model.DDLRenameTable:
+		cur, err := st.Get(ddl.Schema, ddl.Table, pos)
+		if err != nil {
+			return err
+		}
+		if st.reflects(ddl.Schema, ddl.Table, pos) {
+			return nil
+		}
+		if err := st.drop(ddl.Schema, ddl.Table, ddl.Query, pos); err != nil {
+			return err
+		}
+		return st.save(ddl.NewSchema, ddl.NewTable, cur.Clone(), ddl.Query, pos)
+	case model.DDLDropTable:
+		if _, ok := st.tables[key]; !ok || st.reflects(ddl.Schema, ddl.Table, pos) {
+			return nil
+		}
+		return st.drop(ddl.Schema, ddl.Table, ddl.Query, pos)
+	case model.DDLDropDatabase:
+		for k := range st.tables {
+			sc, tb, _ := strings.Cut(k, ".")
+			if sc == ddl.Schema {
+				if err := st.drop(sc, tb, ddl.Query, pos); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (st *SchemaTracker) save(schema, table string, ts *model.TableSchema, ddl string, pos *model.Position) error {
+	if _, err := model.GetSchemaHistoryService().Save(st.holder.Config.ID, schema, table, pos, ts, ddl, false); err != nil {
+		return err
+	}
+	st.tables[schema+"."+table] = ts
+	delete(st.loaded, schema+"."+table)
+	return nil
+}
+
+func (st *SchemaTracker) drop(schema, table, ddl string, pos *model.Position) error {
+	if _, err := model.GetSchemaHistoryService().Save(st.holder.Config.ID, schema, table, pos, &model.TableSchema{}, ddl, true); err != nil {
+		return err
+	}
+	delete(st.tables, schema+"."+table)
+	delete(st.loaded, schema+"."+table)
+	return nil
+}
+
+// alterTableSchema 按 alter table 的列变更调整列顺序与定义
+func alterTableSchema(ts *model.TableSchema, ddl *model.DDLEvent) *model.TableSchema {
+	indexOf := func(name string) int {
+		for i, col := range ts.Columns {
+			if strings.EqualFold(col.Name, name) {
+				return i
+			}
+		}
+		return -1
+	}
+	remove := func(i int) {
+		ts.Columns = append(ts.Columns[:i], ts.Columns[i+1:]...)
+	}
+	insert := func(col *model.ColumnDef, fallback int) {
+		idx := fallback
+		if col.First {
+			idx = 0
+		} else if col.After != "" {
+			if i := indexOf(col.After); i >= 0 {
+				idx = i + 1
+			}
+		}
+		if idx < 0 || idx > len(ts.Columns) {
+			idx = len(ts.Columns)
+		}
+		c := *col
+		c.First, c.After, c.OldName = false, "", ""
+		ts.Columns = append(ts.Columns, nil)
+		copy(ts.Columns[idx+1:], ts.Columns[idx:])
+		ts.Columns[idx] = &c
+	}
+	renamePK := func(from, to string) {
+		for i, k := range ts.PrimaryKey {
+			if strings.EqualFold(k, from) {
+				ts.PrimaryKey[i] = to
+			}
+		}
+	}
+
+	for _, name := range ddl.DroppedColumns {
+		if i := indexOf(name); i >= 0 {
+			remove(i)
+		}
+		pk := ts.PrimaryKey[:0]
+		for _, k := range ts.PrimaryKey {
+			if !strings.EqualFold(k, name) {
+				pk = append(pk, k)
+			}
+		}
+		ts.PrimaryKey = pk
+	}
+	for _, col := range ddl.ModifiedColumns {
+		i := indexOf(col.OldName)
+		if i < 0 {
+			insert(col, -1)
+			continue
+		}
+		remove(i)
+		insert(col, i)
+		renamePK(col.OldName, col.Name)
+	}
+	for _, r := range ddl.RenamedColumns {
+		if i := indexOf(r.From); i >= 0 {
+			ts.Columns[i].Name = r.To
+		}
+		renamePK(r.From, r.To)
+	}
+	for _, col := range ddl.AddedColumns {
+		insert(col, -1)
+	}
+	if ddl.DropPrimaryKey {
+		ts.PrimaryKey = nil
+	}
+	if len(ddl.PrimaryKey) > 0 {
+		ts.PrimaryKey = append([]string(nil), ddl.PrimaryKey...)
+	}
+	return ts
+}
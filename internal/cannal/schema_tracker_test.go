@@ -0,0 +1,169 @@
+package cannal
+
+import (
+	"encoding/json"
+	"go-cdc/internal/model"
+	"reflect"
+	"testing"
+
+	rep "github.com/go-mysql-org/go-mysql/replication"
+)
+
+func filePos(pos uint32) *model.Position {
+	return model.NewFilePosition(model.BinlogPos{File: "mysql-bin.000001", Pos: pos})
+}
+
+// trackedHistory 依次应用 DDL 生成表结构历史，第 i 条 DDL 的版本位于 (i+1)*100
+func trackedHistory(t *testing.T, queries ...string) []*model.SchemaHistory {
+	t.Helper()
+	dp := NewDDLParser()
+	var list []*model.SchemaHistory
+	var cur *model.TableSchema
+	for i, q := range queries {
+		events, _, err := dp.Parse(q, "db")
+		if err != nil || len(events) != 1 {
+			t.Fatalf("parse %s: %d events, %v", q, len(events), err)
+		}
+		ev := events[0]
+		dropped := false
+		switch ev.Kind {
+		case model.DDLCreateTable:
+			cur = &model.TableSchema{Columns: ev.Columns, PrimaryKey: ev.PrimaryKey}
+		case model.DDLAlterTable:
+			cur = alterTableSchema(cur.Clone(), ev)
+		case model.DDLDropTable:
+			cur, dropped = &model.TableSchema{}, true
+		}
+		b, _ := json.Marshal(cur)
+		pos := filePos(uint32(i+1) * 100)
+		list = append(list, &model.SchemaHistory{
+			Sc: ev.Schema, Tb: ev.Table, Version: int64(i + 1), Pos: pos.Marshal(), PosMode: pos.Mode,
+			Schema: string(b), DDL: q, Dropped: dropped,
+		})
+	}
+	return list
+}
+
+func TestSchemasAt(t *testing.T) {
+	list := trackedHistory(t,
+		"CREATE TABLE t (id int NOT NULL, a varchar(8), b int, PRIMARY KEY (id))", // 100
+		"ALTER TABLE t ADD COLUMN c enum('x','y') AFTER id",                       // 200
+		"ALTER TABLE t DROP COLUMN a",                                             // 300
+		"ALTER TABLE t CHANGE COLUMN id uid bigint unsigned NOT NULL",             // 400
+		"DROP TABLE t", // 500
+	)
+	cases := []struct {
+		start  uint32
+		row    []interface{}
+		want   map[string]interface{} // nil 表示起点上没有表结构
+		loaded bool
+	}{
+		// 起点早于所有版本时取最早的版本，该版本之前的 DDL 不再应用
+		{50, []interface{}{int64(1), "s", int64(2)}, map[string]interface{}{"id": int64(1), "a": "s", "b": int64(2)}, true},
+		{100, []interface{}{int64(1), "s", int64(2)}, map[string]interface{}{"id": int64(1), "a": "s", "b": int64(2)}, false},
+		{250, []interface{}{int64(1), int64(2), "s", int64(3)}, map[string]interface{}{"id": int64(1), "c": "y", "a": "s", "b": int64(3)}, false},
+		{350, []interface{}{int64(1), int64(1), int64(3)}, map[string]interface{}{"id": int64(1), "c": "x", "b": int64(3)}, false},
+		{450, []interface{}{int64(-1), int64(1), int64(3)}, map[string]interface{}{"uid": uint64(18446744073709551615), "c": "x", "b": int64(3)}, false},
+		{550, nil, nil, false},
+	}
+	for _, c := range cases {
+		tables, loaded, err := schemasAt(list, filePos(c.start))
+		if err != nil {
+			t.Fatalf("start %d: %v", c.start, err)
+		}
+		if _, ok := loaded["db.t"]; ok != c.loaded {
+			t.Errorf("start %d: loaded %v", c.start, ok)
+		}
+		ts, ok := tables["db.t"]
+		if ok != (c.want != nil) {
+			t.Errorf("start %d: has schema %v", c.start, ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		e := &rep.RowsEvent{Table: &rep.TableMapEvent{Schema: []byte("db"), Table: []byte("t"), ColumnCount: uint64(len(c.row))}}
+		if got := getRowData(e, ts, c.row); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("start %d: got row %v, want %v", c.start, got, c.want)
+		}
+	}
+}
+
+// TestSchemasAtRecreated 删除后重建的表取起点之前最新的版本，其他位点类型的版本不参与比较
+func TestSchemasAtRecreated(t *testing.T) {
+	list := trackedHistory(t,
+		"CREATE TABLE t (id int)",         // 100
+		"DROP TABLE t",                    // 200
+		"CREATE TABLE t (id int, x int)",  // 300
+		"CREATE TABLE u (id int, y text)", // 400
+	)
+	tables, loaded, err := schemasAt(list, filePos(350))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts := tables["db.t"]; ts == nil || len(ts.Columns) != 2 || ts.Columns[1].Name != "x" {
+		t.Fatalf("got schema %+v", ts)
+	}
+	// u 只有起点之后的版本
+	if pos := loaded["db.u"]; pos == nil || pos.BinlogPos.Pos != 400 {
+		t.Fatalf("got loaded %+v", loaded)
+	}
+	if _, ok := loaded["db.t"]; ok {
+		t.Fatal("t has a version before start")
+	}
+	list[0].Pos = "{"
+	if _, _, err := schemasAt(list, filePos(350)); err == nil {
+		t.Fatal("invalid position should fail")
+	}
+}
+
+func TestAlterTableSchema(t *testing.T) {
+	base := func() *model.TableSchema {
+		return &model.TableSchema{
+			Columns:    []*model.ColumnDef{{Name: "id", Type: "int"}, {Name: "a", Type: "int"}, {Name: "b", Type: "int"}},
+			PrimaryKey: []string{"id", "a"},
+		}
+	}
+	names := func(ts *model.TableSchema) []string {
+		res := make([]string, len(ts.Columns))
+		for i, col := range ts.Columns {
+			res[i] = col.Name
+		}
+		return res
+	}
+	cases := []struct {
+		query string
+		cols  []string
+		pk    []string
+	}{
+		{"ALTER TABLE t ADD COLUMN c int", []string{"id", "a", "b", "c"}, []string{"id", "a"}},
+		{"ALTER TABLE t ADD COLUMN c int FIRST", []string{"c", "id", "a", "b"}, []string{"id", "a"}},
+		{"ALTER TABLE t ADD COLUMN c int AFTER ID", []string{"id", "c", "a", "b"}, []string{"id", "a"}},
+		{"ALTER TABLE t DROP COLUMN A", []string{"id", "b"}, []string{"id"}},
+		{"ALTER TABLE t CHANGE COLUMN a a2 bigint", []string{"id", "a2", "b"}, []string{"id", "a2"}},
+		{"ALTER TABLE t CHANGE COLUMN a a2 bigint AFTER b", []string{"id", "b", "a2"}, []string{"id", "a2"}},
+		{"ALTER TABLE t MODIFY COLUMN b bigint FIRST", []string{"b", "id", "a"}, []string{"id", "a"}},
+		{"ALTER TABLE t RENAME COLUMN id TO uid", []string{"uid", "a", "b"}, []string{"uid", "a"}},
+		{"ALTER TABLE t DROP PRIMARY KEY, ADD PRIMARY KEY (b)", []string{"id", "a", "b"}, []string{"b"}},
+		{"ALTER TABLE t DROP PRIMARY KEY", []string{"id", "a", "b"}, nil},
+		{"ALTER TABLE t DROP COLUMN b, ADD COLUMN b varchar(8) AFTER id", []string{"id", "b", "a"}, []string{"id", "a"}},
+	}
+	dp := NewDDLParser()
+	for _, c := range cases {
+		events, _, err := dp.Parse(c.query, "db")
+		if err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		orig := base()
+		ts := alterTableSchema(orig.Clone(), events[0])
+		if got := names(ts); !reflect.DeepEqual(got, c.cols) {
+			t.Errorf("%s: got columns %v, want %v", c.query, got, c.cols)
+		}
+		if !reflect.DeepEqual(ts.PrimaryKey, c.pk) {
+			t.Errorf("%s: got primary key %v, want %v", c.query, ts.PrimaryKey, c.pk)
+		}
+		if !reflect.DeepEqual(orig, base()) {
+			t.Errorf("%s: original schema modified", c.query)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package cannal
+
+import (
+	"fmt"
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+	"go-cdc/pkg/config"
+)
+
+// SnapshotPlan 数据源启动时是否需要全量
+type SnapshotPlan struct {
+	Mode       string // 配置的全量模式
+	Snapshot   bool   // 是否执行全量
+	SchemaOnly bool   // 全量是否只下发建表 DDL
+	Resume     bool   // 是否沿用上一轮未完成全量的表进度
+	Reason     string // 决策原因，用于日志
+}
+
+// PlanSnapshot 按 snapshot_mode 与 go_cdc_meta 中记录的全量结束位点决定是否全量，
+// go_cdc_meta.snapshot_pos 非空表示该数据源已完成过全量
+func PlanSnapshot(holder *syncdb.DataSourceHolder) (*SnapshotPlan, error) {
+	cfg := holder.Config
+	mode, err := cfg.GetSnapshotMode()
+	if err != nil {
+		return nil, err
+	}
+	meta, err := model.GetTableMetaService().GetCDCMeta(cfg.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load cdc meta of %s err: %w", cfg.ID, err)
+	}
+	done := meta != nil && meta.SnapshotPos != "" && meta.SnapshotPos != "null"
+	return decidePlan(mode, done, cfg.SnapshotConsistent, func() (bool, error) {
+		source, ok := holder.Source.(*syncdb.MysqlDataSource)
+		if !ok {
+			return false, fmt.Errorf("Holder.Source is not *syncdb.MysqlDataSource")
+		}
+		return syncdb.BinlogInitializer{}.Purged(source.Db, source.LastPos)
+	})
+}
+
+// decidePlan 按全量模式和是否已完成过全量决定启动方式，purged 只在 when_needed 且已完成过全量时调用，检查增量位点的 binlog 是否已被清理
+func decidePlan(mode string, done, consistent bool, purged func() (bool, error)) (*SnapshotPlan, error) {
+	plan := &SnapshotPlan{Mode: mode}
+	switch mode {
+	case config.SnapshotNever:
+		plan.Reason = "snapshot disabled"
+	case config.SnapshotAlways:
+		plan.Snapshot, plan.Reason = true, "snapshot on every start"
+	case config.SnapshotInitial, config.SnapshotSchemaOnly:
+		plan.SchemaOnly = mode == config.SnapshotSchemaOnly
+		if done {
+			plan.Reason = "snapshot already completed"
+		} else {
+			plan.Snapshot, plan.Resume, plan.Reason = true, true, "no completed snapshot"
+		}
+	case config.SnapshotWhenNeeded:
+		if !done {
+			plan.Snapshot, plan.Resume, plan.Reason = true, true, "no completed snapshot"
+			break
+		}
+		gone, err := purged()
+		if err != nil {
+			return nil, err
+		}
+		if gone {
+			plan.Snapshot, plan.Reason = true, "binlog of checkpoint has been purged"
+		} else {
+			plan.Reason = "checkpoint is still available"
+		}
+	}
+	// 一致性全量要求所有表读自同一位点，上一轮的表进度不能沿用
+	if plan.Snapshot && plan.Resume && consistent {
+		plan.Resume = false
+		plan.Reason += ", consistent snapshot restarts from scratch"
+	}
+	return plan, nil
+}
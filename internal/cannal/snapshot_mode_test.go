@@ -0,0 +1,68 @@
+package cannal
+
+import (
+	"errors"
+	"go-cdc/pkg/config"
+	"testing"
+)
+
+func TestDecidePlan(t *testing.T) {
+	purgeErr := errors.New("show binary logs denied")
+	cases := []struct {
+		name       string
+		mode       string
+		done       bool
+		consistent bool
+		purged     bool
+		purgeErr   error
+		want       SnapshotPlan // 不比较 Reason
+		checked    bool         // 是否检查了 binlog
+		err        bool
+	}{
+		{name: "initial first start", mode: config.SnapshotInitial, want: SnapshotPlan{Snapshot: true, Resume: true}},
+		{name: "initial done", mode: config.SnapshotInitial, done: true},
+		{name: "initial consistent", mode: config.SnapshotInitial, consistent: true, want: SnapshotPlan{Snapshot: true}},
+		{name: "schema only first start", mode: config.SnapshotSchemaOnly, want: SnapshotPlan{Snapshot: true, SchemaOnly: true, Resume: true}},
+		{name: "schema only done", mode: config.SnapshotSchemaOnly, done: true, want: SnapshotPlan{SchemaOnly: true}},
+		{name: "never", mode: config.SnapshotNever},
+		{name: "never done", mode: config.SnapshotNever, done: true},
+		{name: "always", mode: config.SnapshotAlways, want: SnapshotPlan{Snapshot: true}},
+		{name: "always done", mode: config.SnapshotAlways, done: true, want: SnapshotPlan{Snapshot: true}},
+		{name: "when needed first start", mode: config.SnapshotWhenNeeded, want: SnapshotPlan{Snapshot: true, Resume: true}},
+		{name: "when needed consistent", mode: config.SnapshotWhenNeeded, consistent: true, want: SnapshotPlan{Snapshot: true}},
+		{name: "when needed available", mode: config.SnapshotWhenNeeded, done: true, checked: true},
+		{
+			// 位点已被清理时上一轮的进度已无意义，重新全量
+			name: "when needed purged", mode: config.SnapshotWhenNeeded, done: true, purged: true, checked: true,
+			want: SnapshotPlan{Snapshot: true},
+		},
+		{name: "when needed check failed", mode: config.SnapshotWhenNeeded, done: true, purgeErr: purgeErr, checked: true, err: true},
+	}
+	for _, c := range cases {
+		checked := false
+		plan, err := decidePlan(c.mode, c.done, c.consistent, func() (bool, error) {
+			checked = true
+			return c.purged, c.purgeErr
+		})
+		if checked != c.checked {
+			t.Errorf("%s: binlog checked %v", c.name, checked)
+		}
+		if c.err {
+			if !errors.Is(err, purgeErr) {
+				t.Errorf("%s: got error %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if plan.Reason == "" {
+			t.Errorf("%s: missing reason", c.name)
+		}
+		c.want.Mode, c.want.Reason = c.mode, plan.Reason
+		if *plan != c.want {
+			t.Errorf("%s: got %+v, want %+v", c.name, *plan, c.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package cannal
+
+import (
+	"encoding/json"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"go-cdc/internal/syncdb"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	defaultSnapshotSplitRows = 1000000 // 默认超过一百万行的表切分读取
+	defaultSnapshotRanges    = 4       // 默认切分为 4 个范围
+)
+
+// splitTable 估算行数超过阈值时按主键首列切分范围并持久化，不需要切分时返回 nil
+func (sr SnapshotReader) splitTable(holder syncdb.DataSourceHolder, tx syncdb.Querier, sc, tb string, key *syncdb.KeyColumn) ([]*model.SnapshotRange, error) {
+	threshold := holder.Config.SnapshotSplitRows
+	if threshold <= 0 {
+		threshold = defaultSnapshotSplitRows
+	}
+	n := holder.Config.SnapshotRanges
+	if n == 0 {
+		n = defaultSnapshotRanges
+	}
+	if n <= 1 {
+		return nil, nil
+	}
+	estimated, err := holder.Source.EstimateRows(tx, sc, tb)
+	if err != nil || estimated < threshold {
+		return nil, err
+	}
+	chunkRanges, err := holder.Source.SplitTableRanges(tx, sc, tb, key, n, estimated)
+	if err != nil || len(chunkRanges) <= 1 {
+		return nil, err
+	}
+	ranges := make([]*model.SnapshotRange, len(chunkRanges))
+	for i, cr := range chunkRanges {
+		ranges[i] = &model.SnapshotRange{
+			DataSourceID:   holder.Config.ID,
+			Sc:             sc,
+			Tb:             tb,
+			RangeNo:        i,
+			Col:            cr.Column,
+			Lower:          encodeBound(key, cr.Lower),
+			Upper:          encodeBound(key, cr.Upper),
+			SnapshotStatus: model.SnapshotPending,
+		}
+	}
+	if err := model.GetTableMetaService().SaveSnapshotRanges(holder.Config.ID, sc, tb, ranges); err != nil {
+		return nil, err
+	}
+	log.Log.Info("split table into ranges", zap.String("schema", sc), zap.String("table", tb),
+		zap.Int64("estimated_rows", estimated), zap.Int("ranges", len(ranges)))
+	return ranges, nil
+}
+
+// readRanges 并发读取未完成的范围，返回所有范围的快照位点
+func (sr SnapshotReader) readRanges(holder syncdb.DataSourceHolder, sc, tb string, keys []*syncdb.KeyColumn, filter string, ranges []*model.SnapshotRange, dispatcher EventDispatcher) ([]*model.Position, error) {
+	n := holder.Config.SnapshotRanges
+	if n <= 0 {
+		n = defaultSnapshotRanges
+	}
+	positions := make([]*model.Position, len(ranges))
+	var eg errgroup.Group
+	eg.SetLimit(n)
+	for i, r := range ranges {
+		if r.SnapshotStatus == model.SnapshotDone {
+			pos, err := model.ParsePosition(r.PosMode, r.SnapshotPos)
+			if err != nil {
+				return nil, err
+			}
+			positions[i] = pos
+			continue
+		}
+		eg.Go(func() error {
+			pos, err := sr.readRange(holder, sc, tb, keys, filter, r, dispatcher)
+			if err != nil {
+				log.Log.Error("read snapshot range error", zap.String("schema", sc), zap.String("table", tb), zap.Int("range", r.RangeNo), zap.Error(err))
+				return err
+			}
+			positions[i] = pos
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+// readRange 在独立的事务快照中读取一个范围，中断后从范围内最后一个已消费的分块继续
+func (sr SnapshotReader) readRange(holder syncdb.DataSourceHolder, sc, tb string, keys []*syncdb.KeyColumn, filter string, r *model.SnapshotRange, dispatcher EventDispatcher) (*model.Position, error) {
+	lower, err := decodeBound(keys[0], r.Lower)
+	if err != nil {
+		return nil, err
+	}
+	upper, err := decodeBound(keys[0], r.Upper)
+	if err != nil {
+		return nil, err
+	}
+	snap, err := holder.Source.BeginTransactionSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = snap.Commit()
+	}()
+
+	service := model.GetTableMetaService()
+	pos := snap.Pos
+	var lastPK []interface{}
+	var rowsCopied int64
+	if resume, ok := decodeResume(r.SnapshotStatus, r.PosMode, r.SnapshotPos, r.LastChunkPK, r.RowsCopied, snap.Pos.Mode, keys); ok {
+		pos, lastPK, rowsCopied = resume.pos, resume.lastPK, resume.rows
+		err = service.SetSnapshotRangeStatus(r.ID, model.SnapshotRunning)
+	} else {
+		err = service.StartSnapshotRange(r.ID, snap.Pos)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &syncdb.ChunkRange{Column: r.Col, Lower: lower, Upper: upper}
+	err = sr.readChunks(holder, snap.Tx, sc, tb, keys, lastPK, cr, filter, rowsCopied, dispatcher, func(lastPK string, rows int64) error {
+		return dispatcher.RangeCheckpoint(sc, tb, r.ID, lastPK, rows)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := dispatcher.RangeEnd(sc, tb, r.ID); err != nil {
+		return nil, err
+	}
+	return pos, nil
+}
+
+// encodeBound 范围边界按切分列的类型序列化，二进制值以 base64 保存
+func encodeBound(key *syncdb.KeyColumn, v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	b, _ := json.Marshal(syncdb.EncodeKeyValue(key, v))
+	return string(b)
+}
+
+func decodeBound(key *syncdb.KeyColumn, str string) (interface{}, error) {
+	if str == "" || str == "null" {
+		return nil, nil
+	}
+	v, err := decodeJSON(str)
+	if err != nil {
+		return nil, err
+	}
+	return syncdb.DecodeKeyValue(key, v)
+}
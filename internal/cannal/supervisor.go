@@ -0,0 +1,122 @@
+package cannal
+
+import (
+	"fmt"
+	"go-cdc/internal/log"
+	"go-cdc/internal/syncdb"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	superviseInterval = time.Second      // 检查增量服务状态的间隔
+	restartMaxBackoff = 5 * time.Minute  // 重启退避上限
+	stableRunDuration = 10 * time.Minute // 连续运行超过该时长后重置退避
+)
+
+// Supervisor 为每个启用的数据源运行一个增量服务，服务退出后按退避策略重启
+type Supervisor struct {
+	consumer IncrementalConsumer
+	services map[string]IncrementalService
+	lock     sync.Mutex
+	stopped  bool
+	stopCh   chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+func NewSupervisor(consumer IncrementalConsumer) *Supervisor {
+	return &Supervisor{
+		consumer: consumer,
+		services: make(map[string]IncrementalService),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Add 为数据源创建增量服务并立即启动守护，增量起点取自数据源的 LastPos
+func (s *Supervisor) Add(holder *syncdb.DataSourceHolder) error {
+	if !holder.Config.IsEnabled() || !holder.IsMysql() {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return fmt.Errorf("supervisor stopped")
+	}
+	if _, ok := s.services[holder.Config.ID]; ok {
+		return fmt.Errorf("datasource %s is already supervised", holder.Config.ID)
+	}
+	service, err := NewMySQLIncrementalService(holder, s.consumer)
+	if err != nil {
+		return err
+	}
+	s.services[holder.Config.ID] = service
+	s.wg.Add(1)
+	go s.supervise(holder.Config.ID, service)
+	return nil
+}
+
+func (s *Supervisor) supervise(id string, service IncrementalService) {
+	defer s.wg.Done()
+	backoff := superviseInterval
+	service.Run()
+	startedAt := time.Now()
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+		}
+		if service.IsRunning() {
+			continue
+		}
+		if time.Since(startedAt) > stableRunDuration {
+			backoff = superviseInterval
+		}
+		log.Log.Error("incremental service stopped, restart later", zap.String("datasource", id), zap.Duration("backoff", backoff))
+		select {
+		case <-s.stopCh:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, restartMaxBackoff)
+		service.Run()
+		startedAt = time.Now()
+	}
+}
+
+// IncrementalSnapshot 在数据源的增量服务中补读表的全量数据
+func (s *Supervisor) IncrementalSnapshot(datasourceID, schema, table string) error {
+	s.lock.Lock()
+	service, ok := s.services[datasourceID]
+	s.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("datasource %s is not supervised", datasourceID)
+	}
+	return service.IncrementalSnapshot(schema, table)
+}
+
+// Stop 停止守护协程后并发停止所有增量服务，等待位点落库后返回
+func (s *Supervisor) Stop() {
+	s.once.Do(func() {
+		s.lock.Lock()
+		s.stopped = true
+		s.lock.Unlock()
+		close(s.stopCh)
+		s.wg.Wait()
+		var wg sync.WaitGroup
+		for id, service := range s.services {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				service.Stop()
+				log.Log.Info("incremental service stopped", zap.String("datasource", id))
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,155 @@
+package cannal
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go-cdc/internal/model"
+	"io"
+	"os"
+	"time"
+)
+
+func init() {
+	// 行数据中除基本类型外可能出现的取值类型
+	gob.Register(time.Time{})
+}
+
+const (
+	defaultTxBufferSize = 10000 // 单个事务默认在内存中缓存的事件数
+	txFlushBatchSize    = 1000  // 溢写文件回放时每批投递的事件数
+)
+
+// TxBuffer 事务事件缓冲区，事务提交前暂存行事件，超过内存上限后溢写到临时文件。
+// 溢写的事件以 gob 编码，回放后取值的类型不变；二进制列以字符串保存且不一定是合法的 UTF-8，不能用 JSON 编码
+type TxBuffer struct {
+	maxMemEvents int
+	spillDir     string
+	events       []*model.Event
+	file         *os.File
+	writer       *bufio.Writer
+	enc          *gob.Encoder // 同一个溢写文件使用同一个编码器，类型信息只写一次
+	spilled      int
+}
+
+func NewTxBuffer(maxMemEvents int, spillDir string) *TxBuffer {
+	if maxMemEvents <= 0 {
+		maxMemEvents = defaultTxBufferSize
+	}
+	return &TxBuffer{
+		maxMemEvents: maxMemEvents,
+		spillDir:     spillDir,
+		events:       make([]*model.Event, 0, 64),
+	}
+}
+
+// Len 缓冲区中的事件总数（含已溢写部分）
+func (b *TxBuffer) Len() int {
+	return b.spilled + len(b.events)
+}
+
+// Append 追加事件，内存中事件数达到上限时整体溢写到磁盘
+func (b *TxBuffer) Append(events ...*model.Event) error {
+	b.events = append(b.events, events...)
+	if len(b.events) < b.maxMemEvents {
+		return nil
+	}
+	return b.spill()
+}
+
+func (b *TxBuffer) spill() error {
+	if b.file == nil {
+		file, err := os.CreateTemp(b.spillDir, "go-cdc-tx-*.gob")
+		if err != nil {
+			return fmt.Errorf("create tx spill file err: %w", err)
+		}
+		b.file = file
+		b.writer = bufio.NewWriter(file)
+		b.enc = gob.NewEncoder(b.writer)
+	}
+	for _, ev := range b.events {
+		if err := b.enc.Encode(ev); err != nil {
+			return fmt.Errorf("spill tx event err: %w", err)
+		}
+	}
+	b.spilled += len(b.events)
+	b.events = b.events[:0]
+	return nil
+}
+
+// Flush 按写入顺序分批投递全部事件，先回放溢写文件再投递内存部分，完成后清空缓冲区。
+// first、last 标记事务的第一批和最后一批，没有溢写时只有一批
+func (b *TxBuffer) Flush(fn func(events []*model.Event, first, last bool) error) error {
+	defer b.Reset()
+	first := true
+	if b.file != nil {
+		if err := b.replay(fn); err != nil {
+			return err
+		}
+		first = false
+	}
+	if len(b.events) == 0 {
+		return nil
+	}
+	return fn(b.events, first, true)
+}
+
+func (b *TxBuffer) replay(fn func(events []*model.Event, first, last bool) error) error {
+	if err := b.writer.Flush(); err != nil {
+		return fmt.Errorf("flush tx spill file err: %w", err)
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seek tx spill file err: %w", err)
+	}
+	dec := gob.NewDecoder(bufio.NewReader(b.file))
+	batch := make([]*model.Event, 0, txFlushBatchSize)
+	decoded := 0
+	// 溢写文件的最后一批之后没有内存中的事件时即为事务的最后一批
+	emit := func() error {
+		first := decoded == len(batch)
+		last := decoded == b.spilled && len(b.events) == 0
+		return fn(batch, first, last)
+	}
+	for {
+		ev := &model.Event{}
+		err := dec.Decode(ev)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("decode tx spill file err: %w", err)
+		}
+		batch = append(batch, ev)
+		decoded++
+		if len(batch) == txFlushBatchSize {
+			if err := emit(); err != nil {
+				return err
+			}
+			batch = make([]*model.Event, 0, txFlushBatchSize)
+		}
+	}
+	if decoded != b.spilled {
+		return fmt.Errorf("tx spill file has %d events, expected %d", decoded, b.spilled)
+	}
+	if len(batch) > 0 {
+		return emit()
+	}
+	return nil
+}
+
+// Reset 丢弃缓冲区内容并删除溢写文件，内存部分换用新的切片，已投递给消费者的切片不会被下一个事务覆盖
+func (b *TxBuffer) Reset() {
+	if len(b.events) > 0 {
+		b.events = make([]*model.Event, 0, 64)
+	}
+	b.spilled = 0
+	if b.file != nil {
+		name := b.file.Name()
+		_ = b.file.Close()
+		_ = os.Remove(name)
+		b.file = nil
+		b.writer = nil
+		b.enc = nil
+	}
+}
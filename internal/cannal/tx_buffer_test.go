@@ -0,0 +1,126 @@
+package cannal
+
+import (
+	"go-cdc/internal/model"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type txBatch struct {
+	size        int
+	first, last bool
+}
+
+func TestTxBufferFlushBatches(t *testing.T) {
+	cases := []struct {
+		name   string
+		maxMem int
+		total  int
+		want   []txBatch
+	}{
+		{"in memory", 100, 10, []txBatch{{10, true, true}}},
+		{"spilled with memory tail", 100, 2530, []txBatch{{1000, true, false}, {1000, false, false}, {500, false, false}, {30, false, true}}},
+		{"spilled exactly", 100, 2000, []txBatch{{1000, true, false}, {1000, false, true}}},
+		{"spilled short", 100, 300, []txBatch{{300, true, true}}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := NewTxBuffer(c.maxMem, t.TempDir())
+			for i := 0; i < c.total; i++ {
+				if err := b.Append(&model.Event{Op: "insert", Pos: strconv.Itoa(i)}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if b.Len() != c.total {
+				t.Fatalf("len got %d, want %d", b.Len(), c.total)
+			}
+			var got []txBatch
+			next := 0
+			err := b.Flush(func(events []*model.Event, first, last bool) error {
+				got = append(got, txBatch{len(events), first, last})
+				for _, ev := range events {
+					if ev.Pos != strconv.Itoa(next) {
+						t.Fatalf("event %d out of order: %s", next, ev.Pos)
+					}
+					next++
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if next != c.total {
+				t.Fatalf("delivered %d events, want %d", next, c.total)
+			}
+			if len(got) != len(c.want) {
+				t.Fatalf("batches got %v, want %v", got, c.want)
+			}
+			for i := range got {
+				if got[i] != c.want[i] {
+					t.Fatalf("batches got %v, want %v", got, c.want)
+				}
+			}
+			if b.Len() != 0 || b.file != nil {
+				t.Fatal("buffer not reset after flush")
+			}
+		})
+	}
+}
+
+func TestTxBufferFlushKeepsDeliveredSlice(t *testing.T) {
+	b := NewTxBuffer(100, t.TempDir())
+	_ = b.Append(&model.Event{Pos: "a"})
+	var delivered []*model.Event
+	_ = b.Flush(func(events []*model.Event, first, last bool) error {
+		delivered = events
+		return nil
+	})
+	_ = b.Append(&model.Event{Pos: "b"})
+	if delivered[0].Pos != "a" {
+		t.Fatalf("delivered slice overwritten by the next transaction: %s", delivered[0].Pos)
+	}
+}
+
+func TestTxBufferSpillKeepsValues(t *testing.T) {
+	binary := string([]byte{0xff, 0x00, 0x10})
+	data := map[string]interface{}{
+		"bin":   binary,
+		"blob":  []byte{0xff, 0xfe},
+		"null":  nil,
+		"int":   int64(-3),
+		"big":   uint64(math.MaxUint64),
+		"float": 1.5,
+		"ts":    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	b := NewTxBuffer(1, t.TempDir())
+	for i := 0; i < 3; i++ {
+		if err := b.Append(&model.Event{Op: "update", Pos: strconv.Itoa(i), Data: data, Before: map[string]interface{}{"bin": binary}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.spilled == 0 {
+		t.Fatal("events not spilled")
+	}
+	var got []*model.Event
+	err := b.Flush(func(events []*model.Event, first, last bool) error {
+		got = append(got, events...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3", len(got))
+	}
+	for _, ev := range got {
+		if !reflect.DeepEqual(ev.Data, data) {
+			t.Fatalf("data changed after replay: %#v", ev.Data)
+		}
+		if ev.Before["bin"] != binary {
+			t.Fatalf("before changed after replay: %q", ev.Before["bin"])
+		}
+	}
+}
@@ -3,10 +3,65 @@ package model
 type Event struct {
 	DataSource string                 // 数据源ID
 	Table      string                 // table name
-	Op         string                 // insert, update, delete
+	Op         string                 // insert, update, delete, ddl, read, snapshot_complete
 	Data       map[string]interface{} // insert or update after data snapshot
 	Before     map[string]interface{} // update or delete before data snapshot
 	Ts         int64                  // unix timestamp
 	Pos        string                 // position
 	Schema     string                 // schema name
+	DDL        *DDLEvent              // ddl event, only for op = ddl
+	Keys       []string               // 标识行的主键列，为空表示表没有主键，update/delete 按 Before 全部列定位行
+}
+
+// OpSnapshotComplete 数据源全量完成标记，Pos 为全量结束位点 Gfinal，之后的事件均来自增量
+const OpSnapshotComplete = "snapshot_complete"
+
+// OpRead 快照读取的行，增量快照的行与增量事件交错投递，全量的行续传时可能重复，下游按主键 upsert
+const OpRead = "read"
+
+const (
+	DDLCreateTable    = "create_table"
+	DDLAlterTable     = "alter_table"
+	DDLDropTable      = "drop_table"
+	DDLRenameTable    = "rename_table"
+	DDLTruncateTable  = "truncate_table"
+	DDLCreateIndex    = "create_index"
+	DDLDropIndex      = "drop_index"
+	DDLCreateDatabase = "create_database"
+	DDLDropDatabase   = "drop_database"
+)
+
+// DDLEvent 结构化的 DDL 事件，一条语句涉及多张表时拆分为多个事件
+type DDLEvent struct {
+	Kind            string          // DDL 类型，见 DDL* 常量
+	Schema          string          // 受影响的库
+	Table           string          // 受影响的表，库级 DDL 为空
+	NewSchema       string          // rename table 的目标库
+	NewTable        string          // rename table 的目标表
+	LikeSchema      string          // create table ... like 的源库
+	LikeTable       string          // create table ... like 的源表
+	Columns         []*ColumnDef    // create table 的全部列
+	AddedColumns    []*ColumnDef    // alter table add column
+	DroppedColumns  []string        // alter table drop column
+	ModifiedColumns []*ColumnDef    // alter table modify/change column，change 时 OldName 为原列名
+	RenamedColumns  []*ColumnRename // alter table rename column
+	PrimaryKey      []string        // create table 或 add primary key 的主键列
+	DropPrimaryKey  bool            // alter table drop primary key
+	Query           string          // 原始 DDL 语句
+}
+
+// ColumnDef DDL 中的列定义
+type ColumnDef struct {
+	Name     string // 列名
+	OldName  string // change column 的原列名
+	Type     string // 列类型，如 varchar(255)、int unsigned
+	Nullable bool   // 是否允许 NULL
+	First    bool   // 位置 FIRST
+	After    string // 位置 AFTER 的列
+}
+
+// ColumnRename 列重命名
+type ColumnRename struct {
+	From string
+	To   string
 }
@@ -1,77 +1,312 @@
 package model
 
 import (
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
 
+// GTID MySQL GTID 集合，key 为 server uuid，value 为按起点升序、互不相交且不相邻的闭区间
+// 所有修改操作完成后集合都保持规范化，String 输出与 MySQL gtid_executed 格式一致
 type GTID map[string][]*RangeGTID
 
-func ParseGTID(pos map[string][]string) *GTID {
-	m := make(map[string][]*RangeGTID, len(pos))
-	for k, v := range pos {
-		m[k] = make([]*RangeGTID, len(v))
-		for i, str := range v {
-			split := strings.Split(str, "-")
-			start, _ := strconv.ParseInt(split[0], 10, 64)
-			end, _ := strconv.ParseInt(split[1], 10, 64)
-
-			r := &RangeGTID{
-				Start: start,
-				End:   end,
+type RangeGTID struct {
+	Start int64
+	End   int64
+}
+
+// ParseGTIDSet 解析 MySQL 格式的 GTID 集合，如 uuid1:1-5:7,uuid2:1-100，空串返回空集合
+func ParseGTIDSet(str string) (*GTID, error) {
+	gtid := GTID{}
+	str = strings.TrimSpace(strings.ReplaceAll(str, "\n", ""))
+	if str == "" {
+		return &gtid, nil
+	}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid gtid set item %q", item)
+		}
+		uuid := strings.ToLower(parts[0])
+		for _, interval := range parts[1:] {
+			r, err := parseRange(interval)
+			if err != nil {
+				return nil, fmt.Errorf("invalid gtid set item %q: %w", item, err)
+			}
+			gtid[uuid] = append(gtid[uuid], r)
+		}
+	}
+	gtid.normalize()
+	return &gtid, nil
+}
+
+// parseRange 解析 1-5 或单个事务 5
+func parseRange(str string) (*RangeGTID, error) {
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(str), "-")
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	end := start
+	if found {
+		if end, err = strconv.ParseInt(endStr, 10, 64); err != nil {
+			return nil, err
+		}
+	}
+	if start <= 0 || end < start {
+		return nil, fmt.Errorf("invalid interval %q", str)
+	}
+	return &RangeGTID{Start: start, End: end}, nil
+}
+
+// UnmarshalGTID 解析元数据表中以 JSON 存储的 GTID 集合
+func UnmarshalGTID(str string) (*GTID, error) {
+	gtid := GTID{}
+	if str == "" || str == "null" {
+		return &gtid, nil
+	}
+	if err := json.Unmarshal([]byte(str), &gtid); err != nil {
+		return nil, fmt.Errorf("unmarshal gtid %s err: %w", str, err)
+	}
+	return &gtid, nil
+}
+
+// UnmarshalJSON 兼容 {"uuid":[{"Start":1,"End":5}]} 与 "uuid:1-5" 两种存储格式，解析后规范化
+func (gtid *GTID) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var str string
+		if err := json.Unmarshal(b, &str); err != nil {
+			return err
+		}
+		parsed, err := ParseGTIDSet(str)
+		if err != nil {
+			return err
+		}
+		*gtid = *parsed
+		return nil
+	}
+	m := map[string][]*RangeGTID{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	res := make(GTID, len(m))
+	for k, v := range m {
+		for _, r := range v {
+			if r == nil || r.Start <= 0 || r.End < r.Start {
+				return fmt.Errorf("invalid gtid interval of %s", k)
 			}
-			m[k][i] = r
+		}
+		k = strings.ToLower(k)
+		res[k] = append(res[k], v...)
+	}
+	res.normalize()
+	*gtid = res
+	return nil
+}
+
+// normalize 区间排序并合并重叠或相邻的区间，删除空的 uuid
+func (gtid GTID) normalize() {
+	for k, v := range gtid {
+		gtid[k] = mergeRanges(v)
+		if len(gtid[k]) == 0 {
+			delete(gtid, k)
 		}
 	}
-	gtid := GTID(m)
-	return &gtid
+}
+
+func mergeRanges(ranges []*RangeGTID) []*RangeGTID {
+	if len(ranges) == 0 {
+		return nil
+	}
+	sorted := make([]*RangeGTID, len(ranges))
+	for i, r := range ranges {
+		sorted[i] = &RangeGTID{Start: r.Start, End: r.End}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+	merged := sorted[:1]
+	for _, r := range sorted[1:] {
+		last := merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// Clone 深拷贝 GTID 集合
+func (gtid *GTID) Clone() *GTID {
+	if gtid == nil {
+		return &GTID{}
+	}
+	m := make(GTID, len(*gtid))
+	for k, v := range *gtid {
+		ranges := make([]*RangeGTID, len(v))
+		for i, r := range v {
+			ranges[i] = &RangeGTID{Start: r.Start, End: r.End}
+		}
+		m[k] = ranges
+	}
+	return &m
+}
+
+// IsEmpty 集合是否为空
+func (gtid *GTID) IsEmpty() bool {
+	return gtid == nil || len(*gtid) == 0
+}
+
+// uuids 升序返回集合中的 server uuid，保证输出稳定
+func (gtid *GTID) uuids() []string {
+	keys := make([]string, 0, len(*gtid))
+	for k := range *gtid {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (gtid *GTID) ToMap() map[string]string {
 	m := make(map[string]string, len(*gtid))
 	for k, v := range *gtid {
-		m[k] = k
-		for _, r := range v {
-			m[k] += fmt.Sprintf(":%d-%d", r.Start, r.End)
-		}
+		m[k] = k + ":" + formatRanges(v)
 	}
 	return m
 }
 
 func (gtid *GTID) String() string {
-	var sb strings.Builder
-	for k, v := range *gtid {
-		sb.WriteString(k)
-		sb.WriteString(":")
-		for i, r := range v {
-			sb.WriteString(fmt.Sprintf("%d-%d", r.Start, r.End))
-			if i < len(v)-1 {
-				sb.WriteString(",")
-			}
+	if gtid.IsEmpty() {
+		return ""
+	}
+	items := make([]string, 0, len(*gtid))
+	for _, k := range gtid.uuids() {
+		items = append(items, k+":"+formatRanges((*gtid)[k]))
+	}
+	return strings.Join(items, ",")
+}
+
+func formatRanges(ranges []*RangeGTID) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		if r.Start == r.End {
+			parts[i] = strconv.FormatInt(r.Start, 10)
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r.Start, r.End)
 		}
-		sb.WriteString(",")
 	}
-	return sb.String()[:sb.Len()-1]
+	return strings.Join(parts, ":")
 }
 
+// SetGTID 将单个事务 uuid:gno 加入集合，并与相邻区间合并
 func (gtid *GTID) SetGTID(uuid string, gno int64) {
 	m := *gtid
-	rangeGTIDS, ok := m[uuid]
-	if !ok {
-		m[uuid] = []*RangeGTID{{Start: gno, End: gno}}
-		return
+	uuid = strings.ToLower(uuid)
+	ranges := m[uuid]
+	// 增量同步中 gno 通常递增，优先尝试扩展最后一个区间
+	if n := len(ranges); n > 0 {
+		last := ranges[n-1]
+		if gno >= last.Start && gno <= last.End {
+			return
+		}
+		if last.End+1 == gno {
+			last.End = gno
+			return
+		}
+		if gno > last.End {
+			m[uuid] = append(ranges, &RangeGTID{Start: gno, End: gno})
+			return
+		}
 	}
-	length := len(rangeGTIDS)
-	rangeGTID := rangeGTIDS[length-1]
-	if rangeGTID.End+1 == gno {
-		rangeGTID.End = gno
-		return
+	m[uuid] = mergeRanges(append(ranges, &RangeGTID{Start: gno, End: gno}))
+}
+
+// Contains 判断 uuid:gno 是否已包含在集合中
+func (gtid *GTID) Contains(uuid string, gno int64) bool {
+	if gtid.IsEmpty() {
+		return false
 	}
-	m[uuid] = append(rangeGTIDS, &RangeGTID{Start: gno, End: gno})
+	ranges := (*gtid)[strings.ToLower(uuid)]
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].End >= gno })
+	return i < len(ranges) && ranges[i].Start <= gno
 }
 
-type RangeGTID struct {
-	Start int64
-	End   int64
+// Union 返回两个集合的并集
+func (gtid *GTID) Union(other *GTID) *GTID {
+	res := gtid.Clone()
+	if other.IsEmpty() {
+		return res
+	}
+	for k, v := range *other {
+		(*res)[k] = append((*res)[k], v...)
+	}
+	res.normalize()
+	return res
+}
+
+// Subtract 返回 gtid 中不属于 other 的部分
+func (gtid *GTID) Subtract(other *GTID) *GTID {
+	res := GTID{}
+	if gtid.IsEmpty() {
+		return &res
+	}
+	for k, v := range *gtid {
+		var rest []*RangeGTID
+		if other.IsEmpty() {
+			rest = v
+		} else {
+			rest = subtractRanges(v, (*other)[k])
+		}
+		if len(rest) > 0 {
+			res[k] = rest
+		}
+	}
+	return res.Clone()
+}
+
+func subtractRanges(a, b []*RangeGTID) []*RangeGTID {
+	var res []*RangeGTID
+	j := 0
+	for _, r := range a {
+		start, end := r.Start, r.End
+		for j < len(b) && b[j].End < start {
+			j++
+		}
+		for k := j; k < len(b) && b[k].Start <= end; k++ {
+			if b[k].Start > start {
+				res = append(res, &RangeGTID{Start: start, End: b[k].Start - 1})
+			}
+			start = b[k].End + 1
+			if start > end {
+				break
+			}
+		}
+		if start <= end {
+			res = append(res, &RangeGTID{Start: start, End: end})
+		}
+	}
+	return res
+}
+
+// Intersect 返回两个集合的交集
+func (gtid *GTID) Intersect(other *GTID) *GTID {
+	if other.IsEmpty() {
+		return &GTID{}
+	}
+	return gtid.Subtract(gtid.Subtract(other))
+}
+
+// IsSubsetOf 判断 gtid 是否为 other 的子集
+func (gtid *GTID) IsSubsetOf(other *GTID) bool {
+	return gtid.Subtract(other).IsEmpty()
+}
+
+// Equal 判断两个集合是否相同
+func (gtid *GTID) Equal(other *GTID) bool {
+	return gtid.IsSubsetOf(other) && other.IsSubsetOf(gtid)
 }
@@ -0,0 +1,199 @@
+package model
+
+import "testing"
+
+const (
+	uuidA = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+	uuidB = "8a94f357-aab4-11df-86ab-c80aa9429562"
+)
+
+func mustParseGTID(t *testing.T, str string) *GTID {
+	t.Helper()
+	gtid, err := ParseGTIDSet(str)
+	if err != nil {
+		t.Fatalf("parse %q: %v", str, err)
+	}
+	return gtid
+}
+
+func TestParseGTIDSet(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"single", uuidA + ":5", uuidA + ":5"},
+		{"adjacent ranges merge", uuidA + ":1-5:6-10", uuidA + ":1-10"},
+		{"overlapping ranges merge", uuidA + ":1-5:3-8", uuidA + ":1-8"},
+		{"unsorted ranges", uuidA + ":20-30:1-5", uuidA + ":1-5:20-30"},
+		{"contained range", uuidA + ":1-10:3-4", uuidA + ":1-10"},
+		{"upper case uuid", "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-3", uuidA + ":1-3"},
+		{"multiple uuids sorted", uuidB + ":1-3," + uuidA + ":7", uuidA + ":7," + uuidB + ":1-3"},
+		{"same uuid twice", uuidA + ":1-3," + uuidA + ":4-6", uuidA + ":1-6"},
+		{"newlines from gtid_executed", uuidA + ":1-3,\n" + uuidB + ":1", uuidA + ":1-3," + uuidB + ":1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := mustParseGTID(t, c.in).String()
+			if got != c.want {
+				t.Fatalf("got %q, want %q", got, c.want)
+			}
+			// String 的输出可以原样解析回来
+			if again := mustParseGTID(t, got).String(); again != got {
+				t.Fatalf("round trip got %q, want %q", again, got)
+			}
+		})
+	}
+}
+
+func TestParseGTIDSetInvalid(t *testing.T) {
+	for _, in := range []string{uuidA, uuidA + ":0", uuidA + ":5-3", uuidA + ":x", uuidA + ":1-"} {
+		if _, err := ParseGTIDSet(in); err == nil {
+			t.Errorf("parse %q: expected error", in)
+		}
+	}
+}
+
+func TestGTIDSetAlgebra(t *testing.T) {
+	cases := []struct {
+		name      string
+		a, b      string
+		union     string
+		subtract  string
+		intersect string
+		subset    bool
+	}{
+		{
+			name:      "adjacent",
+			a:         uuidA + ":1-5",
+			b:         uuidA + ":6-10",
+			union:     uuidA + ":1-10",
+			subtract:  uuidA + ":1-5",
+			intersect: "",
+		},
+		{
+			name:      "overlapping",
+			a:         uuidA + ":1-8",
+			b:         uuidA + ":5-12",
+			union:     uuidA + ":1-12",
+			subtract:  uuidA + ":1-4",
+			intersect: uuidA + ":5-8",
+		},
+		{
+			name:      "subtract to empty",
+			a:         uuidA + ":3-7",
+			b:         uuidA + ":1-10",
+			union:     uuidA + ":1-10",
+			subtract:  "",
+			intersect: uuidA + ":3-7",
+			subset:    true,
+		},
+		{
+			name:      "hole in the middle",
+			a:         uuidA + ":1-10",
+			b:         uuidA + ":4-6",
+			union:     uuidA + ":1-10",
+			subtract:  uuidA + ":1-3:7-10",
+			intersect: uuidA + ":4-6",
+		},
+		{
+			name:      "multiple uuids",
+			a:         uuidA + ":1-10," + uuidB + ":1-5",
+			b:         uuidA + ":1-10," + uuidB + ":3",
+			union:     uuidA + ":1-10," + uuidB + ":1-5",
+			subtract:  uuidB + ":1-2:4-5",
+			intersect: uuidA + ":1-10," + uuidB + ":3",
+		},
+		{
+			name:      "disjoint uuids",
+			a:         uuidA + ":1-3",
+			b:         uuidB + ":1-3",
+			union:     uuidA + ":1-3," + uuidB + ":1-3",
+			subtract:  uuidA + ":1-3",
+			intersect: "",
+		},
+		{
+			name:      "empty other",
+			a:         uuidA + ":1-3",
+			b:         "",
+			union:     uuidA + ":1-3",
+			subtract:  uuidA + ":1-3",
+			intersect: "",
+		},
+		{
+			name:      "empty self",
+			a:         "",
+			b:         uuidA + ":1-3",
+			union:     uuidA + ":1-3",
+			subtract:  "",
+			intersect: "",
+			subset:    true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			a, b := mustParseGTID(t, c.a), mustParseGTID(t, c.b)
+			if got := a.Union(b).String(); got != c.union {
+				t.Errorf("union got %q, want %q", got, c.union)
+			}
+			if got := a.Subtract(b).String(); got != c.subtract {
+				t.Errorf("subtract got %q, want %q", got, c.subtract)
+			}
+			if got := a.Intersect(b).String(); got != c.intersect {
+				t.Errorf("intersect got %q, want %q", got, c.intersect)
+			}
+			if got := a.IsSubsetOf(b); got != c.subset {
+				t.Errorf("subset got %v, want %v", got, c.subset)
+			}
+			// 运算不修改操作数
+			if a.String() != mustParseGTID(t, c.a).String() || b.String() != mustParseGTID(t, c.b).String() {
+				t.Errorf("operands modified: %q, %q", a, b)
+			}
+		})
+	}
+}
+
+func TestGTIDSetGTID(t *testing.T) {
+	gtid := mustParseGTID(t, uuidA+":1-3:7")
+	for _, gno := range []int64{4, 2, 10, 5, 6} {
+		gtid.SetGTID(uuidA, gno)
+	}
+	if got, want := gtid.String(), uuidA+":1-7:10"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	gtid.SetGTID(uuidB, 1)
+	for _, c := range []struct {
+		uuid string
+		gno  int64
+		want bool
+	}{
+		{uuidA, 1, true}, {uuidA, 7, true}, {uuidA, 8, false}, {uuidA, 10, true}, {uuidA, 11, false},
+		{uuidB, 1, true}, {uuidB, 2, false}, {"3E11FA47-71CA-11E1-9E33-C80AA9429562", 5, true},
+	} {
+		if got := gtid.Contains(c.uuid, c.gno); got != c.want {
+			t.Errorf("contains %s:%d got %v, want %v", c.uuid, c.gno, got, c.want)
+		}
+	}
+}
+
+func TestUnmarshalGTID(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"null", ""},
+		{`{"` + uuidA + `":[{"Start":6,"End":10},{"Start":1,"End":5}]}`, uuidA + ":1-10"},
+		{`"` + uuidA + `:1-3:5"`, uuidA + ":1-3:5"},
+	}
+	for _, c := range cases {
+		gtid, err := UnmarshalGTID(c.in)
+		if err != nil {
+			t.Fatalf("unmarshal %s: %v", c.in, err)
+		}
+		if got := gtid.String(); got != c.want {
+			t.Errorf("unmarshal %s got %q, want %q", c.in, got, c.want)
+		}
+	}
+}
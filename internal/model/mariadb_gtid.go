@@ -0,0 +1,108 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MariadbGTID MariaDB GTID 位置，每个复制域只保留最新的 server_id-seq_no，
+// 格式与 @@gtid_current_pos 一致，如 0-1-100,1-2-50
+type MariadbGTID map[uint32]*MariadbGTIDItem
+
+type MariadbGTIDItem struct {
+	DomainID uint32
+	ServerID uint32
+	SeqNo    uint64
+}
+
+func (item MariadbGTIDItem) String() string {
+	return fmt.Sprintf("%d-%d-%d", item.DomainID, item.ServerID, item.SeqNo)
+}
+
+// ParseMariadbGTID 解析 domain-server-seq 形式的 MariaDB GTID 位置，空串返回空位置
+func ParseMariadbGTID(str string) (*MariadbGTID, error) {
+	gtid := MariadbGTID{}
+	str = strings.TrimSpace(strings.ReplaceAll(str, "\n", ""))
+	if str == "" {
+		return &gtid, nil
+	}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, "-")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid mariadb gtid %q", item)
+		}
+		domain, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mariadb gtid %q: %w", item, err)
+		}
+		server, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mariadb gtid %q: %w", item, err)
+		}
+		seq, err := strconv.ParseUint(parts[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mariadb gtid %q: %w", item, err)
+		}
+		gtid.Update(uint32(domain), uint32(server), seq)
+	}
+	return &gtid, nil
+}
+
+// Update 记录复制域中已执行的事务，同一复制域只保留序号更大的一条
+func (gtid *MariadbGTID) Update(domain, server uint32, seq uint64) {
+	m := *gtid
+	if item, ok := m[domain]; ok && item.SeqNo >= seq {
+		return
+	}
+	m[domain] = &MariadbGTIDItem{DomainID: domain, ServerID: server, SeqNo: seq}
+}
+
+// Contains 判断事务是否已执行，MariaDB 同一复制域内序号单调递增
+func (gtid *MariadbGTID) Contains(domain uint32, seq uint64) bool {
+	if gtid.IsEmpty() {
+		return false
+	}
+	item, ok := (*gtid)[domain]
+	return ok && seq <= item.SeqNo
+}
+
+// IsEmpty 位置是否为空
+func (gtid *MariadbGTID) IsEmpty() bool {
+	return gtid == nil || len(*gtid) == 0
+}
+
+// Clone 深拷贝 MariaDB GTID 位置
+func (gtid *MariadbGTID) Clone() *MariadbGTID {
+	m := MariadbGTID{}
+	if gtid == nil {
+		return &m
+	}
+	for k, v := range *gtid {
+		item := *v
+		m[k] = &item
+	}
+	return &m
+}
+
+// String 按复制域升序输出
+func (gtid *MariadbGTID) String() string {
+	if gtid.IsEmpty() {
+		return ""
+	}
+	domains := make([]uint32, 0, len(*gtid))
+	for k := range *gtid {
+		domains = append(domains, k)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i] < domains[j] })
+	items := make([]string, len(domains))
+	for i, d := range domains {
+		items[i] = (*gtid)[d].String()
+	}
+	return strings.Join(items, ",")
+}
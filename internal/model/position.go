@@ -0,0 +1,256 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	PosModeGTID    = "gtid"         // 基于 GTID 集合的位点
+	PosModeFile    = "file"         // 基于 binlog 文件名和偏移量的位点，用于未开启 GTID 的实例
+	PosModeMariaDB = "mariadb_gtid" // 基于 MariaDB domain-server-seq GTID 的位点
+)
+
+// BinlogPos binlog 文件位点
+type BinlogPos struct {
+	File string `json:"file"`
+	Pos  uint32 `json:"pos"`
+}
+
+// Compare 比较两个位点的先后，文件名按序号比较
+func (p BinlogPos) Compare(o BinlogPos) int {
+	if p.File != o.File {
+		pb, pn := splitBinlogName(p.File)
+		ob, on := splitBinlogName(o.File)
+		if pb == ob && pn != on {
+			if pn < on {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(p.File, o.File)
+	}
+	switch {
+	case p.Pos < o.Pos:
+		return -1
+	case p.Pos > o.Pos:
+		return 1
+	}
+	return 0
+}
+
+func (p BinlogPos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Pos)
+}
+
+// splitBinlogName 拆分 mysql-bin.000123 为基础名和序号
+func splitBinlogName(name string) (string, int64) {
+	idx := strings.LastIndex(name, ".")
+	if idx < 0 {
+		return name, 0
+	}
+	n, err := strconv.ParseInt(name[idx+1:], 10, 64)
+	if err != nil {
+		return name, 0
+	}
+	return name[:idx], n
+}
+
+// Position 增量同步位点，Mode 决定使用 GTID 集合、MariaDB GTID 还是文件位点
+type Position struct {
+	Mode        string
+	GTID        *GTID
+	MariadbGTID *MariadbGTID
+	BinlogPos   *BinlogPos
+}
+
+func NewGTIDPosition(gtid *GTID) *Position {
+	return &Position{Mode: PosModeGTID, GTID: gtid}
+}
+
+func NewMariadbPosition(gtid *MariadbGTID) *Position {
+	return &Position{Mode: PosModeMariaDB, MariadbGTID: gtid}
+}
+
+func NewFilePosition(pos BinlogPos) *Position {
+	return &Position{Mode: PosModeFile, BinlogPos: &pos}
+}
+
+// ParsePosition 解析元数据表中按 mode 以 JSON 存储的位点，mode 为空时按 GTID 处理以兼容旧数据
+func ParsePosition(mode, str string) (*Position, error) {
+	switch mode {
+	case PosModeFile:
+		pos := &BinlogPos{}
+		if str != "" && str != "null" {
+			if err := json.Unmarshal([]byte(str), pos); err != nil {
+				return nil, fmt.Errorf("unmarshal binlog pos %s err: %w", str, err)
+			}
+		}
+		return &Position{Mode: PosModeFile, BinlogPos: pos}, nil
+	case PosModeMariaDB:
+		gtid := &MariadbGTID{}
+		if str != "" && str != "null" {
+			if err := json.Unmarshal([]byte(str), gtid); err != nil {
+				return nil, fmt.Errorf("unmarshal mariadb gtid %s err: %w", str, err)
+			}
+		}
+		return NewMariadbPosition(gtid), nil
+	case PosModeGTID, "":
+		gtid, err := UnmarshalGTID(str)
+		if err != nil {
+			return nil, err
+		}
+		return NewGTIDPosition(gtid), nil
+	default:
+		return nil, fmt.Errorf("unknown position mode %s", mode)
+	}
+}
+
+// Marshal 位点序列化为 JSON，与 ParsePosition 对应
+func (p *Position) Marshal() string {
+	var v interface{}
+	switch p.Mode {
+	case PosModeFile:
+		v = p.BinlogPos
+	case PosModeMariaDB:
+		v = p.MariadbGTID
+	default:
+		v = p.GTID
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// IsEmpty 位点是否未初始化
+func (p *Position) IsEmpty() bool {
+	if p == nil {
+		return true
+	}
+	switch p.Mode {
+	case PosModeFile:
+		return p.BinlogPos == nil || p.BinlogPos.File == ""
+	case PosModeMariaDB:
+		return p.MariadbGTID.IsEmpty()
+	default:
+		return p.GTID.IsEmpty()
+	}
+}
+
+func (p *Position) String() string {
+	if p.IsEmpty() {
+		return ""
+	}
+	switch p.Mode {
+	case PosModeFile:
+		return p.BinlogPos.String()
+	case PosModeMariaDB:
+		return p.MariadbGTID.String()
+	default:
+		return p.GTID.String()
+	}
+}
+
+// CoveredBy 判断 p 是否已包含在 other 中，即 other 不早于 p，两者类型不同时返回 false
+func (p *Position) CoveredBy(other *Position) bool {
+	if p.IsEmpty() || other.IsEmpty() || p.Mode != other.Mode {
+		return false
+	}
+	switch p.Mode {
+	case PosModeFile:
+		return p.BinlogPos.Compare(*other.BinlogPos) <= 0
+	case PosModeMariaDB:
+		for domain, item := range *p.MariadbGTID {
+			if !other.MariadbGTID.Contains(domain, item.SeqNo) {
+				return false
+			}
+		}
+		return true
+	default:
+		return p.GTID.IsSubsetOf(other.GTID)
+	}
+}
+
+// MinPosition 返回各位点中最早的位置，即所有位点都已包含的部分：
+// GTID 取交集，MariaDB 取各位点都存在的复制域中最小的序号，文件位点取最小值
+func MinPosition(positions ...*Position) (*Position, error) {
+	return foldPositions(positions, func(a, b *Position) *Position {
+		switch a.Mode {
+		case PosModeFile:
+			if b.BinlogPos.Compare(*a.BinlogPos) < 0 {
+				return b.Clone()
+			}
+			return a
+		case PosModeMariaDB:
+			res := MariadbGTID{}
+			for domain, item := range *a.MariadbGTID {
+				other, ok := (*b.MariadbGTID)[domain]
+				if !ok {
+					continue
+				}
+				if other.SeqNo < item.SeqNo {
+					item = other
+				}
+				res.Update(item.DomainID, item.ServerID, item.SeqNo)
+			}
+			return NewMariadbPosition(&res)
+		}
+		return NewGTIDPosition(a.GTID.Intersect(b.GTID))
+	})
+}
+
+// MaxPosition 返回各位点中最晚的位置：GTID 取并集，MariaDB 取各复制域最大的序号，文件位点取最大值
+func MaxPosition(positions ...*Position) (*Position, error) {
+	return foldPositions(positions, func(a, b *Position) *Position {
+		switch a.Mode {
+		case PosModeFile:
+			if b.BinlogPos.Compare(*a.BinlogPos) > 0 {
+				return b.Clone()
+			}
+			return a
+		case PosModeMariaDB:
+			res := a.MariadbGTID.Clone()
+			for _, item := range *b.MariadbGTID {
+				res.Update(item.DomainID, item.ServerID, item.SeqNo)
+			}
+			return NewMariadbPosition(res)
+		}
+		return NewGTIDPosition(a.GTID.Union(b.GTID))
+	})
+}
+
+// foldPositions 依次合并非空位点，位点类型必须一致，全部为空时返回 nil
+func foldPositions(positions []*Position, fn func(a, b *Position) *Position) (*Position, error) {
+	var res *Position
+	for _, p := range positions {
+		if p.IsEmpty() {
+			continue
+		}
+		if res == nil {
+			res = p.Clone()
+			continue
+		}
+		if p.Mode != res.Mode {
+			return nil, fmt.Errorf("position mode mismatch: %s and %s", res.Mode, p.Mode)
+		}
+		res = fn(res, p)
+	}
+	return res, nil
+}
+
+// Clone 深拷贝位点
+func (p *Position) Clone() *Position {
+	res := &Position{Mode: p.Mode}
+	if p.GTID != nil {
+		res.GTID = p.GTID.Clone()
+	}
+	if p.MariadbGTID != nil {
+		res.MariadbGTID = p.MariadbGTID.Clone()
+	}
+	if p.BinlogPos != nil {
+		pos := *p.BinlogPos
+		res.BinlogPos = &pos
+	}
+	return res
+}
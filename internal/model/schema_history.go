@@ -0,0 +1,138 @@
+package model
+
+import (
+	"encoding/json"
+	"go-cdc/internal/db"
+	"go-cdc/internal/log"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SchemaHistory 表结构历史版本，由全量快照的建表语句初始化，之后每条 DDL 生成一个新版本
+type SchemaHistory struct {
+	ID           int64     `gorm:"column:id;primaryKey;autoIncrement:true;type:bigint;comment:表结构历史ID"`
+	DataSourceID string    `gorm:"column:data_source_id;type:varchar(50);comment:数据源ID;index:idx_schema_history"`
+	Sc           string    `gorm:"column:sc;type:varchar(50);comment:数据库名;index:idx_schema_history"`
+	Tb           string    `gorm:"column:tb;type:varchar(50);comment:表名;index:idx_schema_history"`
+	Version      int64     `gorm:"column:version;type:bigint;comment:表结构版本号，同一数据源内递增;index:idx_schema_history"`
+	Pos          string    `gorm:"column:pos;type:json;comment:该版本生效的binlog位置"`
+	PosMode      string    `gorm:"column:pos_mode;type:varchar(20);comment:位点类型 gtid/file/mariadb_gtid"`
+	Schema       string    `gorm:"column:schema_json;type:json;comment:列定义与主键"`
+	DDL          string    `gorm:"column:ddl;type:text;comment:产生该版本的DDL"`
+	Dropped      bool      `gorm:"column:dropped;comment:该版本起表已被删除"`
+	CreatedAt    time.Time `gorm:"column:created_at;comment:创建时间"`
+}
+
+func (SchemaHistory) TableName() string {
+	return "go_cdc_schema_history"
+}
+
+// TableSchema 某一版本的表结构，Columns 按表中的列顺序排列
+type TableSchema struct {
+	Columns    []*ColumnDef
+	PrimaryKey []string
+}
+
+// Clone 深拷贝表结构
+func (ts *TableSchema) Clone() *TableSchema {
+	res := &TableSchema{
+		Columns:    make([]*ColumnDef, len(ts.Columns)),
+		PrimaryKey: append([]string(nil), ts.PrimaryKey...),
+	}
+	for i, col := range ts.Columns {
+		c := *col
+		res.Columns[i] = &c
+	}
+	return res
+}
+
+// Position 解析版本生效的位点
+func (h *SchemaHistory) Position() (*Position, error) {
+	return ParsePosition(h.PosMode, h.Pos)
+}
+
+// TableSchema 解析版本的表结构
+func (h *SchemaHistory) TableSchema() (*TableSchema, error) {
+	ts := &TableSchema{}
+	if h.Schema == "" {
+		return ts, nil
+	}
+	if err := json.Unmarshal([]byte(h.Schema), ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func init() {
+	db.AutoTable(&SchemaHistory{})
+}
+
+var (
+	schemaHistoryServiceOnce sync.Once
+	schemaHistoryService     SchemaHistoryService
+	schemaHistoryLock        sync.Mutex // 串行分配版本号
+)
+
+type SchemaHistoryService struct{}
+
+func GetSchemaHistoryService() SchemaHistoryService {
+	schemaHistoryServiceOnce.Do(func() {
+		schemaHistoryService = SchemaHistoryService{}
+	})
+	return schemaHistoryService
+}
+
+// ListByDataSource 按版本升序查询数据源的全部表结构历史
+func (service SchemaHistoryService) ListByDataSource(datasourceID string) ([]*SchemaHistory, error) {
+	var list []*SchemaHistory
+	err := db.CDCDataSource.Model(&SchemaHistory{}).
+		Where("data_source_id = ?", datasourceID).
+		Order("version asc, id asc").Find(&list).Error
+	return list, err
+}
+
+// Save 记录表的新结构版本，同一位置重复写入（如重放 binlog）时返回已有版本
+func (service SchemaHistoryService) Save(datasourceID, sc, tb string, pos *Position, schema *TableSchema, ddl string, dropped bool) (*SchemaHistory, error) {
+	schemaHistoryLock.Lock()
+	defer schemaHistoryLock.Unlock()
+	var list []*SchemaHistory
+	err := db.CDCDataSource.Model(&SchemaHistory{}).
+		Where("data_source_id = ? and sc = ? and tb = ? and pos_mode = ?", datasourceID, sc, tb, pos.Mode).
+		Order("version desc").Find(&list).Error
+	if err != nil {
+		return nil, err
+	}
+	// json 列读出后格式可能与写入时不同，按解析后的位点比较
+	for _, existing := range list {
+		if p, err := existing.Position(); err == nil && p.String() == pos.String() && existing.Dropped == dropped {
+			return existing, nil
+		}
+	}
+
+	var maxVersion int64
+	if err := db.CDCDataSource.Model(&SchemaHistory{}).
+		Where("data_source_id = ?", datasourceID).
+		Select("coalesce(max(version), 0)").Scan(&maxVersion).Error; err != nil {
+		return nil, err
+	}
+	b, _ := json.Marshal(schema)
+	history := &SchemaHistory{
+		DataSourceID: datasourceID,
+		Sc:           sc,
+		Tb:           tb,
+		Version:      maxVersion + 1,
+		Pos:          pos.Marshal(),
+		PosMode:      pos.Mode,
+		Schema:       string(b),
+		DDL:          ddl,
+		Dropped:      dropped,
+		CreatedAt:    time.Now(),
+	}
+	if err := db.CDCDataSource.Create(history).Error; err != nil {
+		log.Log.Error("insert schema history failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return nil, err
+	}
+	return history, nil
+}
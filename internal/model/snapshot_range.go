@@ -0,0 +1,101 @@
+package model
+
+import (
+	"go-cdc/internal/db"
+	"go-cdc/internal/log"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// SnapshotRange 大表按主键首列切分后的一个读取范围，各范围独立快照、独立记录进度
+type SnapshotRange struct {
+	ID             int64  `gorm:"column:id;primaryKey;autoIncrement:true;type:bigint;comment:全量范围ID"`
+	DataSourceID   string `gorm:"column:data_source_id;type:varchar(50);comment:数据源ID;index:idx_snapshot_range"`
+	Sc             string `gorm:"column:sc;type:varchar(50);comment:数据库名;index:idx_snapshot_range"`
+	Tb             string `gorm:"column:tb;type:varchar(50);comment:表名;index:idx_snapshot_range"`
+	RangeNo        int    `gorm:"column:range_no;comment:范围序号"`
+	Col            string `gorm:"column:col;type:varchar(64);comment:切分列"`
+	Lower          string `gorm:"column:lower_bound;type:json;default:null;comment:范围下界（含），为空表示无下界"`
+	Upper          string `gorm:"column:upper_bound;type:json;default:null;comment:范围上界（不含），为空表示无上界"`
+	SnapshotStatus string `gorm:"column:snapshot_status;type:varchar(20);comment:全量状态 pending/running/done/failed"`
+	SnapshotPos    string `gorm:"column:snapshot_pos;type:json;default:null;comment:范围首次开启快照时的位点"`
+	PosMode        string `gorm:"column:pos_mode;type:varchar(20);comment:位点类型 gtid/file/mariadb_gtid"`
+	LastChunkPK    string `gorm:"column:last_chunk_pk;type:json;default:null;comment:最近一个已被消费的分块的主键"`
+	RowsCopied     int64  `gorm:"column:rows_copied;type:bigint;comment:已被消费的行数"`
+}
+
+func (SnapshotRange) TableName() string {
+	return "go_cdc_snapshot_range"
+}
+
+func init() {
+	db.AutoTable(&SnapshotRange{})
+}
+
+// ListSnapshotRanges 按序号查询表的读取范围
+func (service TableMetaService) ListSnapshotRanges(datasourceID, sc, tb string) ([]*SnapshotRange, error) {
+	var list []*SnapshotRange
+	err := db.CDCDataSource.Model(&SnapshotRange{}).
+		Where("data_source_id = ? and sc = ? and tb = ?", datasourceID, sc, tb).
+		Order("range_no asc").Find(&list).Error
+	return list, err
+}
+
+// SaveSnapshotRanges 替换表的读取范围，ranges 为空时删除表的读取范围
+func (service TableMetaService) SaveSnapshotRanges(datasourceID, sc, tb string, ranges []*SnapshotRange) error {
+	return db.CDCDataSource.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("data_source_id = ? and sc = ? and tb = ?", datasourceID, sc, tb).
+			Delete(&SnapshotRange{}).Error; err != nil {
+			return err
+		}
+		if len(ranges) == 0 {
+			return nil
+		}
+		return tx.Create(ranges).Error
+	})
+}
+
+// DeleteSnapshotRanges 删除数据源下所有表的读取范围
+func (service TableMetaService) DeleteSnapshotRanges(datasourceID string) error {
+	err := db.CDCDataSource.Where("data_source_id = ?", datasourceID).Delete(&SnapshotRange{}).Error
+	if err != nil {
+		log.Log.Error("delete snapshot ranges failed", zap.String("datasource", datasourceID), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+func (service TableMetaService) updateSnapshotRange(id int64, fields map[string]interface{}) error {
+	err := db.CDCDataSource.Model(&SnapshotRange{}).Where("id = ?", id).Updates(fields).Error
+	if err != nil {
+		log.Log.Error("update snapshot range failed", zap.Int64("id", id), zap.Error(err))
+	}
+	return err
+}
+
+// StartSnapshotRange 开始读取范围，清空分块进度
+func (service TableMetaService) StartSnapshotRange(id int64, pos *Position) error {
+	return service.updateSnapshotRange(id, map[string]interface{}{
+		"snapshot_status": SnapshotRunning,
+		"snapshot_pos":    pos.Marshal(),
+		"pos_mode":        pos.Mode,
+		"last_chunk_pk":   gorm.Expr("NULL"),
+		"rows_copied":     0,
+	})
+}
+
+// SaveSnapshotRangeChunk 记录范围内已被消费的分块进度
+func (service TableMetaService) SaveSnapshotRangeChunk(id int64, lastPK string, rowsCopied int64) error {
+	return service.updateSnapshotRange(id, map[string]interface{}{
+		"last_chunk_pk": lastPK,
+		"rows_copied":   rowsCopied,
+	})
+}
+
+// SetSnapshotRangeStatus 更新范围的全量状态
+func (service TableMetaService) SetSnapshotRangeStatus(id int64, status string) error {
+	return service.updateSnapshotRange(id, map[string]interface{}{
+		"snapshot_status": status,
+	})
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"go-cdc/internal/db"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// SnapshotSignal 已执行的信号表命令，增量从较早的位点重放 binlog 时，已执行过的命令不再执行
+type SnapshotSignal struct {
+	ID           int64     `gorm:"column:id;primaryKey;autoIncrement:true;type:bigint;comment:信号记录ID"`
+	DataSourceID string    `gorm:"column:data_source_id;type:varchar(50);comment:数据源ID;uniqueIndex:uniq_signal"`
+	SignalID     string    `gorm:"column:signal_id;type:varchar(64);comment:信号表中的命令ID;uniqueIndex:uniq_signal"`
+	Type         string    `gorm:"column:type;type:varchar(32);comment:命令类型"`
+	CreatedAt    time.Time `gorm:"column:created_at;comment:执行时间;index:idx_signal_created"`
+}
+
+func (SnapshotSignal) TableName() string {
+	return "go_cdc_snapshot_signal"
+}
+
+func init() {
+	db.AutoTable(&SnapshotSignal{})
+}
+
+// MarkSignalHandled 记录命令已执行，命令已有记录时返回 false
+func (service TableMetaService) MarkSignalHandled(datasourceID, signalID, typ string) (bool, error) {
+	res := db.CDCDataSource.Clauses(clause.OnConflict{DoNothing: true}).Create(&SnapshotSignal{
+		DataSourceID: datasourceID,
+		SignalID:     signalID,
+		Type:         typ,
+		CreatedAt:    time.Now(),
+	})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+// PruneSignals 删除 before 之前执行的命令记录，这些命令所在的 binlog 已超出重放范围
+func (service TableMetaService) PruneSignals(datasourceID string, before time.Time) error {
+	return db.CDCDataSource.Where("data_source_id = ? and created_at < ?", datasourceID, before).
+		Delete(&SnapshotSignal{}).Error
+}
@@ -1,7 +1,6 @@
 package model
 
 import (
-	"encoding/json"
 	"errors"
 	"go-cdc/internal/db"
 	"go-cdc/internal/log"
@@ -16,6 +15,8 @@ type CDCMeta struct {
 	DataSourceID   string `gorm:"column:data_source_id;type:varchar(50);comment:数据源ID;uniqueIndex:uniq_datasource_id"`
 	DataSourceType string `gorm:"column:data_source_type;type:varchar(50);comment:数据源类型"`
 	LastPos        string `gorm:"column:last_pos;type:json;comment:数据源CDC增量更新最新位置"`
+	PosMode        string `gorm:"column:pos_mode;type:varchar(20);comment:位点类型 gtid/file/mariadb_gtid，为空按gtid处理"`
+	SnapshotPos    string `gorm:"column:snapshot_pos;type:json;default:null;comment:最近一次全量结束位点Gfinal"`
 }
 
 func (CDCMeta) TableName() string {
@@ -27,9 +28,30 @@ type TableMeta struct {
 	DataSourceID string `gorm:"column:data_source_id;type:varchar(50);comment:数据源ID;uniqueIndex:uniq_table"`
 	Sc           string `gorm:"column:sc;type:varchar(50);comment:数据库名;uniqueIndex:uniq_table"`
 	Tb           string `gorm:"column:tb;type:varchar(50);comment:表名;uniqueIndex:uniq_table"`
-	LastPos      string `gorm:"column:last_pos;type:json;comment:表CDC增量更新最新位置"`
+	LastPos      string `gorm:"column:last_pos;type:json;default:null;comment:表CDC增量更新最新位置"`
+	PosMode      string `gorm:"column:pos_mode;type:varchar(20);comment:位点类型 gtid/file/mariadb_gtid，为空按gtid处理"`
+
+	SnapshotStatus string `gorm:"column:snapshot_status;type:varchar(20);comment:全量状态 pending/running/done/failed"`
+	SnapshotPos    string `gorm:"column:snapshot_pos;type:json;default:null;comment:本轮全量首次开启快照时的位点"`
+	LastChunkPK    string `gorm:"column:last_chunk_pk;type:json;default:null;comment:最近一个已被消费的分块的主键"`
+	RowsCopied     int64  `gorm:"column:rows_copied;type:bigint;comment:本轮全量已被消费的行数"`
+	SnapshotKind   string `gorm:"column:snapshot_kind;type:varchar(20);comment:全量类型 full/incremental"`
 }
 
+const (
+	SnapshotPending = "pending" // 等待全量
+	SnapshotRunning = "running" // 全量进行中
+	SnapshotDone    = "done"    // 全量完成，LastPos 为表快照位点
+	SnapshotFailed  = "failed"  // 全量失败，可从 LastChunkPK 继续
+	SnapshotPaused  = "paused"  // 增量快照已暂停，恢复后从 LastChunkPK 继续
+	SnapshotStopped = "stopped" // 增量快照已取消
+)
+
+const (
+	SnapshotKindFull        = "full"        // 启动时在事务快照中读取的全量
+	SnapshotKindIncremental = "incremental" // 增量同步运行中按水位线分块读取的全量，不修改 LastPos
+)
+
 func (TableMeta) TableName() string {
 	return "go_cdc_table_meta"
 }
@@ -53,13 +75,13 @@ func GetTableMetaService() TableMetaService {
 	return tableMetaService
 }
 
-func (service TableMetaService) SaveOrUpdateTableMeta(datasourceID, sc, tb string, lastPos interface{}) {
-	b, _ := json.Marshal(lastPos)
+func (service TableMetaService) SaveOrUpdateTableMeta(datasourceID, sc, tb string, lastPos *Position) {
 	meta := TableMeta{
 		DataSourceID: datasourceID,
 		Sc:           sc,
 		Tb:           tb,
-		LastPos:      string(b),
+		LastPos:      lastPos.Marshal(),
+		PosMode:      lastPos.Mode,
 	}
 	var existing TableMeta
 	t := db.CDCDataSource.Model(&TableMeta{})
@@ -75,17 +97,47 @@ func (service TableMetaService) SaveOrUpdateTableMeta(datasourceID, sc, tb strin
 		}
 	} else {
 		// 存在则更新 LastPos
-		if err := db.CDCDataSource.Model(&existing).Update("last_pos", meta.LastPos).Error; err != nil {
+		if err := db.CDCDataSource.Model(&existing).Updates(map[string]interface{}{
+			"last_pos": meta.LastPos,
+			"pos_mode": meta.PosMode,
+		}).Error; err != nil {
 			log.Log.Error("update table meta failed", zap.Error(err))
 		}
 	}
 }
 
-func (service TableMetaService) SavaOrUpdateCDCMeta(dataSourceID, dataSourceType string, lastPos interface{}) {
-	b, _ := json.Marshal(lastPos)
+// GetTableMeta 查询表的同步元数据，未做过全量的表返回 nil
+func (service TableMetaService) GetTableMeta(datasourceID, sc, tb string) (*TableMeta, error) {
+	var meta TableMeta
+	err := db.CDCDataSource.Model(&TableMeta{}).
+		Where("sc = ? and tb = ? and data_source_id = ?", sc, tb, datasourceID).First(&meta).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// GetCDCMeta 查询数据源的增量同步元数据，从未同步过的数据源返回 nil
+func (service TableMetaService) GetCDCMeta(dataSourceID string) (*CDCMeta, error) {
+	var meta CDCMeta
+	err := db.CDCDataSource.Model(&CDCMeta{}).Where("data_source_id = ?", dataSourceID).First(&meta).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (service TableMetaService) SavaOrUpdateCDCMeta(dataSourceID, dataSourceType string, lastPos *Position) {
 	meta := &CDCMeta{
 		DataSourceID:   dataSourceID,
-		LastPos:        string(b),
+		LastPos:        lastPos.Marshal(),
+		PosMode:        lastPos.Mode,
 		DataSourceType: dataSourceType,
 	}
 	var existing CDCMeta
@@ -104,9 +156,121 @@ func (service TableMetaService) SavaOrUpdateCDCMeta(dataSourceID, dataSourceType
 		// 存在则更新 LastPos
 		if err := db.CDCDataSource.Model(&existing).Updates(map[string]interface{}{
 			"last_pos":         meta.LastPos,
+			"pos_mode":         meta.PosMode,
 			"data_source_type": meta.DataSourceType,
 		}).Error; err != nil {
 			log.Log.Error("update cdc meta failed", zap.Error(err))
 		}
 	}
 }
+
+// SaveSnapshotPos 全量完成后记录全局结束位点 Gfinal，并将增量起点设为 lastPos
+func (service TableMetaService) SaveSnapshotPos(dataSourceID, dataSourceType string, lastPos, snapshotPos *Position) error {
+	service.SavaOrUpdateCDCMeta(dataSourceID, dataSourceType, lastPos)
+	err := db.CDCDataSource.Model(&CDCMeta{}).
+		Where("data_source_id = ?", dataSourceID).
+		Update("snapshot_pos", snapshotPos.Marshal()).Error
+	if err != nil {
+		log.Log.Error("update snapshot pos failed", zap.String("datasource", dataSourceID), zap.Error(err))
+	}
+	return err
+}
+
+// updateTableMeta 更新表元数据的指定字段，记录不存在时先插入
+func (service TableMetaService) updateTableMeta(datasourceID, sc, tb string, fields map[string]interface{}) error {
+	var existing TableMeta
+	err := db.CDCDataSource.Model(&TableMeta{}).
+		Where("sc = ? and tb = ? and data_source_id = ?", sc, tb, datasourceID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		existing = TableMeta{DataSourceID: datasourceID, Sc: sc, Tb: tb}
+		err = db.CDCDataSource.Create(&existing).Error
+	}
+	if err != nil {
+		log.Log.Error("query table meta failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return err
+	}
+	if err := db.CDCDataSource.Model(&existing).Updates(fields).Error; err != nil {
+		log.Log.Error("update table meta failed", zap.String("schema", sc), zap.String("table", tb), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// StartTableSnapshot 开始新一轮表全量，清空分块进度
+func (service TableMetaService) StartTableSnapshot(datasourceID, sc, tb string, pos *Position) error {
+	return service.updateTableMeta(datasourceID, sc, tb, map[string]interface{}{
+		"snapshot_status": SnapshotRunning,
+		"snapshot_kind":   SnapshotKindFull,
+		"snapshot_pos":    pos.Marshal(),
+		"pos_mode":        pos.Mode,
+		"last_chunk_pk":   gorm.Expr("NULL"),
+		"rows_copied":     0,
+	})
+}
+
+// StartIncrementalSnapshot 登记一次增量快照，清空分块进度，表的 LastPos 保持不变
+func (service TableMetaService) StartIncrementalSnapshot(datasourceID, sc, tb string) error {
+	return service.updateTableMeta(datasourceID, sc, tb, map[string]interface{}{
+		"snapshot_status": SnapshotPending,
+		"snapshot_kind":   SnapshotKindIncremental,
+		"snapshot_pos":    gorm.Expr("NULL"),
+		"last_chunk_pk":   gorm.Expr("NULL"),
+		"rows_copied":     0,
+	})
+}
+
+// FinishIncrementalSnapshot 增量快照完成，只更新状态
+func (service TableMetaService) FinishIncrementalSnapshot(datasourceID, sc, tb string) error {
+	return service.SetTableSnapshotStatus(datasourceID, sc, tb, SnapshotDone)
+}
+
+// ListIncrementalSnapshots 按状态查询数据源下的增量快照，按登记顺序返回
+func (service TableMetaService) ListIncrementalSnapshots(datasourceID string, statuses ...string) ([]*TableMeta, error) {
+	var list []*TableMeta
+	err := db.CDCDataSource.Model(&TableMeta{}).
+		Where("data_source_id = ? and snapshot_kind = ? and snapshot_status in ?", datasourceID,
+			SnapshotKindIncremental, statuses).
+		Order("id asc").Find(&list).Error
+	return list, err
+}
+
+// SetTableSnapshotStatus 更新表全量状态，不影响分块进度
+func (service TableMetaService) SetTableSnapshotStatus(datasourceID, sc, tb, status string) error {
+	return service.updateTableMeta(datasourceID, sc, tb, map[string]interface{}{
+		"snapshot_status": status,
+	})
+}
+
+// SaveSnapshotChunk 记录已被消费的分块进度，lastPK 为 JSON 格式的分块最后一行主键
+func (service TableMetaService) SaveSnapshotChunk(datasourceID, sc, tb, lastPK string, rowsCopied int64) error {
+	return service.updateTableMeta(datasourceID, sc, tb, map[string]interface{}{
+		"last_chunk_pk": lastPK,
+		"rows_copied":   rowsCopied,
+	})
+}
+
+// FinishTableSnapshot 表全量完成，LastPos 记为表快照位点供增量过滤
+func (service TableMetaService) FinishTableSnapshot(datasourceID, sc, tb string, pos *Position) error {
+	return service.updateTableMeta(datasourceID, sc, tb, map[string]interface{}{
+		"snapshot_status": SnapshotDone,
+		"last_pos":        pos.Marshal(),
+		"pos_mode":        pos.Mode,
+	})
+}
+
+// ResetSnapshot 放弃数据源上一轮全量的进度，所有表重新全量
+func (service TableMetaService) ResetSnapshot(datasourceID string) error {
+	err := db.CDCDataSource.Model(&TableMeta{}).
+		Where("data_source_id = ?", datasourceID).
+		Updates(map[string]interface{}{
+			"snapshot_status": SnapshotPending,
+			"snapshot_pos":    gorm.Expr("NULL"),
+			"last_chunk_pk":   gorm.Expr("NULL"),
+			"rows_copied":     0,
+		}).Error
+	if err != nil {
+		log.Log.Error("reset snapshot failed", zap.String("datasource", datasourceID), zap.Error(err))
+		return err
+	}
+	return service.DeleteSnapshotRanges(datasourceID)
+}
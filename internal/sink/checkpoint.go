@@ -0,0 +1,196 @@
+package sink
+
+import (
+	"database/sql"
+	"fmt"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// checkpointStore 数据库下游共用的位点管理：缓存各数据源已应用到目标库的位点，
+// 并跨批保留源事务在目标库上未提交的事务。溢写的大事务分多批投递且各批位点相同，
+// 只在第一批判断是否已应用，最后一批时与位点一起提交，中间任一批失败都回滚整个事务
+type checkpointStore struct {
+	load func(ds string) (*model.Position, error) // 从位点表读取，没有记录时返回 nil
+
+	lock    sync.Mutex
+	applied map[string]*model.Position // 数据源 ID -> 已应用的位点，首次使用时加载
+	pending map[string]*pendingTx      // 数据源 ID -> 未收到最后一批的源事务
+}
+
+// pendingTx 一个源事务在目标库上的状态
+type pendingTx struct {
+	tx   *sql.Tx         // 未提交的目标事务，未开始时为 nil
+	skip bool            // 事务已应用，各批都跳过
+	pos  *model.Position // 事务位点，快照行没有位点
+	ddl  bool            // 事务中执行过 DDL
+}
+
+func newCheckpointStore(load func(ds string) (*model.Position, error)) *checkpointStore {
+	return &checkpointStore{
+		load:    load,
+		applied: make(map[string]*model.Position),
+		pending: make(map[string]*pendingTx),
+	}
+}
+
+// begin 开始处理事务的一批事件。第一批丢弃之前中断的事务并按位点判断是否已应用，
+// 后续批沿用第一批的状态；找不到第一批时说明事务已中断，返回错误等待重新投递
+func (c *checkpointStore) begin(ds string, events []*model.Event, first bool) (*pendingTx, error) {
+	pos, raw, err := batchPosition(events)
+	if err != nil {
+		return nil, err
+	}
+	if !first {
+		c.lock.Lock()
+		p := c.pending[ds]
+		c.lock.Unlock()
+		if p == nil {
+			return nil, fmt.Errorf("transaction of %s was aborted before its last batch", ds)
+		}
+		if pos != nil {
+			p.pos = pos
+		}
+		return p, nil
+	}
+	c.abort(ds)
+	applied, err := c.appliedPosition(ds)
+	if err != nil {
+		return nil, err
+	}
+	p := &pendingTx{pos: pos, skip: pos != nil && pos.CoveredBy(applied)}
+	if p.skip {
+		log.Log.Info("skip applied transaction", zap.String("datasource", ds), zap.String("pos", raw))
+	}
+	c.lock.Lock()
+	c.pending[ds] = p
+	c.lock.Unlock()
+	return p, nil
+}
+
+// next 事务提交后的已应用位点，事务没有位点时返回 nil
+func (c *checkpointStore) next(ds string, p *pendingTx) *model.Position {
+	if p.pos == nil {
+		return nil
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return mergePosition(c.applied[ds], p.pos)
+}
+
+// commit 目标事务提交后记录已应用位点，next 为 nil 时位点不变
+func (c *checkpointStore) commit(ds string, next *model.Position) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if next != nil {
+		c.applied[ds] = next
+	}
+	delete(c.pending, ds)
+}
+
+// abort 回滚数据源未提交的目标事务，返回被丢弃的事务
+func (c *checkpointStore) abort(ds string) *pendingTx {
+	c.lock.Lock()
+	p := c.pending[ds]
+	delete(c.pending, ds)
+	c.lock.Unlock()
+	if p != nil && p.tx != nil {
+		_ = p.tx.Rollback()
+		p.tx = nil
+	}
+	return p
+}
+
+// appliedPosition 数据源已应用到目标库的位点，没有记录时返回 nil
+func (c *checkpointStore) appliedPosition(ds string) (*model.Position, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if pos, ok := c.applied[ds]; ok {
+		return pos, nil
+	}
+	pos, err := c.load(ds)
+	if err != nil {
+		return nil, err
+	}
+	c.applied[ds] = pos
+	return pos, nil
+}
+
+// batchPosition 一批事件的事务位点，取最后一个非快照行事件的位点。
+// 快照行不推进位点（增量快照的分块带有读取时的位点，但不代表该源事务已应用），靠 upsert 保证幂等
+func batchPosition(events []*model.Event) (*model.Position, string, error) {
+	var last string
+	for _, ev := range events {
+		if ev.Op != model.OpRead && ev.Pos != "" {
+			last = ev.Pos
+		}
+	}
+	if last == "" {
+		return nil, "", nil
+	}
+	pos, err := parseEventPos(last)
+	if err != nil {
+		return nil, "", err
+	}
+	return pos, last, nil
+}
+
+var mariadbGTIDPattern = regexp.MustCompile(`^\d+-\d+-\d+$`)
+
+// parseEventPos 解析事件携带的事务位点：uuid:gno、MariaDB 的 domain-server-seq 或 binlog 文件位点
+func parseEventPos(str string) (*model.Position, error) {
+	if mariadbGTIDPattern.MatchString(str) {
+		gtid, err := model.ParseMariadbGTID(str)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewMariadbPosition(gtid), nil
+	}
+	idx := strings.LastIndex(str, ":")
+	if idx < 0 {
+		return nil, fmt.Errorf("unknown event position %s", str)
+	}
+	if _, err := uuid.Parse(str[:idx]); err == nil {
+		gtid, err := model.ParseGTIDSet(str)
+		if err != nil {
+			return nil, err
+		}
+		return model.NewGTIDPosition(gtid), nil
+	}
+	n, err := strconv.ParseUint(str[idx+1:], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("unknown event position %s", str)
+	}
+	return model.NewFilePosition(model.BinlogPos{File: str[:idx], Pos: uint32(n)}), nil
+}
+
+// mergePosition 将事务位点并入已应用的位点，类型变化时以新位点为准
+func mergePosition(applied, pos *model.Position) *model.Position {
+	if pos == nil {
+		return applied
+	}
+	if applied.IsEmpty() || applied.Mode != pos.Mode {
+		return pos
+	}
+	next := applied.Clone()
+	switch pos.Mode {
+	case model.PosModeGTID:
+		next.GTID = next.GTID.Union(pos.GTID)
+	case model.PosModeMariaDB:
+		for _, item := range *pos.MariadbGTID {
+			next.MariadbGTID.Update(item.DomainID, item.ServerID, item.SeqNo)
+		}
+	default:
+		if next.BinlogPos.Compare(*pos.BinlogPos) < 0 {
+			next.BinlogPos = pos.BinlogPos
+		}
+	}
+	return next
+}
@@ -0,0 +1,179 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB 进程内的 database/sql 驱动，记录已提交的语句，并按位点表的 INSERT 模拟位点表
+type fakeDB struct {
+	mu          sync.Mutex
+	committed   []string                        // 已提交事务中的语句，事务外的语句直接提交
+	commits     int                             // 提交的事务数
+	checkpoints map[string][2]string            // 数据源 -> 已提交的 pos_mode、pos
+	execs       int                             // 执行过的语句数，含回滚的
+	fail        func(query string, n int) error // 返回错误时语句执行失败
+}
+
+var (
+	fakeDBs   = make(map[string]*fakeDB)
+	fakeDBsMu sync.Mutex
+	fakeOnce  sync.Once
+)
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	d, ok := fakeDBs[name]
+	if !ok {
+		return nil, errors.New("unknown fake db " + name)
+	}
+	return &fakeConn{db: d}, nil
+}
+
+// openFakeDB 以测试名注册独立的库
+func openFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fakeOnce.Do(func() {
+		sql.Register("fakesql", fakeDriver{})
+	})
+	d := &fakeDB{checkpoints: make(map[string][2]string)}
+	fakeDBsMu.Lock()
+	fakeDBs[t.Name()] = d
+	fakeDBsMu.Unlock()
+	conn, err := sql.Open("fakesql", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn, d
+}
+
+// count 已提交语句中包含 substr 的条数
+func (d *fakeDB) count(substr string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, q := range d.committed {
+		if strings.Contains(q, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+type fakeTx struct {
+	conn        *fakeConn
+	stmts       []string
+	checkpoints map[string][2]string
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.tx = &fakeTx{conn: c, checkpoints: make(map[string][2]string)}
+	return c.tx, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	d := c.db
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.execs++
+	if d.fail != nil {
+		if err := d.fail(query, d.execs); err != nil {
+			return nil, err
+		}
+	}
+	var checkpoint *[2]string
+	if strings.Contains(query, defaultCheckpointTable) && strings.HasPrefix(query, "INSERT") && len(args) == 3 {
+		checkpoint = &[2]string{args[1].Value.(string), args[2].Value.(string)}
+	}
+	if c.tx == nil {
+		d.committed = append(d.committed, query)
+		if checkpoint != nil {
+			d.checkpoints[args[0].Value.(string)] = *checkpoint
+		}
+		return driver.RowsAffected(1), nil
+	}
+	c.tx.stmts = append(c.tx.stmts, query)
+	if checkpoint != nil {
+		c.tx.checkpoints[args[0].Value.(string)] = *checkpoint
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	d := c.db
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if strings.HasPrefix(query, "SELECT pos_mode, pos FROM") {
+		if cp, ok := d.checkpoints[args[0].Value.(string)]; ok {
+			return &fakeRows{columns: []string{"pos_mode", "pos"}, data: [][]driver.Value{{cp[0], cp[1]}}}, nil
+		}
+		return &fakeRows{columns: []string{"pos_mode", "pos"}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	c := tx.conn
+	d := c.db
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.committed = append(d.committed, tx.stmts...)
+	for ds, cp := range tx.checkpoints {
+		d.checkpoints[ds] = cp
+	}
+	d.commits++
+	c.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	data    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
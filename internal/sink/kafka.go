@@ -0,0 +1,329 @@
+package sink
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const defaultDeliveryTimeout = 30 * time.Second
+
+// KafkaSink 将全量和增量事件写入 Kafka，实现 cannal.IncrementalConsumer。
+// 消息 key 为库表加主键，同一行的事件按 key 哈希进入同一分区，幂等生产保证重试不乱序不重复；
+// 修改主键的 update 拆成旧 key 的 delete、旧 key 的墓碑（value 为空）和新 key 的 insert；
+// DDL 写入 topic 的每个分区，每个分区中 DDL 之后的行都按新结构解析，消费方按位点对各分区收到的同一 DDL 去重；
+// Consume 等待整批消息都被 broker 确认后才返回，调用方在返回后才推进位点。
+// 二进制列的取值不一定是合法的 UTF-8，以 base64 编码写入，列名记录在 binary 中
+type KafkaSink struct {
+	cfg    *config.KafkaConfig
+	client *kgo.Client
+}
+
+// kafkaKey 消息 key，没有主键的表只按库表分区，同一张表的事件保持顺序
+type kafkaKey struct {
+	Schema string                 `json:"schema"`
+	Table  string                 `json:"table"`
+	Key    map[string]interface{} `json:"key,omitempty"`
+	Binary []string               `json:"binary,omitempty"` // 取值以 base64 编码的主键列
+}
+
+// kafkaMessage 消息内容
+type kafkaMessage struct {
+	DataSource string                 `json:"datasource"`
+	Schema     string                 `json:"schema"`
+	Table      string                 `json:"table"`
+	Op         string                 `json:"op"`
+	Ts         int64                  `json:"ts"`
+	Pos        string                 `json:"pos,omitempty"`
+	Keys       []string               `json:"keys,omitempty"`
+	Before     map[string]interface{} `json:"before,omitempty"`
+	After      map[string]interface{} `json:"after,omitempty"`
+	Binary     []string               `json:"binary,omitempty"` // 前后镜像中取值以 base64 编码的列
+	DDL        *model.DDLEvent        `json:"ddl,omitempty"`
+}
+
+// NewKafkaSink 创建生产者，opts 追加在默认选项之后，可用于替换 broker，如指向进程内的 kfake 集群
+func NewKafkaSink(cfg *config.KafkaConfig, opts ...kgo.Opt) (*KafkaSink, error) {
+	timeout := defaultDeliveryTimeout
+	if cfg.DeliveryTimeout > 0 {
+		timeout = time.Duration(cfg.DeliveryTimeout) * time.Second
+	}
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "go-cdc"
+	}
+	base := []kgo.Opt{
+		kgo.SeedBrokers(cfg.BrokerList()...),
+		kgo.ClientID(clientID),
+		// 幂等生产要求所有 ISR 确认
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.RecordPartitioner(broadcastPartitioner{kgo.StickyKeyPartitioner(nil)}),
+		kgo.RecordDeliveryTimeout(timeout),
+	}
+	if cfg.AutoCreateTopic {
+		base = append(base, kgo.AllowAutoTopicCreation())
+	}
+	client, err := kgo.NewClient(append(base, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("create kafka client err: %w", err)
+	}
+	return &KafkaSink{cfg: cfg, client: client}, nil
+}
+
+// Consume 同步写入一批事件，任一消息失败时返回错误，调用方不推进位点并重新投递
+func (s *KafkaSink) Consume(events []*model.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	records := make([]*kgo.Record, 0, len(events))
+	for _, ev := range events {
+		if ev.Op == "update" && ev.Before != nil && keyChanged(ev) {
+			// 修改主键的 update 拆成旧 key 的 delete 加墓碑和新 key 的 insert，压缩后旧 key 不再留有数据
+			del := *ev
+			del.Op, del.Data = "delete", nil
+			ins := *ev
+			ins.Op, ins.Before = "insert", nil
+			delRec, err := s.record(&del)
+			if err != nil {
+				return err
+			}
+			insRec, err := s.record(&ins)
+			if err != nil {
+				return err
+			}
+			tombstone := &kgo.Record{Topic: delRec.Topic, Key: delRec.Key}
+			records = append(records, delRec, tombstone, insRec)
+			continue
+		}
+		rec, err := s.record(ev)
+		if err != nil {
+			return err
+		}
+		if ev.Op != "ddl" {
+			records = append(records, rec)
+			continue
+		}
+		n, err := s.partitions(ctx, rec.Topic)
+		if err != nil {
+			return fmt.Errorf("load partitions of %s err: %w", rec.Topic, err)
+		}
+		for i := 0; i < n; i++ {
+			r := *rec
+			r.Context = context.WithValue(ctx, broadcastKey{}, i)
+			records = append(records, &r)
+		}
+	}
+	return s.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+// partitions 查询 topic 的分区数，允许自动创建时 topic 不存在会被创建，创建过程中的可重试错误在投递超时内重试
+func (s *KafkaSink) partitions(ctx context.Context, topic string) (int, error) {
+	timeout := defaultDeliveryTimeout
+	if s.cfg.DeliveryTimeout > 0 {
+		timeout = time.Duration(s.cfg.DeliveryTimeout) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		req := kmsg.NewPtrMetadataRequest()
+		t := kmsg.NewMetadataRequestTopic()
+		t.Topic = kmsg.StringPtr(topic)
+		req.Topics = append(req.Topics, t)
+		req.AllowAutoTopicCreation = s.cfg.AutoCreateTopic
+		resp, err := req.RequestWith(ctx, s.client)
+		if err != nil {
+			return 0, err
+		}
+		if len(resp.Topics) != 1 {
+			return 0, fmt.Errorf("metadata returned %d topics", len(resp.Topics))
+		}
+		err = kerr.ErrorForCode(resp.Topics[0].ErrorCode)
+		if err == nil && len(resp.Topics[0].Partitions) > 0 {
+			return len(resp.Topics[0].Partitions), nil
+		}
+		if err != nil && !kerr.IsRetriable(err) {
+			return 0, err
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("topic %s has no available partitions", topic)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// broadcastKey 记录 Context 中的目标分区序号，用于将 DDL 写入每个分区
+type broadcastKey struct{}
+
+// broadcastPartitioner 带目标分区序号的记录写入指定分区，其余记录交给内部的分区器
+type broadcastPartitioner struct {
+	kgo.Partitioner
+}
+
+func (p broadcastPartitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	return broadcastTopicPartitioner{p.Partitioner.ForTopic(topic)}
+}
+
+type broadcastTopicPartitioner struct {
+	kgo.TopicPartitioner
+}
+
+// RequiresConsistency 指定分区的记录按全部分区映射，序号即分区号
+func (p broadcastTopicPartitioner) RequiresConsistency(r *kgo.Record) bool {
+	if _, ok := broadcastPartition(r); ok {
+		return true
+	}
+	return p.TopicPartitioner.RequiresConsistency(r)
+}
+
+func (p broadcastTopicPartitioner) Partition(r *kgo.Record, n int) int {
+	if i, ok := broadcastPartition(r); ok {
+		return i % n
+	}
+	return p.TopicPartitioner.Partition(r, n)
+}
+
+func broadcastPartition(r *kgo.Record) (int, bool) {
+	if r.Context == nil {
+		return 0, false
+	}
+	i, ok := r.Context.Value(broadcastKey{}).(int)
+	return i, ok
+}
+
+// Close 等待缓冲中的消息发送完成后关闭连接
+func (s *KafkaSink) Close() {
+	_ = s.client.Flush(context.Background())
+	s.client.Close()
+}
+
+func (s *KafkaSink) record(ev *model.Event) (*kgo.Record, error) {
+	key, err := json.Marshal(eventKey(ev))
+	if err != nil {
+		return nil, err
+	}
+	binary := binaryColumns(ev.Before, ev.Data)
+	value, err := json.Marshal(&kafkaMessage{
+		DataSource: ev.DataSource,
+		Schema:     ev.Schema,
+		Table:      ev.Table,
+		Op:         ev.Op,
+		Ts:         ev.Ts,
+		Pos:        ev.Pos,
+		Keys:       ev.Keys,
+		Before:     encodeBinary(ev.Before, binary),
+		After:      encodeBinary(ev.Data, binary),
+		Binary:     binary,
+		DDL:        ev.DDL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encode event of %s.%s err: %w", ev.Schema, ev.Table, err)
+	}
+	return &kgo.Record{
+		Topic:   s.Topic(ev),
+		Key:     key,
+		Value:   value,
+		Headers: []kgo.RecordHeader{{Key: "op", Value: []byte(ev.Op)}},
+	}, nil
+}
+
+// eventKey 主键值取自后镜像，delete 取前镜像
+func eventKey(ev *model.Event) *kafkaKey {
+	key := &kafkaKey{Schema: ev.Schema, Table: ev.Table}
+	row := ev.Data
+	if row == nil {
+		row = ev.Before
+	}
+	if len(ev.Keys) == 0 || row == nil {
+		return key
+	}
+	key.Key = make(map[string]interface{}, len(ev.Keys))
+	for _, k := range ev.Keys {
+		key.Key[k] = row[k]
+	}
+	key.Binary = binaryColumns(key.Key)
+	key.Key = encodeBinary(key.Key, key.Binary)
+	return key
+}
+
+// binaryColumns 取值为 []byte 或不是合法 UTF-8 的字符串的列，按列名排序。
+// 同一列在前后镜像中任一个是二进制，两个镜像中都按二进制编码
+func binaryColumns(rows ...map[string]interface{}) []string {
+	var cols []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		for name, v := range row {
+			if seen[name] {
+				continue
+			}
+			switch v := v.(type) {
+			case []byte:
+			case string:
+				if utf8.ValidString(v) {
+					continue
+				}
+			default:
+				continue
+			}
+			seen[name] = true
+			cols = append(cols, name)
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// encodeBinary 返回将 binary 中的列以 base64 编码后的行，不修改原行
+func encodeBinary(row map[string]interface{}, binary []string) map[string]interface{} {
+	if row == nil || len(binary) == 0 {
+		return row
+	}
+	out := make(map[string]interface{}, len(row))
+	for name, v := range row {
+		out[name] = v
+	}
+	for _, name := range binary {
+		switch v := row[name].(type) {
+		case []byte:
+			out[name] = base64.StdEncoding.EncodeToString(v)
+		case string:
+			out[name] = base64.StdEncoding.EncodeToString([]byte(v))
+		}
+	}
+	return out
+}
+
+// Topic 渲染事件的 topic，库级 DDL 和全量完成标记没有库名或表名，模板中对应的空段被去掉
+func (s *KafkaSink) Topic(ev *model.Event) string {
+	tpl := s.cfg.TopicTemplate(ev.DataSource, ev.Schema, ev.Table)
+	topic := strings.NewReplacer("{datasource}", ev.DataSource, "{schema}", ev.Schema, "{table}", ev.Table).Replace(tpl)
+	parts := strings.Split(topic, ".")
+	kept := parts[:0]
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return sanitizeTopic(strings.Join(kept, "."))
+}
+
+// sanitizeTopic topic 只能包含字母、数字、点、下划线和中划线，其余字符替换为下划线
+func sanitizeTopic(topic string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, topic)
+}
@@ -0,0 +1,313 @@
+package sink
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+const testTopic = "cdc.ds1.shop.orders"
+
+func newTestCluster(t *testing.T, opts ...kfake.Opt) *kfake.Cluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(1), kfake.SeedTopics(3, testTopic)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+func newTestKafkaSink(t *testing.T, cluster *kfake.Cluster, cfg *config.KafkaConfig) *KafkaSink {
+	t.Helper()
+	cfg.Brokers = cluster.ListenAddrs()[0]
+	s, err := NewKafkaSink(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// readAll 从头读取 topic 中的全部消息，按分区分组
+func readAll(t *testing.T, cluster *kfake.Cluster, topic string, want int) map[int32][]*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got := make(map[int32][]*kgo.Record)
+	total := 0
+	for total < want {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("read %d of %d records: %v", total, want, err)
+		}
+		fetches.EachRecord(func(r *kgo.Record) {
+			got[r.Partition] = append(got[r.Partition], r)
+			total++
+		})
+	}
+	return got
+}
+
+func rowEvent(id int, op string) *model.Event {
+	row := map[string]interface{}{"id": id, "v": op}
+	ev := &model.Event{DataSource: "ds1", Schema: "shop", Table: "orders", Op: op, Keys: []string{"id"}, Ts: 1}
+	if op == "delete" {
+		ev.Before = row
+	} else {
+		ev.Data = row
+	}
+	return ev
+}
+
+func TestKafkaTopic(t *testing.T) {
+	s := &KafkaSink{cfg: &config.KafkaConfig{
+		Topic: "{datasource}.{schema}.{table}",
+		Topics: map[string]string{
+			"ds1":             "ds1-all",
+			"ds1.shop":        "shop.{table}",
+			"ds1.shop.orders": "orders",
+		},
+	}}
+	cases := []struct {
+		ds, schema, table string
+		want              string
+	}{
+		{"ds1", "shop", "orders", "orders"},
+		{"ds1", "shop", "items", "shop.items"},
+		{"ds1", "crm", "user", "ds1-all"},
+		{"ds2", "crm", "user", "ds2.crm.user"},
+		// 库级 DDL 没有表名，空段被去掉
+		{"ds2", "crm", "", "ds2.crm"},
+		{"ds2", "", "", "ds2"},
+		{"ds2", "crm", "user$log", "ds2.crm.user_log"},
+	}
+	for _, c := range cases {
+		got := s.Topic(&model.Event{DataSource: c.ds, Schema: c.schema, Table: c.table})
+		if got != c.want {
+			t.Errorf("topic of %s.%s.%s got %q, want %q", c.ds, c.schema, c.table, got, c.want)
+		}
+	}
+	if got := (&KafkaSink{cfg: &config.KafkaConfig{}}).Topic(rowEvent(1, "insert")); got != testTopic {
+		t.Errorf("default topic got %q, want %q", got, testTopic)
+	}
+}
+
+// TestKafkaKeyPartition 同一行的事件进入同一分区并保持顺序；DDL 写入每个分区，位于之前的行之后、之后的行之前
+func TestKafkaKeyPartition(t *testing.T) {
+	cluster := newTestCluster(t)
+	s := newTestKafkaSink(t, cluster, &config.KafkaConfig{})
+	var events []*model.Event
+	for id := 0; id < 20; id++ {
+		events = append(events, rowEvent(id, "insert"))
+	}
+	events = append(events, &model.Event{DataSource: "ds1", Schema: "shop", Table: "orders", Op: "ddl",
+		DDL: &model.DDLEvent{Kind: model.DDLAlterTable, Schema: "shop", Table: "orders", Query: "alter table orders add c int"}})
+	for id := 0; id < 20; id++ {
+		events = append(events, rowEvent(id, "update"))
+	}
+	if err := s.Consume(events); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readAll(t, cluster, testTopic, 40+3)
+	if len(got) != 3 {
+		t.Fatalf("records spread over %d partitions, want 3", len(got))
+	}
+	partitionOf := make(map[string]int32)
+	for partition, records := range got {
+		ddlAt := -1
+		for i, r := range records {
+			var msg kafkaMessage
+			if err := json.Unmarshal(r.Value, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.Op == "ddl" {
+				if ddlAt >= 0 {
+					t.Fatalf("partition %d has more than one ddl", partition)
+				}
+				ddlAt = i
+				continue
+			}
+			key := string(r.Key)
+			if p, ok := partitionOf[key]; ok && p != partition {
+				t.Fatalf("key %s in partitions %d and %d", key, p, partition)
+			}
+			partitionOf[key] = partition
+			if (msg.Op == "insert") != (ddlAt < 0) {
+				t.Errorf("partition %d: %s of %s on the wrong side of the ddl", partition, msg.Op, key)
+			}
+		}
+		if ddlAt < 0 {
+			t.Errorf("partition %d has no ddl", partition)
+		}
+	}
+	if len(partitionOf) != 20 {
+		t.Fatalf("got %d keys, want 20", len(partitionOf))
+	}
+	var key kafkaKey
+	for k := range partitionOf {
+		if err := json.Unmarshal([]byte(k), &key); err != nil || key.Schema != "shop" || key.Table != "orders" || len(key.Key) != 1 {
+			t.Fatalf("unexpected key %s: %v", k, err)
+		}
+	}
+}
+
+// TestKafkaConsumeWaitsForAck Consume 在 broker 确认后才返回，返回时消息已可读
+func TestKafkaConsumeWaitsForAck(t *testing.T) {
+	cluster := newTestCluster(t)
+	const delay = 300 * time.Millisecond
+	cluster.ControlKey(int16(kmsg.Produce), func(kmsg.Request) (kmsg.Response, error, bool) {
+		cluster.KeepControl()
+		time.Sleep(delay)
+		return nil, nil, false
+	})
+	s := newTestKafkaSink(t, cluster, &config.KafkaConfig{})
+	events := make([]*model.Event, 0, 10)
+	for id := 0; id < 10; id++ {
+		events = append(events, rowEvent(id, "insert"))
+	}
+	start := time.Now()
+	if err := s.Consume(events); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Fatalf("consume returned after %s, before the produce response", elapsed)
+	}
+	total := 0
+	for _, records := range readAll(t, cluster, testTopic, 10) {
+		total += len(records)
+	}
+	if total != 10 {
+		t.Fatalf("got %d records, want 10", total)
+	}
+}
+
+// TestKafkaConsumeError 消息无法确认时返回错误，调用方不推进位点
+func TestKafkaConsumeError(t *testing.T) {
+	cluster := newTestCluster(t)
+	s := newTestKafkaSink(t, cluster, &config.KafkaConfig{Topic: "missing.{table}", DeliveryTimeout: 1})
+	if err := s.Consume([]*model.Event{rowEvent(1, "insert")}); err == nil {
+		t.Fatal("produce to a missing topic: expected error")
+	}
+	ddl := &model.Event{DataSource: "ds1", Schema: "shop", Table: "orders", Op: "ddl", DDL: &model.DDLEvent{}}
+	if err := s.Consume([]*model.Event{ddl}); err == nil {
+		t.Fatal("ddl to a missing topic: expected error")
+	}
+}
+
+// TestKafkaBinaryColumns 不是合法 UTF-8 的取值以 base64 编码，解码后与原值一致
+func TestKafkaBinaryColumns(t *testing.T) {
+	cluster := newTestCluster(t)
+	s := newTestKafkaSink(t, cluster, &config.KafkaConfig{})
+	raw := string([]byte{0xff, 0x00, 0x10})
+	ev := &model.Event{DataSource: "ds1", Schema: "shop", Table: "orders", Op: "update", Keys: []string{"id"},
+		Before: map[string]interface{}{"id": raw, "v": "a", "blob": []byte{0x01}},
+		Data:   map[string]interface{}{"id": raw, "v": "b", "blob": []byte("ok")}}
+	if err := s.Consume([]*model.Event{ev}); err != nil {
+		t.Fatal(err)
+	}
+	for _, records := range readAll(t, cluster, testTopic, 1) {
+		r := records[0]
+		var key kafkaKey
+		if err := json.Unmarshal(r.Key, &key); err != nil {
+			t.Fatal(err)
+		}
+		if len(key.Binary) != 1 || key.Binary[0] != "id" || decodeBase64(t, key.Key["id"]) != raw {
+			t.Fatalf("unexpected key %s", r.Key)
+		}
+		var msg kafkaMessage
+		if err := json.Unmarshal(r.Value, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if len(msg.Binary) != 2 || msg.Binary[0] != "blob" || msg.Binary[1] != "id" {
+			t.Fatalf("binary columns got %v", msg.Binary)
+		}
+		if decodeBase64(t, msg.Before["id"]) != raw || decodeBase64(t, msg.After["id"]) != raw ||
+			decodeBase64(t, msg.After["blob"]) != "ok" || msg.After["v"] != "b" {
+			t.Fatalf("unexpected message %s", r.Value)
+		}
+	}
+	if ev.Data["id"] != raw {
+		t.Fatal("event modified by encoding")
+	}
+}
+
+func decodeBase64(t *testing.T, v interface{}) string {
+	t.Helper()
+	s, _ := v.(string)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("decode %v: %v", v, err)
+	}
+	return string(b)
+}
+
+// TestKafkaKeyChange 修改主键的 update 拆成旧 key 的 delete 和墓碑、新 key 的 insert
+func TestKafkaKeyChange(t *testing.T) {
+	cluster := newTestCluster(t)
+	s := newTestKafkaSink(t, cluster, &config.KafkaConfig{})
+	ev := rowEvent(2, "update")
+	ev.Before = map[string]interface{}{"id": 1, "v": "insert"}
+	if err := s.Consume([]*model.Event{ev, rowEvent(2, "update")}); err != nil {
+		t.Fatal(err)
+	}
+	oldKey, _ := json.Marshal(eventKey(rowEvent(1, "delete")))
+	newKey, _ := json.Marshal(eventKey(rowEvent(2, "insert")))
+	type entry struct {
+		key, op   string
+		tombstone bool
+	}
+	var got []entry
+	for _, records := range readAll(t, cluster, testTopic, 4) {
+		for _, r := range records {
+			e := entry{key: string(r.Key), tombstone: r.Value == nil}
+			if !e.tombstone {
+				var msg kafkaMessage
+				if err := json.Unmarshal(r.Value, &msg); err != nil {
+					t.Fatal(err)
+				}
+				e.op = msg.Op
+				if msg.Op == "delete" && msg.After != nil || msg.Op == "insert" && msg.Before != nil {
+					t.Fatalf("unexpected images in %s", r.Value)
+				}
+			}
+			got = append(got, e)
+		}
+	}
+	byKey := make(map[string][]entry)
+	for _, e := range got {
+		byKey[e.key] = append(byKey[e.key], e)
+	}
+	want := map[string][]entry{
+		string(oldKey): {{string(oldKey), "delete", false}, {string(oldKey), "", true}},
+		string(newKey): {{string(newKey), "insert", false}, {string(newKey), "update", false}},
+	}
+	for k, w := range want {
+		if len(byKey[k]) != len(w) {
+			t.Fatalf("records of %s got %v, want %v", k, byKey[k], w)
+		}
+		for i := range w {
+			if byKey[k][i] != w[i] {
+				t.Fatalf("records of %s got %v, want %v", k, byKey[k], w)
+			}
+		}
+	}
+}
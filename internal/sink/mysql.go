@@ -0,0 +1,419 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"go-cdc/internal/db"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCheckpointTable = "go_cdc_checkpoint"
+	defaultApplyBatch      = 500
+)
+
+// MysqlSink 将选定的表回放到目标 MySQL，实现 cannal.IncrementalConsumer 和 cannal.TxConsumer：
+// DDL 改写库表名后执行；快照行按批 INSERT ... ON DUPLICATE KEY UPDATE；binlog 的 insert/update 按主键 upsert，delete 按主键删除。
+// 一个源事务的行变更与其 GTID 在同一个目标事务中提交，溢写后分批投递的大事务在最后一批时才提交，
+// 重启后已包含在位点表中的事务直接跳过，不会重复应用。
+// DDL 在 MySQL 中隐式提交，无法与位点原子提交，CREATE/DROP 改写为 IF [NOT] EXISTS 以便中断后重放，
+// 重放 ALTER 时列或索引已存在、要删除的列或索引不存在的错误视为语句已应用
+type MysqlSink struct {
+	cfg         *config.MysqlSinkConfig
+	db          *sql.DB
+	checkpoint  string
+	batchSize   int
+	checkpoints *checkpointStore
+}
+
+// NewMysqlSink 连接目标库并创建位点表
+func NewMysqlSink(cfg *config.MysqlSinkConfig) (*MysqlSink, error) {
+	conn, err := sql.Open("mysql", db.GetMysqlDsn(cfg.DataSource()))
+	if err != nil {
+		return nil, err
+	}
+	s := &MysqlSink{
+		cfg:        cfg,
+		db:         conn,
+		checkpoint: cfg.CheckpointTable,
+		batchSize:  cfg.BatchSize,
+	}
+	s.checkpoints = newCheckpointStore(s.loadCheckpoint)
+	if s.checkpoint == "" {
+		s.checkpoint = defaultCheckpointTable
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultApplyBatch
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"`datasource` varchar(64) NOT NULL, "+
+		"`pos_mode` varchar(16) NOT NULL, "+
+		"`pos` longtext NOT NULL, "+
+		"`updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, "+
+		"PRIMARY KEY (`datasource`))", s.checkpoint)
+	if _, err := conn.Exec(query); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("create checkpoint table %s err: %w", s.checkpoint, err)
+	}
+	return s, nil
+}
+
+func (s *MysqlSink) Close() {
+	_ = s.db.Close()
+}
+
+// Consume 一批事件来自同一个数据源的一个完整源事务（或同一个快照分块）
+func (s *MysqlSink) Consume(events []*model.Event) error {
+	return s.ConsumeTx(events, true, true)
+}
+
+// ConsumeTx 一批事件来自同一个数据源的同一个源事务，目标事务跨批保留到最后一批时与位点一起提交
+func (s *MysqlSink) ConsumeTx(events []*model.Event, first, last bool) (err error) {
+	if len(events) == 0 || events[0].Op == model.OpSnapshotComplete {
+		return nil
+	}
+	ds := events[0].DataSource
+	p, err := s.checkpoints.begin(ds, events, first)
+	if err != nil {
+		return err
+	}
+	if p.skip {
+		if last {
+			s.checkpoints.commit(ds, nil)
+		}
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			s.checkpoints.abort(ds)
+		}
+	}()
+
+	ctx := context.Background()
+	for i := 0; i < len(events); {
+		ev := events[i]
+		if ev.Op == "ddl" {
+			// DDL 隐式提交，先提交之前的行变更
+			if p.tx != nil {
+				tx := p.tx
+				p.tx = nil
+				if err := tx.Commit(); err != nil {
+					return err
+				}
+			}
+			if err := s.applyDDL(ctx, ev); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		if p.tx == nil {
+			if p.tx, err = s.db.BeginTx(ctx, nil); err != nil {
+				return err
+			}
+		}
+		// 连续的快照行合并写入
+		if ev.Op == model.OpRead {
+			j := i + 1
+			for j < len(events) && j-i < s.batchSize && sameBatch(events[i], events[j]) {
+				j++
+			}
+			if err := s.upsertRows(ctx, p.tx, events[i:j]); err != nil {
+				return err
+			}
+			i = j
+			continue
+		}
+		if err := s.applyRow(ctx, p.tx, ev); err != nil {
+			return err
+		}
+		i++
+	}
+	if !last {
+		return nil
+	}
+	next := s.checkpoints.next(ds, p)
+	if next != nil {
+		if p.tx == nil {
+			if p.tx, err = s.db.BeginTx(ctx, nil); err != nil {
+				return err
+			}
+		}
+		if err := s.saveCheckpoint(ctx, p.tx, ds, next); err != nil {
+			return err
+		}
+	}
+	if p.tx != nil {
+		tx := p.tx
+		p.tx = nil
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	s.checkpoints.commit(ds, next)
+	return nil
+}
+
+// loadCheckpoint 从位点表读取数据源已应用的位点，没有记录时返回 nil
+func (s *MysqlSink) loadCheckpoint(ds string) (*model.Position, error) {
+	var mode, str string
+	query := fmt.Sprintf("SELECT pos_mode, pos FROM `%s` WHERE datasource = ?", s.checkpoint)
+	err := s.db.QueryRow(query, ds).Scan(&mode, &str)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return model.ParsePosition(mode, str)
+}
+
+func (s *MysqlSink) saveCheckpoint(ctx context.Context, tx *sql.Tx, ds string, pos *model.Position) error {
+	query := fmt.Sprintf("INSERT INTO `%s` (datasource, pos_mode, pos) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE pos_mode = VALUES(pos_mode), pos = VALUES(pos)", s.checkpoint)
+	_, err := tx.ExecContext(ctx, query, ds, pos.Mode, pos.Marshal())
+	return err
+}
+
+// target 源表在目标库中的全名
+func (s *MysqlSink) target(schema, table string) string {
+	sc, tb := s.cfg.Target(schema, table)
+	return quoteName(sc) + "." + quoteName(tb)
+}
+
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// replayedDDLErrors DDL 执行后、位点提交前中断，重放时说明语句已执行过的错误：
+// 1060 列已存在、1061 索引已存在、1091 要删除的列或索引不存在。ALTER TABLE 整体生效或整体失败，不会只应用一部分
+var replayedDDLErrors = map[uint16]bool{1060: true, 1061: true, 1091: true}
+
+// applyDDL 按事件类型生成目标库上的语句，多表的 DROP/RENAME 语句按事件逐表执行
+func (s *MysqlSink) applyDDL(ctx context.Context, ev *model.Event) error {
+	ddl := ev.DDL
+	if ddl == nil {
+		return nil
+	}
+	var stmts []string
+	switch ddl.Kind {
+	case model.DDLCreateDatabase:
+		sc, _ := s.cfg.Target(ddl.Schema, "")
+		stmts = append(stmts, "CREATE DATABASE IF NOT EXISTS "+quoteName(sc))
+	case model.DDLDropDatabase:
+		sc, _ := s.cfg.Target(ddl.Schema, "")
+		stmts = append(stmts, "DROP DATABASE IF EXISTS "+quoteName(sc))
+	case model.DDLDropTable:
+		stmts = append(stmts, "DROP TABLE IF EXISTS "+s.target(ddl.Schema, ddl.Table))
+	case model.DDLTruncateTable:
+		stmts = append(stmts, "TRUNCATE TABLE "+s.target(ddl.Schema, ddl.Table))
+	case model.DDLRenameTable:
+		stmts = append(stmts, fmt.Sprintf("RENAME TABLE %s TO %s", s.target(ddl.Schema, ddl.Table), s.target(ddl.NewSchema, ddl.NewTable)))
+	default:
+		query, err := s.rewriteDDL(ddl.Query, ddl.Schema)
+		if err != nil {
+			return err
+		}
+		if ddl.Kind == model.DDLCreateTable {
+			sc, _ := s.cfg.Target(ddl.Schema, ddl.Table)
+			stmts = append(stmts, "CREATE DATABASE IF NOT EXISTS "+quoteName(sc))
+		}
+		stmts = append(stmts, query)
+	}
+	for _, stmt := range stmts {
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			var myErr *mysql.MySQLError
+			if errors.As(err, &myErr) && replayedDDLErrors[myErr.Number] {
+				log.Log.Warn("ddl already applied, skip", zap.String("stmt", stmt), zap.Error(err))
+				continue
+			}
+			return fmt.Errorf("apply ddl %s err: %w", stmt, err)
+		}
+	}
+	log.Log.Info("ddl applied", zap.String("schema", ddl.Schema), zap.String("table", ddl.Table), zap.String("kind", ddl.Kind))
+	return nil
+}
+
+// tableRenamer 将语句中的表名替换为目标库中的库表名，未限定库名的表属于 defaultSchema
+type tableRenamer struct {
+	cfg           *config.MysqlSinkConfig
+	defaultSchema string
+}
+
+func (r *tableRenamer) Enter(n ast.Node) (ast.Node, bool) {
+	if t, ok := n.(*ast.TableName); ok {
+		schema := t.Schema.O
+		if schema == "" {
+			schema = r.defaultSchema
+		}
+		sc, tb := r.cfg.Target(schema, t.Name.O)
+		t.Schema, t.Name = ast.NewCIStr(sc), ast.NewCIStr(tb)
+		return n, true
+	}
+	return n, false
+}
+
+func (r *tableRenamer) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// rewriteDDL 改写库表名，CREATE TABLE 加上 IF NOT EXISTS
+func (s *MysqlSink) rewriteDDL(query, defaultSchema string) (string, error) {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return "", fmt.Errorf("parse ddl %s err: %w", query, err)
+	}
+	if create, ok := stmt.(*ast.CreateTableStmt); ok {
+		create.IfNotExists = true
+	}
+	stmt.Accept(&tableRenamer{cfg: s.cfg, defaultSchema: defaultSchema})
+	var sb strings.Builder
+	if err := stmt.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags, &sb)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// sameBatch 同一张表、列相同的快照行可以合并为一条语句
+func sameBatch(a, b *model.Event) bool {
+	if b.Op != model.OpRead || a.Schema != b.Schema || a.Table != b.Table || len(a.Data) != len(b.Data) || len(a.Keys) != len(b.Keys) {
+		return false
+	}
+	for col := range a.Data {
+		if _, ok := b.Data[col]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedColumns(row map[string]interface{}) []string {
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// upsertRows 多行 INSERT ... ON DUPLICATE KEY UPDATE，没有主键的表只能直接插入
+func (s *MysqlSink) upsertRows(ctx context.Context, tx *sql.Tx, events []*model.Event) error {
+	first := events[0]
+	cols := sortedColumns(first.Data)
+	if len(cols) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(cols))
+	for i, col := range cols {
+		quoted[i] = quoteName(col)
+	}
+	holders := "(" + strings.TrimSuffix(strings.Repeat("?,", len(cols)), ",") + ")"
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*len(cols))
+	for _, ev := range events {
+		values = append(values, holders)
+		for _, col := range cols {
+			args = append(args, ev.Data[col])
+		}
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", s.target(first.Schema, first.Table), strings.Join(quoted, ","), strings.Join(values, ","))
+	if len(first.Keys) > 0 {
+		updates := make([]string, len(quoted))
+		for i, col := range quoted {
+			updates[i] = fmt.Sprintf("%s = VALUES(%s)", col, col)
+		}
+		query += " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("upsert %s.%s err: %w", first.Schema, first.Table, err)
+	}
+	return nil
+}
+
+// applyRow 应用单个 binlog 行变更，有主键时 insert/update 按 upsert 应用，主键被修改时先删除旧行；
+// 没有主键时 update/delete 按前镜像的全部列定位一行
+func (s *MysqlSink) applyRow(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	switch ev.Op {
+	case "insert":
+		return s.upsertRows(ctx, tx, []*model.Event{ev})
+	case "update":
+		if len(ev.Keys) == 0 {
+			return s.updateByImage(ctx, tx, ev)
+		}
+		if keyChanged(ev) {
+			if err := s.deleteRow(ctx, tx, ev); err != nil {
+				return err
+			}
+		}
+		return s.upsertRows(ctx, tx, []*model.Event{ev})
+	case "delete":
+		return s.deleteRow(ctx, tx, ev)
+	}
+	return nil
+}
+
+func keyChanged(ev *model.Event) bool {
+	for _, k := range ev.Keys {
+		if fmt.Sprint(ev.Before[k]) != fmt.Sprint(ev.Data[k]) {
+			return true
+		}
+	}
+	return false
+}
+
+// whereClause 有主键时按主键定位，否则按前镜像全部列以 <=> 比较并只影响一行
+func whereClause(ev *model.Event) (string, []interface{}, string) {
+	cols := ev.Keys
+	if len(cols) == 0 {
+		cols = sortedColumns(ev.Before)
+	}
+	conds := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	for i, col := range cols {
+		conds[i] = quoteName(col) + " <=> ?"
+		args[i] = ev.Before[col]
+	}
+	limit := ""
+	if len(ev.Keys) == 0 {
+		limit = " LIMIT 1"
+	}
+	return strings.Join(conds, " AND "), args, limit
+}
+
+func (s *MysqlSink) deleteRow(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	where, args, limit := whereClause(ev)
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s%s", s.target(ev.Schema, ev.Table), where, limit)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("delete %s.%s err: %w", ev.Schema, ev.Table, err)
+	}
+	return nil
+}
+
+func (s *MysqlSink) updateByImage(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	cols := sortedColumns(ev.Data)
+	sets := make([]string, len(cols))
+	args := make([]interface{}, 0, len(cols)+len(ev.Before))
+	for i, col := range cols {
+		sets[i] = quoteName(col) + " = ?"
+		args = append(args, ev.Data[col])
+	}
+	where, whereArgs, limit := whereClause(ev)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s%s", s.target(ev.Schema, ev.Table), strings.Join(sets, ","), where, limit)
+	if _, err := tx.ExecContext(ctx, query, append(args, whereArgs...)...); err != nil {
+		return fmt.Errorf("update %s.%s err: %w", ev.Schema, ev.Table, err)
+	}
+	return nil
+}
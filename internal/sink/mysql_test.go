@@ -0,0 +1,140 @@
+package sink
+
+import (
+	"errors"
+	"go-cdc/internal/cannal"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"strings"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const testGTID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func newTestMysqlSink(t *testing.T) (*MysqlSink, *fakeDB) {
+	t.Helper()
+	conn, d := openFakeDB(t)
+	s := &MysqlSink{cfg: &config.MysqlSinkConfig{}, db: conn, checkpoint: defaultCheckpointTable, batchSize: defaultApplyBatch}
+	s.checkpoints = newCheckpointStore(s.loadCheckpoint)
+	return s, d
+}
+
+// spillTx 将一个源事务的 n 个 insert 写入溢写到磁盘的事务缓冲
+func spillTx(t *testing.T, n int, gno string) *cannal.TxBuffer {
+	t.Helper()
+	b := cannal.NewTxBuffer(100, t.TempDir())
+	for i := 0; i < n; i++ {
+		ev := &model.Event{DataSource: "ds1", Schema: "shop", Table: "orders", Op: "insert", Keys: []string{"id"},
+			Data: map[string]interface{}{"id": int64(i), "v": "x"}, Pos: testGTID + ":" + gno}
+		if err := b.Append(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b
+}
+
+// TestMysqlSinkSpilledTx 溢写后分批投递的大事务全部应用，并在一个目标事务中与位点一起提交
+func TestMysqlSinkSpilledTx(t *testing.T) {
+	s, d := newTestMysqlSink(t)
+	const n = 2530
+	if err := spillTx(t, n, "5").Flush(s.ConsumeTx); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.count("INSERT INTO `shop`.`orders`"); got != n {
+		t.Fatalf("applied %d rows, want %d", got, n)
+	}
+	if got := d.count("INSERT INTO `go_cdc_checkpoint`"); got != 1 {
+		t.Fatalf("checkpoint written %d times, want 1", got)
+	}
+	if d.commits != 1 {
+		t.Fatalf("committed %d target transactions, want 1", d.commits)
+	}
+	cp := d.checkpoints["ds1"]
+	if pos, err := model.ParsePosition(cp[0], cp[1]); err != nil || pos.GTID == nil || !pos.GTID.Contains(testGTID, 5) {
+		t.Fatalf("unexpected checkpoint %v: %v", cp, err)
+	}
+
+	// 重启后重放同一个事务，各批都跳过
+	s2 := &MysqlSink{cfg: s.cfg, db: s.db, checkpoint: s.checkpoint, batchSize: s.batchSize}
+	s2.checkpoints = newCheckpointStore(s2.loadCheckpoint)
+	execs := d.execs
+	if err := spillTx(t, n, "5").Flush(s2.ConsumeTx); err != nil {
+		t.Fatal(err)
+	}
+	if d.execs != execs {
+		t.Fatalf("replayed transaction executed %d statements", d.execs-execs)
+	}
+
+	// 下一个事务照常应用
+	if err := spillTx(t, 10, "6").Flush(s2.ConsumeTx); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.count("INSERT INTO `shop`.`orders`"); got != n+10 {
+		t.Fatalf("applied %d rows, want %d", got, n+10)
+	}
+}
+
+// TestMysqlSinkSpilledTxFailure 中间一批失败时整个事务回滚，重新投递后完整应用一次
+func TestMysqlSinkSpilledTxFailure(t *testing.T) {
+	s, d := newTestMysqlSink(t)
+	const n = 2530
+	d.fail = func(query string, i int) error {
+		if i == 1500 {
+			return errors.New("connection lost")
+		}
+		return nil
+	}
+	if err := spillTx(t, n, "5").Flush(s.ConsumeTx); err == nil {
+		t.Fatal("expected error")
+	}
+	if got := len(d.committed); got != 0 || d.commits != 0 {
+		t.Fatalf("failed transaction committed %d statements", got)
+	}
+	// 没有收到第一批的后续批次不能单独应用
+	tail := []*model.Event{{DataSource: "ds1", Schema: "shop", Table: "orders", Op: "insert", Keys: []string{"id"},
+		Data: map[string]interface{}{"id": int64(1)}, Pos: testGTID + ":5"}}
+	if err := s.ConsumeTx(tail, false, true); err == nil {
+		t.Fatal("batch of an aborted transaction: expected error")
+	}
+
+	d.fail = nil
+	if err := spillTx(t, n, "5").Flush(s.ConsumeTx); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.count("INSERT INTO `shop`.`orders`"); got != n {
+		t.Fatalf("applied %d rows, want %d", got, n)
+	}
+	if got := d.count("INSERT INTO `go_cdc_checkpoint`"); got != 1 {
+		t.Fatalf("checkpoint written %d times, want 1", got)
+	}
+}
+
+// TestMysqlSinkReplayDDL 位点提交前中断后重放 ALTER，列或索引已存在、已删除的错误视为已应用
+func TestMysqlSinkReplayDDL(t *testing.T) {
+	s, d := newTestMysqlSink(t)
+	var code uint16
+	d.fail = func(query string, i int) error {
+		if strings.HasPrefix(query, "ALTER") {
+			return &mysql.MySQLError{Number: code, Message: "replayed"}
+		}
+		return nil
+	}
+	ddl := func() []*model.Event {
+		return []*model.Event{{DataSource: "ds1", Schema: "shop", Table: "orders", Op: "ddl", Pos: testGTID + ":7",
+			DDL: &model.DDLEvent{Kind: model.DDLAlterTable, Schema: "shop", Table: "orders", Query: "ALTER TABLE orders ADD COLUMN c int"}}}
+	}
+	for _, code = range []uint16{1060, 1061, 1091} {
+		if err := s.Consume(ddl()); err != nil {
+			t.Fatalf("error %d: %v", code, err)
+		}
+		// 位点已推进，清空后模拟重启前未记录位点
+		delete(d.checkpoints, "ds1")
+		s.checkpoints = newCheckpointStore(s.loadCheckpoint)
+	}
+	code = 1146
+	if err := s.Consume(ddl()); err == nil {
+		t.Fatal("error 1146: expected error")
+	}
+}
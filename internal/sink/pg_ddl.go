@@ -0,0 +1,463 @@
+package sink
+
+import (
+	"fmt"
+	"go-cdc/internal/log"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+	"github.com/pingcap/tidb/pkg/parser/test_driver"
+	"github.com/pingcap/tidb/pkg/parser/types"
+	"go.uber.org/zap"
+)
+
+// pgTranslator 将 MySQL 的建表语句和增量 DDL 翻译为 PostgreSQL 语句。
+// 表选项、分区、外键、全文索引等没有对应语义的部分被忽略；索引名在 PostgreSQL 中按 schema 唯一，统一加上表名前缀
+type pgTranslator struct {
+	target func(schema, table string) (string, string)
+}
+
+// pgColumn 翻译后的列定义
+type pgColumn struct {
+	name     string
+	typ      string
+	notNull  bool
+	def      string // 默认值表达式，为空表示没有默认值
+	identity bool   // AUTO_INCREMENT 列
+	check    string // enum 取值约束
+	comment  string
+	primary  bool // 列上声明的 PRIMARY KEY
+	unique   bool // 列上声明的 UNIQUE
+}
+
+// Translate 翻译一条 DDL，defaultSchema 为未限定库名的表所属的库
+func (t *pgTranslator) Translate(query, defaultSchema string) ([]string, error) {
+	stmt, err := parser.New().ParseOneStmt(query, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("parse ddl %s err: %w", query, err)
+	}
+	switch s := stmt.(type) {
+	case *ast.CreateTableStmt:
+		return t.createTable(s, defaultSchema)
+	case *ast.AlterTableStmt:
+		return t.alterTable(s, defaultSchema)
+	case *ast.CreateIndexStmt:
+		sc, tb := t.tableName(s.Table, defaultSchema)
+		if s.KeyType != ast.IndexKeyTypeNone && s.KeyType != ast.IndexKeyTypeUnique {
+			log.Log.Warn("skip unsupported index", zap.String("query", query))
+			return nil, nil
+		}
+		stmt := t.createIndex(sc, tb, s.IndexName, s.KeyType == ast.IndexKeyTypeUnique, s.IndexPartSpecifications)
+		if stmt == "" {
+			return nil, nil
+		}
+		return []string{stmt}, nil
+	case *ast.DropIndexStmt:
+		sc, tb := t.tableName(s.Table, defaultSchema)
+		return []string{t.dropIndex(sc, tb, s.IndexName)}, nil
+	}
+	return nil, fmt.Errorf("unsupported ddl %s", query)
+}
+
+// tableName 目标库中的 schema 和表名
+func (t *pgTranslator) tableName(tn *ast.TableName, defaultSchema string) (string, string) {
+	schema := tn.Schema.O
+	if schema == "" {
+		schema = defaultSchema
+	}
+	return t.target(schema, tn.Name.O)
+}
+
+func (t *pgTranslator) createTable(s *ast.CreateTableStmt, defaultSchema string) ([]string, error) {
+	sc, tb := t.tableName(s.Table, defaultSchema)
+	table := pgTable(sc, tb)
+	stmts := []string{"CREATE SCHEMA IF NOT EXISTS " + pgIdent(sc)}
+	if s.ReferTable != nil {
+		lsc, ltb := t.tableName(s.ReferTable, defaultSchema)
+		return append(stmts, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (LIKE %s INCLUDING ALL)", table, pgTable(lsc, ltb))), nil
+	}
+	var defs, pk, after []string
+	for _, col := range s.Cols {
+		c := convertPgColumn(tb, col)
+		defs = append(defs, c.definition(tb))
+		if c.primary {
+			pk = append(pk, c.name)
+		}
+		if c.unique {
+			after = append(after, t.createIndex(sc, tb, c.name, true, []*ast.IndexPartSpecification{{Column: col.Name}}))
+		}
+		if c.comment != "" {
+			after = append(after, fmt.Sprintf("COMMENT ON COLUMN %s.%s IS %s", table, pgIdent(c.name), pgLiteral(c.comment)))
+		}
+	}
+	for _, cons := range s.Constraints {
+		switch cons.Tp {
+		case ast.ConstraintPrimaryKey:
+			pk = indexParts(cons.Keys)
+		case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+			if stmt := t.createIndex(sc, tb, cons.Name, isUnique(cons.Tp), cons.Keys); stmt != "" {
+				after = append(after, stmt)
+			}
+		}
+	}
+	if len(pk) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+pgIdentList(pk)+")")
+	}
+	for _, opt := range s.Options {
+		if opt.Tp == ast.TableOptionComment && opt.StrValue != "" {
+			after = append(after, fmt.Sprintf("COMMENT ON TABLE %s IS %s", table, pgLiteral(opt.StrValue)))
+		}
+	}
+	stmts = append(stmts, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", table, strings.Join(defs, ", ")))
+	return append(stmts, after...), nil
+}
+
+// alterTable 每个子句翻译为独立的语句，重命名表放在最后
+func (t *pgTranslator) alterTable(s *ast.AlterTableStmt, defaultSchema string) ([]string, error) {
+	sc, tb := t.tableName(s.Table, defaultSchema)
+	table := pgTable(sc, tb)
+	var stmts, rename []string
+	for _, spec := range s.Specs {
+		switch spec.Tp {
+		case ast.AlterTableAddColumns:
+			for _, col := range spec.NewColumns {
+				c := convertPgColumn(tb, col)
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s", table, c.definition(tb)))
+				if c.primary {
+					stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, pgIdent(c.name)))
+				}
+				if c.unique {
+					stmts = append(stmts, t.createIndex(sc, tb, c.name, true, []*ast.IndexPartSpecification{{Column: col.Name}}))
+				}
+			}
+		case ast.AlterTableAddConstraint:
+			cons := spec.Constraint
+			switch cons.Tp {
+			case ast.ConstraintPrimaryKey:
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD PRIMARY KEY (%s)", table, pgIdentList(indexParts(cons.Keys))))
+			case ast.ConstraintKey, ast.ConstraintIndex, ast.ConstraintUniq, ast.ConstraintUniqKey, ast.ConstraintUniqIndex:
+				if stmt := t.createIndex(sc, tb, cons.Name, isUnique(cons.Tp), cons.Keys); stmt != "" {
+					stmts = append(stmts, stmt)
+				}
+			}
+		case ast.AlterTableDropColumn:
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", table, pgIdent(spec.OldColumnName.Name.O)))
+		case ast.AlterTableDropPrimaryKey:
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, pgIdent(tb+"_pkey")))
+		case ast.AlterTableDropIndex:
+			if strings.EqualFold(spec.Name, "PRIMARY") {
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, pgIdent(tb+"_pkey")))
+				continue
+			}
+			stmts = append(stmts, t.dropIndex(sc, tb, spec.Name))
+		case ast.AlterTableModifyColumn, ast.AlterTableChangeColumn:
+			col := spec.NewColumns[0]
+			if spec.OldColumnName != nil && spec.OldColumnName.Name.O != col.Name.Name.O {
+				// enum 取值约束按列名命名，改名后按旧名删除，否则旧约束会与新约束同时生效
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, pgIdent(checkName(tb, spec.OldColumnName.Name.O))))
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, pgIdent(spec.OldColumnName.Name.O), pgIdent(col.Name.Name.O)))
+			}
+			stmts = append(stmts, modifyColumn(table, tb, convertPgColumn(tb, col))...)
+		case ast.AlterTableRenameColumn:
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s", table, pgIdent(spec.OldColumnName.Name.O), pgIdent(spec.NewColumnName.Name.O)))
+		case ast.AlterTableAlterColumn:
+			col := spec.NewColumns[0]
+			action := "DROP DEFAULT"
+			if len(col.Options) > 0 {
+				if def := pgDefault(col.Options[0].Expr, ""); def != "" {
+					action = "SET DEFAULT " + def
+				}
+			}
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, pgIdent(col.Name.Name.O), action))
+		case ast.AlterTableRenameIndex:
+			stmts = append(stmts, fmt.Sprintf("ALTER INDEX IF EXISTS %s.%s RENAME TO %s", pgIdent(sc), pgIdent(indexName(tb, spec.FromKey.O)), pgIdent(indexName(tb, spec.ToKey.O))))
+		case ast.AlterTableRenameTable:
+			nsc, ntb := t.tableName(spec.NewTable, defaultSchema)
+			if nsc != sc {
+				rename = append(rename, fmt.Sprintf("ALTER TABLE %s SET SCHEMA %s", table, pgIdent(nsc)))
+			}
+			if ntb != tb {
+				rename = append(rename, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", pgTable(nsc, tb), pgIdent(ntb)))
+			}
+		}
+	}
+	return append(stmts, rename...), nil
+}
+
+// modifyColumn 修改列类型、可空和默认值，enum 的取值约束先删除再按新定义添加。
+// MySQL 的主键列总是 NOT NULL，未声明 NOT NULL 时对主键列 DROP NOT NULL 会失败，该错误被忽略；
+// 标识列保持不变，AUTO_INCREMENT 被去掉时删除标识
+func modifyColumn(table, tb string, c *pgColumn) []string {
+	col := pgIdent(c.name)
+	stmts := []string{
+		fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, pgIdent(checkName(tb, c.name))),
+		fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", table, col, c.typ, col, c.typ),
+	}
+	if c.notNull {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL", table, col))
+	} else {
+		stmts = append(stmts, fmt.Sprintf("DO $$BEGIN ALTER TABLE %s ALTER COLUMN %s DROP NOT NULL; "+
+			"EXCEPTION WHEN invalid_table_definition THEN NULL; END$$", table, col))
+	}
+	if !c.identity {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP IDENTITY IF EXISTS", table, col))
+		if c.def != "" {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s", table, col, c.def))
+		} else {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", table, col))
+		}
+	}
+	if c.check != "" {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", table, pgIdent(checkName(tb, c.name)), c.check))
+	}
+	return stmts
+}
+
+// createIndex 前缀索引按整列建立，包含表达式的索引无法翻译时跳过
+func (t *pgTranslator) createIndex(sc, tb, name string, unique bool, parts []*ast.IndexPartSpecification) string {
+	cols := indexParts(parts)
+	if len(cols) != len(parts) {
+		log.Log.Warn("skip expression index", zap.String("table", tb), zap.String("index", name))
+		return ""
+	}
+	if name == "" {
+		name = cols[0]
+	}
+	kind := "INDEX"
+	if unique {
+		kind = "UNIQUE INDEX"
+	}
+	return fmt.Sprintf("CREATE %s IF NOT EXISTS %s ON %s (%s)", kind, pgIdent(indexName(tb, name)), pgTable(sc, tb), pgIdentList(cols))
+}
+
+func (t *pgTranslator) dropIndex(sc, tb, name string) string {
+	return fmt.Sprintf("DROP INDEX IF EXISTS %s.%s", pgIdent(sc), pgIdent(indexName(tb, name)))
+}
+
+func convertPgColumn(tb string, col *ast.ColumnDef) *pgColumn {
+	c := &pgColumn{
+		name:    col.Name.Name.O,
+		typ:     pgType(col.Tp),
+		notNull: mysql.HasNotNullFlag(col.Tp.GetFlag()),
+	}
+	if col.Tp.GetType() == mysql.TypeEnum && len(col.Tp.GetElems()) > 0 {
+		elems := make([]string, len(col.Tp.GetElems()))
+		for i, e := range col.Tp.GetElems() {
+			elems[i] = pgLiteral(e)
+		}
+		c.check = fmt.Sprintf("%s IN (%s)", pgIdent(c.name), strings.Join(elems, ", "))
+	}
+	for _, opt := range col.Options {
+		switch opt.Tp {
+		case ast.ColumnOptionNotNull:
+			c.notNull = true
+		case ast.ColumnOptionNull:
+			c.notNull = false
+		case ast.ColumnOptionPrimaryKey:
+			c.primary, c.notNull = true, true
+		case ast.ColumnOptionUniqKey:
+			c.unique = true
+		case ast.ColumnOptionAutoIncrement:
+			c.identity = true
+		case ast.ColumnOptionDefaultValue:
+			c.def = pgDefault(opt.Expr, c.typ)
+		case ast.ColumnOptionComment:
+			if v, ok := opt.Expr.(*test_driver.ValueExpr); ok {
+				c.comment = v.GetString()
+			}
+		}
+	}
+	// 标识列只能是整数类型，unsigned bigint 映射为 numeric 后不再自增
+	if c.identity && c.typ != "smallint" && c.typ != "integer" && c.typ != "bigint" {
+		c.identity = false
+	}
+	return c
+}
+
+// definition 列定义，AUTO_INCREMENT 翻译为 GENERATED BY DEFAULT AS IDENTITY，同步写入的显式值不会推进序列，切换写入前需要 setval
+func (c *pgColumn) definition(tb string) string {
+	var sb strings.Builder
+	sb.WriteString(pgIdent(c.name) + " " + c.typ)
+	if c.notNull {
+		sb.WriteString(" NOT NULL")
+	}
+	if c.identity {
+		sb.WriteString(" GENERATED BY DEFAULT AS IDENTITY")
+	} else if c.def != "" {
+		sb.WriteString(" DEFAULT " + c.def)
+	}
+	if c.check != "" {
+		sb.WriteString(fmt.Sprintf(" CONSTRAINT %s CHECK (%s)", pgIdent(checkName(tb, c.name)), c.check))
+	}
+	return sb.String()
+}
+
+// pgType MySQL 列类型到 PostgreSQL 类型的映射
+func pgType(tp *types.FieldType) string {
+	unsigned := mysql.HasUnsignedFlag(tp.GetFlag())
+	binary := mysql.HasBinaryFlag(tp.GetFlag()) || tp.GetCharset() == "binary"
+	switch tp.GetType() {
+	case mysql.TypeTiny:
+		if tp.GetFlen() == 1 && !unsigned {
+			return "boolean"
+		}
+		return "smallint"
+	case mysql.TypeShort:
+		if unsigned {
+			return "integer"
+		}
+		return "smallint"
+	case mysql.TypeInt24:
+		return "integer"
+	case mysql.TypeLong:
+		if unsigned {
+			return "bigint"
+		}
+		return "integer"
+	case mysql.TypeLonglong:
+		if unsigned {
+			return "numeric(20)"
+		}
+		return "bigint"
+	case mysql.TypeFloat:
+		return "real"
+	case mysql.TypeDouble:
+		return "double precision"
+	case mysql.TypeNewDecimal:
+		if tp.GetFlen() > 0 {
+			return fmt.Sprintf("numeric(%d,%d)", tp.GetFlen(), max(tp.GetDecimal(), 0))
+		}
+		return "numeric"
+	case mysql.TypeYear:
+		return "smallint"
+	case mysql.TypeDate:
+		return "date"
+	case mysql.TypeDatetime, mysql.TypeTimestamp:
+		// 不做时区转换，按源库的字面值存储
+		if tp.GetDecimal() > 0 {
+			return fmt.Sprintf("timestamp(%d)", tp.GetDecimal())
+		}
+		return "timestamp"
+	case mysql.TypeDuration:
+		// TIME 的取值范围超过一天
+		return "interval"
+	case mysql.TypeVarchar, mysql.TypeVarString:
+		if binary {
+			return "bytea"
+		}
+		if tp.GetFlen() > 0 {
+			return fmt.Sprintf("varchar(%d)", tp.GetFlen())
+		}
+		return "varchar"
+	case mysql.TypeString:
+		if binary {
+			return "bytea"
+		}
+		if tp.GetFlen() > 0 {
+			return fmt.Sprintf("char(%d)", tp.GetFlen())
+		}
+		return "char"
+	case mysql.TypeTinyBlob, mysql.TypeBlob, mysql.TypeMediumBlob, mysql.TypeLongBlob:
+		if binary {
+			return "bytea"
+		}
+		return "text"
+	case mysql.TypeJSON:
+		return "jsonb"
+	case mysql.TypeBit:
+		if tp.GetFlen() == 1 {
+			return "boolean"
+		}
+		return "bigint"
+	case mysql.TypeGeometry:
+		return "bytea"
+	}
+	// enum、set 及其他类型按文本存储
+	return "text"
+}
+
+// pgDefault 翻译默认值，typ 为目标列类型，用于 boolean 列的 0/1 默认值；无法翻译的表达式返回空串
+func pgDefault(expr ast.ExprNode, typ string) string {
+	switch e := expr.(type) {
+	case *test_driver.ValueExpr:
+		switch v := e.GetValue().(type) {
+		case nil:
+			return "NULL"
+		case int64, uint64, float32, float64:
+			if typ == "boolean" {
+				return fmt.Sprint(fmt.Sprint(v) != "0")
+			}
+			return fmt.Sprint(v)
+		case string:
+			// 零值日期在 PostgreSQL 中不合法
+			if strings.HasPrefix(v, "0000-00-00") {
+				return ""
+			}
+			if typ == "boolean" {
+				return fmt.Sprint(v != "0" && v != "")
+			}
+			return pgLiteral(v)
+		default:
+			return pgLiteral(e.GetDatumString())
+		}
+	case *ast.FuncCallExpr:
+		switch e.FnName.L {
+		case "current_timestamp", "now", "localtime", "localtimestamp":
+			return "CURRENT_TIMESTAMP"
+		}
+		return ""
+	case *ast.UnaryOperationExpr:
+		var sb strings.Builder
+		if err := e.Restore(format.NewRestoreCtx(format.RestoreStringSingleQuotes, &sb)); err != nil {
+			return ""
+		}
+		return sb.String()
+	}
+	return ""
+}
+
+func isUnique(tp ast.ConstraintType) bool {
+	return tp == ast.ConstraintUniq || tp == ast.ConstraintUniqKey || tp == ast.ConstraintUniqIndex
+}
+
+// indexParts 索引中的列名，表达式不计入
+func indexParts(parts []*ast.IndexPartSpecification) []string {
+	cols := make([]string, 0, len(parts))
+	for _, p := range parts {
+		if p.Column != nil {
+			cols = append(cols, p.Column.Name.O)
+		}
+	}
+	return cols
+}
+
+func indexName(tb, name string) string {
+	return tb + "_" + name
+}
+
+func checkName(tb, col string) string {
+	return tb + "_" + col + "_check"
+}
+
+func pgIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func pgIdentList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = pgIdent(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func pgTable(schema, table string) string {
+	return pgIdent(schema) + "." + pgIdent(table)
+}
+
+func pgLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
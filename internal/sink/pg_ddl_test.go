@@ -0,0 +1,245 @@
+package sink
+
+import (
+	"context"
+	"go-cdc/internal/model"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// parseColumn 解析单列的建表语句，返回列定义
+func parseColumn(t *testing.T, def string) *ast.ColumnDef {
+	t.Helper()
+	stmt, err := parser.New().ParseOneStmt("CREATE TABLE t (c "+def+")", "", "")
+	if err != nil {
+		t.Fatalf("parse %s: %v", def, err)
+	}
+	return stmt.(*ast.CreateTableStmt).Cols[0]
+}
+
+func TestPgType(t *testing.T) {
+	cases := []struct {
+		def  string
+		want string
+	}{
+		{"tinyint(1)", "boolean"},
+		{"tinyint(1) unsigned", "smallint"},
+		{"tinyint(4)", "smallint"},
+		{"smallint unsigned", "integer"},
+		{"mediumint", "integer"},
+		{"int", "integer"},
+		{"int unsigned", "bigint"},
+		{"bigint", "bigint"},
+		{"bigint unsigned", "numeric(20)"},
+		{"decimal(10,2)", "numeric(10,2)"},
+		{"double", "double precision"},
+		{"datetime", "timestamp"},
+		{"datetime(3)", "timestamp(3)"},
+		{"timestamp(6)", "timestamp(6)"},
+		{"date", "date"},
+		{"time", "interval"},
+		{"varchar(32)", "varchar(32)"},
+		{"varbinary(16)", "bytea"},
+		{"char(2)", "char(2)"},
+		{"binary(16)", "bytea"},
+		{"text", "text"},
+		{"blob", "bytea"},
+		{"json", "jsonb"},
+		{"bit(1)", "boolean"},
+		{"bit(8)", "bigint"},
+		{"enum('a','b')", "text"},
+		{"set('a','b')", "text"},
+	}
+	for _, c := range cases {
+		if got := pgType(parseColumn(t, c.def).Tp); got != c.want {
+			t.Errorf("pgType(%s) got %q, want %q", c.def, got, c.want)
+		}
+	}
+}
+
+func TestPgDefault(t *testing.T) {
+	cases := []struct {
+		def  string
+		typ  string
+		want string
+	}{
+		{"int DEFAULT 5", "integer", "5"},
+		{"int DEFAULT -1", "integer", "-1"},
+		{"int DEFAULT NULL", "integer", "NULL"},
+		{"tinyint(1) DEFAULT 1", "boolean", "true"},
+		{"tinyint(1) DEFAULT '0'", "boolean", "false"},
+		{"varchar(8) DEFAULT 'it''s'", "varchar(8)", "'it''s'"},
+		{"datetime DEFAULT '0000-00-00 00:00:00'", "timestamp", ""},
+		{"date DEFAULT '0000-00-00'", "date", ""},
+		{"datetime(3) DEFAULT '2024-01-02 03:04:05.678'", "timestamp(3)", "'2024-01-02 03:04:05.678'"},
+		{"timestamp(6) DEFAULT CURRENT_TIMESTAMP(6)", "timestamp(6)", "CURRENT_TIMESTAMP"},
+		{"datetime DEFAULT now()", "timestamp", "CURRENT_TIMESTAMP"},
+		{"varchar(36) DEFAULT (uuid())", "varchar(36)", ""},
+	}
+	for _, c := range cases {
+		col := parseColumn(t, c.def)
+		if got := pgDefault(col.Options[0].Expr, c.typ); got != c.want {
+			t.Errorf("pgDefault(%s) got %q, want %q", c.def, got, c.want)
+		}
+	}
+}
+
+func TestPgTranslate(t *testing.T) {
+	tr := &pgTranslator{target: func(schema, table string) (string, string) {
+		if schema == "src" {
+			schema = "dst"
+		}
+		return schema, table
+	}}
+	cases := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{
+			name: "create table",
+			query: "CREATE TABLE t (id bigint unsigned NOT NULL AUTO_INCREMENT, n int NOT NULL AUTO_INCREMENT, flag tinyint(1) NOT NULL DEFAULT '1', " +
+				"st enum('a','b') DEFAULT 'a', ts datetime(3) NOT NULL DEFAULT '0000-00-00 00:00:00.000', name varchar(32) COMMENT 'n', " +
+				"PRIMARY KEY (id), UNIQUE KEY uk_name (name), KEY idx_prefix (name(8))) ENGINE=InnoDB COMMENT='t'",
+			want: []string{
+				`CREATE SCHEMA IF NOT EXISTS "dst"`,
+				`CREATE TABLE IF NOT EXISTS "dst"."t" ("id" numeric(20) NOT NULL, "n" integer NOT NULL GENERATED BY DEFAULT AS IDENTITY, ` +
+					`"flag" boolean NOT NULL DEFAULT true, "st" text DEFAULT 'a' CONSTRAINT "t_st_check" CHECK ("st" IN ('a', 'b')), ` +
+					`"ts" timestamp(3) NOT NULL, "name" varchar(32), PRIMARY KEY ("id"))`,
+				`COMMENT ON COLUMN "dst"."t"."name" IS 'n'`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS "t_uk_name" ON "dst"."t" ("name")`,
+				`CREATE INDEX IF NOT EXISTS "t_idx_prefix" ON "dst"."t" ("name")`,
+				`COMMENT ON TABLE "dst"."t" IS 't'`,
+			},
+		},
+		{
+			name:  "create table like",
+			query: "CREATE TABLE t2 LIKE other.t",
+			want: []string{
+				`CREATE SCHEMA IF NOT EXISTS "dst"`,
+				`CREATE TABLE IF NOT EXISTS "dst"."t2" (LIKE "other"."t" INCLUDING ALL)`,
+			},
+		},
+		{
+			name:  "change column",
+			query: "ALTER TABLE t CHANGE COLUMN st state enum('a','b','c') NOT NULL DEFAULT 'c'",
+			want: []string{
+				`ALTER TABLE "dst"."t" DROP CONSTRAINT IF EXISTS "t_st_check"`,
+				`ALTER TABLE "dst"."t" RENAME COLUMN "st" TO "state"`,
+				`ALTER TABLE "dst"."t" DROP CONSTRAINT IF EXISTS "t_state_check"`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "state" TYPE text USING "state"::text`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "state" SET NOT NULL`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "state" DROP IDENTITY IF EXISTS`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "state" SET DEFAULT 'c'`,
+				`ALTER TABLE "dst"."t" ADD CONSTRAINT "t_state_check" CHECK ("state" IN ('a', 'b', 'c'))`,
+			},
+		},
+		{
+			name:  "modify column",
+			query: "ALTER TABLE t MODIFY COLUMN ts datetime(6) NULL",
+			want: []string{
+				`ALTER TABLE "dst"."t" DROP CONSTRAINT IF EXISTS "t_ts_check"`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "ts" TYPE timestamp(6) USING "ts"::timestamp(6)`,
+				`DO $$BEGIN ALTER TABLE "dst"."t" ALTER COLUMN "ts" DROP NOT NULL; EXCEPTION WHEN invalid_table_definition THEN NULL; END$$`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "ts" DROP IDENTITY IF EXISTS`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "ts" DROP DEFAULT`,
+			},
+		},
+		{
+			name:  "modify auto increment column",
+			query: "ALTER TABLE t MODIFY COLUMN n bigint NOT NULL AUTO_INCREMENT",
+			want: []string{
+				`ALTER TABLE "dst"."t" DROP CONSTRAINT IF EXISTS "t_n_check"`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "n" TYPE bigint USING "n"::bigint`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "n" SET NOT NULL`,
+			},
+		},
+		{
+			name:  "several specs with rename last",
+			query: "ALTER TABLE t RENAME TO src.t3, ADD COLUMN c int unsigned DEFAULT 0, DROP COLUMN flag, ADD UNIQUE KEY uk_c (c), DROP INDEX idx_prefix, DROP PRIMARY KEY",
+			want: []string{
+				`ALTER TABLE "dst"."t" ADD COLUMN IF NOT EXISTS "c" bigint DEFAULT 0`,
+				`ALTER TABLE "dst"."t" DROP COLUMN IF EXISTS "flag"`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS "t_uk_c" ON "dst"."t" ("c")`,
+				`DROP INDEX IF EXISTS "dst"."t_idx_prefix"`,
+				`ALTER TABLE "dst"."t" DROP CONSTRAINT IF EXISTS "t_pkey"`,
+				`ALTER TABLE "dst"."t" RENAME TO "t3"`,
+			},
+		},
+		{
+			name:  "rename table to another schema",
+			query: "ALTER TABLE t RENAME TO other.t4",
+			want: []string{
+				`ALTER TABLE "dst"."t" SET SCHEMA "other"`,
+				`ALTER TABLE "other"."t" RENAME TO "t4"`,
+			},
+		},
+		{
+			name:  "alter column default",
+			query: "ALTER TABLE t ALTER COLUMN c SET DEFAULT 3, ALTER COLUMN st DROP DEFAULT",
+			want: []string{
+				`ALTER TABLE "dst"."t" ALTER COLUMN "c" SET DEFAULT 3`,
+				`ALTER TABLE "dst"."t" ALTER COLUMN "st" DROP DEFAULT`,
+			},
+		},
+		{
+			name:  "create index",
+			query: "CREATE UNIQUE INDEX uk_x ON t (a, b)",
+			want:  []string{`CREATE UNIQUE INDEX IF NOT EXISTS "t_uk_x" ON "dst"."t" ("a", "b")`},
+		},
+		{
+			name:  "drop index",
+			query: "DROP INDEX uk_x ON t",
+			want:  []string{`DROP INDEX IF EXISTS "dst"."t_uk_x"`},
+		},
+	}
+	for _, c := range cases {
+		got, err := tr.Translate(c.query, "src")
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s:\ngot  %s\nwant %s", c.name, strings.Join(got, "\n     "), strings.Join(c.want, "\n     "))
+		}
+	}
+	// RENAME TABLE 由 applyDDL 按事件中的新旧表名处理，不经过翻译
+	for _, q := range []string{"RENAME TABLE t TO t5", "DROP TABLE t", "not a ddl"} {
+		if _, err := tr.Translate(q, "src"); err == nil {
+			t.Errorf("translate %q should fail", q)
+		}
+	}
+}
+
+// TestPostgresRenameTable RENAME TABLE 按映射后的库表名改名，跨库时先移动 schema
+func TestPostgresRenameTable(t *testing.T) {
+	s, d := newTestPostgresSink(t)
+	s.cfg.SchemaMapping = map[string]string{"src": "dst"}
+	tx, err := s.db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ddl := range []*model.DDLEvent{
+		{Kind: model.DDLRenameTable, Schema: "src", Table: "a", NewSchema: "src", NewTable: "b"},
+		{Kind: model.DDLRenameTable, Schema: "src", Table: "b", NewSchema: "other", NewTable: "c"},
+	} {
+		if err := s.applyDDL(context.Background(), tx, &model.Event{Op: "ddl", DDL: ddl}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`ALTER TABLE "dst"."a" RENAME TO "b"`,
+		`ALTER TABLE "dst"."b" SET SCHEMA "other"`,
+		`ALTER TABLE "other"."b" RENAME TO "c"`,
+	}
+	if !reflect.DeepEqual(d.committed, want) {
+		t.Fatalf("got %q, want %q", d.committed, want)
+	}
+}
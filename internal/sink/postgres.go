@@ -0,0 +1,421 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"go-cdc/internal/log"
+	"go-cdc/internal/model"
+	"go-cdc/pkg/config"
+	"strconv"
+	"strings"
+	"sync"
+
+	_ "github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// maxPgParams 单条语句的绑定参数上限
+const maxPgParams = 65535
+
+// PostgresSink 将 MySQL 的表迁移到 PostgreSQL，实现 cannal.IncrementalConsumer 和 cannal.TxConsumer：
+// 快照的建表语句和增量 DDL 经 pgTranslator 翻译后执行；快照行按批 INSERT ... ON CONFLICT DO UPDATE，
+// binlog 的 insert/update 按主键 upsert，delete 按主键删除。
+// PostgreSQL 的 DDL 支持事务，一个源事务的 DDL、行变更和位点在同一个目标事务中提交，溢写后分批投递的大事务在最后一批时才提交，
+// 重启后已应用的事务直接跳过
+type PostgresSink struct {
+	cfg         *config.PostgresSinkConfig
+	db          *sql.DB
+	translator  *pgTranslator
+	checkpoint  string
+	batchSize   int
+	checkpoints *checkpointStore
+
+	lock    sync.Mutex
+	columns map[string]map[string]string // 目标表 -> 列名 -> 列类型，执行 DDL 后清空
+}
+
+// NewPostgresSink 连接目标库并创建位点表
+func NewPostgresSink(cfg *config.PostgresSinkConfig) (*PostgresSink, error) {
+	conn, err := sql.Open("postgres", cfg.Dsn())
+	if err != nil {
+		return nil, err
+	}
+	s := &PostgresSink{
+		cfg:        cfg,
+		db:         conn,
+		translator: &pgTranslator{target: cfg.Target},
+		checkpoint: cfg.CheckpointTable,
+		batchSize:  cfg.BatchSize,
+		columns:    make(map[string]map[string]string),
+	}
+	s.checkpoints = newCheckpointStore(s.loadCheckpoint)
+	if s.checkpoint == "" {
+		s.checkpoint = defaultCheckpointTable
+	}
+	if s.batchSize <= 0 {
+		s.batchSize = defaultApplyBatch
+	}
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+		"datasource varchar(64) NOT NULL PRIMARY KEY, "+
+		"pos_mode varchar(16) NOT NULL, "+
+		"pos text NOT NULL, "+
+		"updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP)", pgIdent(s.checkpoint))
+	if _, err := conn.Exec(query); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("create checkpoint table %s err: %w", s.checkpoint, err)
+	}
+	return s, nil
+}
+
+func (s *PostgresSink) Close() {
+	_ = s.db.Close()
+}
+
+// Consume 一批事件来自同一个数据源的一个完整源事务（或同一个快照分块）
+func (s *PostgresSink) Consume(events []*model.Event) error {
+	return s.ConsumeTx(events, true, true)
+}
+
+// ConsumeTx 一批事件来自同一个数据源的同一个源事务，目标事务跨批保留到最后一批时与位点一起提交
+func (s *PostgresSink) ConsumeTx(events []*model.Event, first, last bool) (err error) {
+	if len(events) == 0 || events[0].Op == model.OpSnapshotComplete {
+		return nil
+	}
+	ds := events[0].DataSource
+	p, err := s.checkpoints.begin(ds, events, first)
+	if err != nil {
+		return err
+	}
+	if p.skip {
+		if last {
+			s.checkpoints.commit(ds, nil)
+		}
+		return nil
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		// 事务回滚后 DDL 未生效，缓存的列类型可能来自回滚前
+		if aborted := s.checkpoints.abort(ds); aborted != nil && aborted.ddl {
+			s.forgetColumns()
+		}
+	}()
+
+	ctx := context.Background()
+	if p.tx == nil {
+		if p.tx, err = s.db.BeginTx(ctx, nil); err != nil {
+			return err
+		}
+	}
+	tx := p.tx
+	for i := 0; i < len(events); {
+		ev := events[i]
+		switch ev.Op {
+		case "ddl":
+			if err := s.applyDDL(ctx, tx, ev); err != nil {
+				return err
+			}
+			p.ddl = true
+			s.forgetColumns()
+			i++
+		case model.OpRead:
+			// 连续的快照行合并写入，参数个数不能超过上限
+			limit := s.batchSize
+			if n := len(ev.Data); n > 0 && limit*n > maxPgParams {
+				limit = maxPgParams / n
+			}
+			j := i + 1
+			for j < len(events) && j-i < limit && sameBatch(events[i], events[j]) {
+				j++
+			}
+			if err := s.upsertRows(ctx, tx, events[i:j]); err != nil {
+				return err
+			}
+			i = j
+		default:
+			if err := s.applyRow(ctx, tx, ev); err != nil {
+				return err
+			}
+			i++
+		}
+	}
+	if !last {
+		return nil
+	}
+	next := s.checkpoints.next(ds, p)
+	if next != nil {
+		if err := s.saveCheckpoint(ctx, tx, ds, next); err != nil {
+			return err
+		}
+	}
+	p.tx = nil
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.checkpoints.commit(ds, next)
+	return nil
+}
+
+// loadCheckpoint 从位点表读取数据源已应用的位点，没有记录时返回 nil
+func (s *PostgresSink) loadCheckpoint(ds string) (*model.Position, error) {
+	var mode, str string
+	query := fmt.Sprintf("SELECT pos_mode, pos FROM %s WHERE datasource = $1", pgIdent(s.checkpoint))
+	err := s.db.QueryRow(query, ds).Scan(&mode, &str)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return model.ParsePosition(mode, str)
+}
+
+func (s *PostgresSink) saveCheckpoint(ctx context.Context, tx *sql.Tx, ds string, pos *model.Position) error {
+	query := fmt.Sprintf("INSERT INTO %s (datasource, pos_mode, pos) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (datasource) DO UPDATE SET pos_mode = EXCLUDED.pos_mode, pos = EXCLUDED.pos, updated_at = CURRENT_TIMESTAMP", pgIdent(s.checkpoint))
+	_, err := tx.ExecContext(ctx, query, ds, pos.Mode, pos.Marshal())
+	return err
+}
+
+// applyDDL 库映射为 schema；建表、改表和索引语句经过翻译，多表的 DROP/RENAME 语句按事件逐表执行
+func (s *PostgresSink) applyDDL(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	ddl := ev.DDL
+	if ddl == nil {
+		return nil
+	}
+	var stmts []string
+	switch ddl.Kind {
+	case model.DDLCreateDatabase:
+		sc, _ := s.cfg.Target(ddl.Schema, "")
+		stmts = append(stmts, "CREATE SCHEMA IF NOT EXISTS "+pgIdent(sc))
+	case model.DDLDropDatabase:
+		sc, _ := s.cfg.Target(ddl.Schema, "")
+		stmts = append(stmts, "DROP SCHEMA IF EXISTS "+pgIdent(sc)+" CASCADE")
+	case model.DDLDropTable:
+		stmts = append(stmts, "DROP TABLE IF EXISTS "+s.target(ddl.Schema, ddl.Table))
+	case model.DDLTruncateTable:
+		stmts = append(stmts, "TRUNCATE TABLE "+s.target(ddl.Schema, ddl.Table))
+	case model.DDLRenameTable:
+		sc, tb := s.cfg.Target(ddl.Schema, ddl.Table)
+		nsc, ntb := s.cfg.Target(ddl.NewSchema, ddl.NewTable)
+		if nsc != sc {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s SET SCHEMA %s", pgTable(sc, tb), pgIdent(nsc)))
+		}
+		if ntb != tb {
+			stmts = append(stmts, fmt.Sprintf("ALTER TABLE %s RENAME TO %s", pgTable(nsc, tb), pgIdent(ntb)))
+		}
+	default:
+		translated, err := s.translator.Translate(ddl.Query, ddl.Schema)
+		if err != nil {
+			return err
+		}
+		stmts = translated
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("apply ddl %s err: %w", stmt, err)
+		}
+	}
+	log.Log.Info("ddl applied", zap.String("schema", ddl.Schema), zap.String("table", ddl.Table), zap.String("kind", ddl.Kind))
+	return nil
+}
+
+// target 源表在目标库中的全名
+func (s *PostgresSink) target(schema, table string) string {
+	return pgTable(s.cfg.Target(schema, table))
+}
+
+func (s *PostgresSink) forgetColumns() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.columns = make(map[string]map[string]string)
+}
+
+// columnTypes 目标表的列类型，用于转换 bytea、boolean 和日期列的取值
+func (s *PostgresSink) columnTypes(ctx context.Context, tx *sql.Tx, schema, table string) (map[string]string, error) {
+	sc, tb := s.cfg.Target(schema, table)
+	key := sc + "." + tb
+	s.lock.Lock()
+	cols, ok := s.columns[key]
+	s.lock.Unlock()
+	if ok {
+		return cols, nil
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT column_name, data_type FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2", sc, tb)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cols = make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		cols[name] = typ
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	s.columns[key] = cols
+	s.lock.Unlock()
+	return cols, nil
+}
+
+// pgValue 按目标列类型转换取值：二进制串按 bytea 写入，tinyint(1) 的整数和 bit(1) 的字节值转为布尔，
+// 零值日期转为 NULL，超出 int64 的无符号整数转为字符串
+func pgValue(typ string, value interface{}) interface{} {
+	if typ == "boolean" {
+		switch v := value.(type) {
+		case int8:
+			return v != 0
+		case int16:
+			return v != 0
+		case int32:
+			return v != 0
+		case int64:
+			return v != 0
+		case int:
+			return v != 0
+		case uint64:
+			return v != 0
+		}
+	}
+	switch v := value.(type) {
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case string:
+		switch {
+		case typ == "bytea":
+			return []byte(v)
+		case typ == "boolean" && len(v) == 1 && v[0] <= 1:
+			return v[0] == 1
+		case (typ == "date" || strings.HasPrefix(typ, "timestamp")) && strings.HasPrefix(v, "0000-00-00"):
+			return nil
+		}
+	}
+	return value
+}
+
+// upsertRows 多行 INSERT ... ON CONFLICT，冲突目标为主键，没有主键的表只能直接插入
+func (s *PostgresSink) upsertRows(ctx context.Context, tx *sql.Tx, events []*model.Event) error {
+	first := events[0]
+	cols := sortedColumns(first.Data)
+	if len(cols) == 0 {
+		return nil
+	}
+	types, err := s.columnTypes(ctx, tx, first.Schema, first.Table)
+	if err != nil {
+		return err
+	}
+	values := make([]string, 0, len(events))
+	args := make([]interface{}, 0, len(events)*len(cols))
+	for _, ev := range events {
+		holders := make([]string, len(cols))
+		for i, col := range cols {
+			args = append(args, pgValue(types[col], ev.Data[col]))
+			holders[i] = "$" + strconv.Itoa(len(args))
+		}
+		values = append(values, "("+strings.Join(holders, ", ")+")")
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", s.target(first.Schema, first.Table), pgIdentList(cols), strings.Join(values, ", "))
+	if len(first.Keys) > 0 {
+		keys := make(map[string]bool, len(first.Keys))
+		for _, k := range first.Keys {
+			keys[k] = true
+		}
+		updates := make([]string, 0, len(cols))
+		for _, col := range cols {
+			if !keys[col] {
+				updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", pgIdent(col), pgIdent(col)))
+			}
+		}
+		if len(updates) == 0 {
+			query += fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", pgIdentList(first.Keys))
+		} else {
+			query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", pgIdentList(first.Keys), strings.Join(updates, ", "))
+		}
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("upsert %s.%s err: %w", first.Schema, first.Table, err)
+	}
+	return nil
+}
+
+// applyRow 应用单个 binlog 行变更，有主键时 insert/update 按 upsert 应用，主键被修改时先删除旧行；
+// 没有主键时 update/delete 按前镜像的全部列定位一行
+func (s *PostgresSink) applyRow(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	switch ev.Op {
+	case "insert":
+		return s.upsertRows(ctx, tx, []*model.Event{ev})
+	case "update":
+		if len(ev.Keys) == 0 {
+			return s.updateByImage(ctx, tx, ev)
+		}
+		if keyChanged(ev) {
+			if err := s.deleteRow(ctx, tx, ev); err != nil {
+				return err
+			}
+		}
+		return s.upsertRows(ctx, tx, []*model.Event{ev})
+	case "delete":
+		return s.deleteRow(ctx, tx, ev)
+	}
+	return nil
+}
+
+// where 有主键时按主键定位，否则按前镜像全部列以 IS NOT DISTINCT FROM 比较并通过 ctid 只影响一行；
+// 参数编号从 offset+1 开始
+func (s *PostgresSink) where(ev *model.Event, types map[string]string, offset int) (string, []interface{}) {
+	cols := ev.Keys
+	if len(cols) == 0 {
+		cols = sortedColumns(ev.Before)
+	}
+	conds := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	for i, col := range cols {
+		conds[i] = fmt.Sprintf("%s IS NOT DISTINCT FROM $%d", pgIdent(col), offset+i+1)
+		args[i] = pgValue(types[col], ev.Before[col])
+	}
+	cond := strings.Join(conds, " AND ")
+	if len(ev.Keys) == 0 {
+		cond = fmt.Sprintf("ctid = (SELECT ctid FROM %s WHERE %s LIMIT 1)", s.target(ev.Schema, ev.Table), cond)
+	}
+	return cond, args
+}
+
+func (s *PostgresSink) deleteRow(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	types, err := s.columnTypes(ctx, tx, ev.Schema, ev.Table)
+	if err != nil {
+		return err
+	}
+	where, args := s.where(ev, types, 0)
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", s.target(ev.Schema, ev.Table), where)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("delete %s.%s err: %w", ev.Schema, ev.Table, err)
+	}
+	return nil
+}
+
+func (s *PostgresSink) updateByImage(ctx context.Context, tx *sql.Tx, ev *model.Event) error {
+	types, err := s.columnTypes(ctx, tx, ev.Schema, ev.Table)
+	if err != nil {
+		return err
+	}
+	cols := sortedColumns(ev.Data)
+	sets := make([]string, len(cols))
+	args := make([]interface{}, 0, len(cols)+len(ev.Before))
+	for i, col := range cols {
+		args = append(args, pgValue(types[col], ev.Data[col]))
+		sets[i] = fmt.Sprintf("%s = $%d", pgIdent(col), len(args))
+	}
+	where, whereArgs := s.where(ev, types, len(args))
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", s.target(ev.Schema, ev.Table), strings.Join(sets, ", "), where)
+	if _, err := tx.ExecContext(ctx, query, append(args, whereArgs...)...); err != nil {
+		return fmt.Errorf("update %s.%s err: %w", ev.Schema, ev.Table, err)
+	}
+	return nil
+}
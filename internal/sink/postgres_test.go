@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"errors"
+	"go-cdc/pkg/config"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func newTestPostgresSink(t *testing.T) (*PostgresSink, *fakeDB) {
+	t.Helper()
+	conn, d := openFakeDB(t)
+	cfg := &config.PostgresSinkConfig{}
+	s := &PostgresSink{cfg: cfg, db: conn, translator: &pgTranslator{target: cfg.Target}, checkpoint: defaultCheckpointTable,
+		batchSize: defaultApplyBatch, columns: make(map[string]map[string]string)}
+	s.checkpoints = newCheckpointStore(s.loadCheckpoint)
+	return s, d
+}
+
+// TestPostgresSinkSpilledTx 溢写后分批投递的大事务在一个目标事务中全部应用，中间失败时整体回滚，重放已应用的事务时跳过
+func TestPostgresSinkSpilledTx(t *testing.T) {
+	s, d := newTestPostgresSink(t)
+	const n = 2530
+	d.fail = func(query string, i int) error {
+		if i == 1500 {
+			return errors.New("connection lost")
+		}
+		return nil
+	}
+	if err := spillTx(t, n, "5").Flush(s.ConsumeTx); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(d.committed) != 0 || d.commits != 0 {
+		t.Fatalf("failed transaction committed %d statements", len(d.committed))
+	}
+
+	d.fail = nil
+	if err := spillTx(t, n, "5").Flush(s.ConsumeTx); err != nil {
+		t.Fatal(err)
+	}
+	if got := d.count(`INSERT INTO "shop"."orders"`); got != n {
+		t.Fatalf("applied %d rows, want %d", got, n)
+	}
+	if got := d.count(`INSERT INTO "go_cdc_checkpoint"`); got != 1 {
+		t.Fatalf("checkpoint written %d times, want 1", got)
+	}
+	if d.commits != 1 {
+		t.Fatalf("committed %d target transactions, want 1", d.commits)
+	}
+
+	execs := d.execs
+	if err := spillTx(t, n, "5").Flush(s.ConsumeTx); err != nil {
+		t.Fatal(err)
+	}
+	if d.execs != execs {
+		t.Fatalf("replayed transaction executed %d statements", d.execs-execs)
+	}
+}
+
+func TestPgValue(t *testing.T) {
+	cases := []struct {
+		typ   string
+		value interface{}
+		want  interface{}
+	}{
+		{"boolean", int8(1), true},
+		{"boolean", int8(0), false},
+		{"boolean", int64(-1), true},
+		{"boolean", uint64(0), false},
+		{"boolean", "\x01", true},
+		{"boolean", "1", "1"},
+		{"smallint", int8(1), int8(1)},
+		{"numeric", uint64(math.MaxUint64), "18446744073709551615"},
+		{"bytea", "\xff\x00", []byte{0xff, 0x00}},
+		{"date", "0000-00-00", nil},
+		{"timestamp without time zone", "0000-00-00 00:00:00", nil},
+	}
+	for _, c := range cases {
+		if got := pgValue(c.typ, c.value); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("pgValue(%s, %#v) got %#v, want %#v", c.typ, c.value, got, c.want)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package syncdb
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"go-cdc/internal/db"
 	"go-cdc/internal/model"
 	"go-cdc/pkg/config"
+	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 type DataSource interface {
@@ -18,25 +22,65 @@ type DataSource interface {
 	ListTables(db *sql.DB, schemas ...string) (map[string][]string, error)
 
 	// GetTableDDL 获取表的建表DDL
-	GetTableDDL(tx *sql.Tx, schema string, tables string) (string, error)
+	GetTableDDL(tx Querier, schema string, tables string) (string, error)
+
+	// GetTablePrimaryKeys 按主键定义顺序获取主键列，没有主键时返回空
+	GetTablePrimaryKeys(tx Querier, schema string, table string) ([]*KeyColumn, error)
+
+	// GetTableUniqueKeys 获取表中第一个所有列都非空的唯一索引，按索引定义顺序返回，没有时返回空
+	GetTableUniqueKeys(tx Querier, schema string, table string) ([]*KeyColumn, error)
+
+	// GetKeyColumns 按给定顺序获取列的类型信息，用于配置的代理键
+	GetKeyColumns(tx Querier, schema, table string, names []string) ([]*KeyColumn, error)
+
+	// FetchTableChunk 按 keys 的顺序分块抓取表数据，lastPK 为上一分块最后一行的键值，为 nil 时从头读取，
+	// filter 为附加的行过滤条件，为空表示不过滤
+	FetchTableChunk(tx Querier, schema, table string, keys []*KeyColumn, lastPK []interface{}, filter string, chunkSize int) (data []map[string]interface{}, newLastPK []interface{}, err error)
+
+	// FetchTableRangeChunk 在键首列的范围内分块抓取表数据，r 为 nil 时等同 FetchTableChunk
+	FetchTableRangeChunk(tx Querier, schema, table string, keys []*KeyColumn, lastPK []interface{}, r *ChunkRange, filter string, chunkSize int) (data []map[string]interface{}, newLastPK []interface{}, err error)
 
-	// GetTablePrimaryKeys 获取表的主键
-	GetTablePrimaryKeys(tx *sql.Tx, schema string, table string) ([]string, error)
+	// FetchTableStream 没有可分页的键时一次查询流式读取全表，每 batchSize 行回调一次
+	FetchTableStream(tx Querier, schema, table, filter string, batchSize int, fn func(rows []map[string]interface{}) error) error
 
-	// FetchTableChunk 分块抓取表数据，chunkSize 可调
-	FetchTableChunk(tx *sql.Tx, schema, table string, lastPK map[string]interface{}, chunkSize int) (data []map[string]interface{}, newLastPK map[string]interface{}, err error)
+	// EstimateRows 估算表的行数
+	EstimateRows(tx Querier, schema, table string) (int64, error)
+
+	// SplitTableRanges 按键列 key 将表切分为至多 n 个连续范围
+	SplitTableRanges(tx Querier, schema, table string, key *KeyColumn, n int, estimatedRows int64) ([]*ChunkRange, error)
 
 	// BeginTransactionSnapshot 开启事务快照
 	BeginTransactionSnapshot() (*TxSnapshot, error)
 
+	// BeginConsistentSnapshots 在全局读锁下开启 n 个一致性快照，所有快照位于同一位点
+	BeginConsistentSnapshots(n int) ([]*TxSnapshot, error)
+
 	// GetDataSourceTemplate 获取数据库连接
 	GetDataSourceTemplate() *sql.DB
 }
 
+// ChunkRange 键首列上的左闭右开范围，Lower/Upper 为 nil 表示无界
+type ChunkRange struct {
+	Column string
+	Lower  interface{}
+	Upper  interface{}
+}
+
 type TxSnapshot struct {
-	DB  *sql.DB     // 事务绑定的数据库连接
-	Tx  *sql.Tx     // 事务对象
-	Pos interface{} // 当前事务执行前的唯一标识，为增量做准备
+	DB     *sql.DB         // 事务绑定的数据库连接
+	Tx     Querier         // 在快照事务中执行查询，一致性快照为独占的连接
+	Pos    *model.Position // 当前事务执行前的唯一标识，为增量做准备
+	commit func() error
+}
+
+// Commit 结束快照事务并归还连接，重复调用时不再执行
+func (s *TxSnapshot) Commit() error {
+	if s.commit == nil {
+		return nil
+	}
+	commit := s.commit
+	s.commit = nil
+	return commit()
 }
 
 type DataSourceHolder struct {
@@ -45,8 +89,14 @@ type DataSourceHolder struct {
 	Config *config.DataSourceConfig
 }
 
+// IsMysql MySQL 协议兼容的数据源，包含 MariaDB
 func (h DataSourceHolder) IsMysql() bool {
-	return strings.ToLower(h.Config.Type) == "mysql"
+	return h.Config.IsMysqlCompatible()
+}
+
+// Flavor binlog 协议类型 mysql/mariadb
+func (h DataSourceHolder) Flavor() string {
+	return h.Config.Flavor()
 }
 
 var (
@@ -57,21 +107,227 @@ var (
 // BinlogInitializer 获取全量同步前binlog位置 为增量做准备
 type BinlogInitializer struct{}
 
-func (b BinlogInitializer) Init(db *sql.DB) (map[string][]string, error) {
-	query := "show master status"
-	var file, pos, do, ignore, gtid string
-	err := db.QueryRow(query).Scan(&file, &pos, &do, &ignore, &gtid)
+// Querier *sql.DB、*sql.Tx 与 *sql.Conn 的公共查询接口
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Init 读取 show master status，兼容不同版本的列数（5.5 没有 Executed_Gtid_Set）
+func (b BinlogInitializer) Init(q Querier) (*model.BinlogPos, *model.GTID, error) {
+	rows, err := q.QueryContext(context.Background(), "show master status")
+	if err != nil {
+		return nil, nil, fmt.Errorf("BinlogInitializer.Init err: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, fmt.Errorf("BinlogInitializer.Init err: %w", err)
+	}
+	if !rows.Next() {
+		return nil, nil, fmt.Errorf("BinlogInitializer.Init err: binlog is not enabled")
+	}
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, nil, fmt.Errorf("BinlogInitializer.Init err: %w", err)
+	}
+	pos, err := strconv.ParseUint(values[1].String, 10, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("BinlogInitializer.Init parse position err: %w", err)
+	}
+	var gtidStr string
+	if len(values) >= 5 {
+		gtidStr = values[4].String
+	}
+	gtid, err := model.ParseGTIDSet(gtidStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &model.BinlogPos{File: values[0].String, Pos: uint32(pos)}, gtid, nil
+}
+
+// Position 按位点类型获取当前 master 位置
+func (b BinlogInitializer) Position(q Querier, mode string) (*model.Position, error) {
+	if mode == model.PosModeMariaDB {
+		return b.mariadbPosition(q)
+	}
+	pos, gtid, err := b.Init(q)
+	if err != nil {
+		return nil, err
+	}
+	if mode == model.PosModeFile {
+		return model.NewFilePosition(*pos), nil
+	}
+	return model.NewGTIDPosition(gtid), nil
+}
+
+// mariadbPosition MariaDB 的 show master status 不含 GTID，改读 @@gtid_current_pos
+func (b BinlogInitializer) mariadbPosition(q Querier) (*model.Position, error) {
+	rows, err := q.QueryContext(context.Background(), "SELECT @@GLOBAL.gtid_current_pos")
+	if err != nil {
+		return nil, fmt.Errorf("BinlogInitializer.mariadbPosition err: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	var str sql.NullString
+	if rows.Next() {
+		if err := rows.Scan(&str); err != nil {
+			return nil, fmt.Errorf("BinlogInitializer.mariadbPosition err: %w", err)
+		}
+	}
+	gtid, err := model.ParseMariadbGTID(str.String)
+	if err != nil {
+		return nil, err
+	}
+	return model.NewMariadbPosition(gtid), nil
+}
+
+// PosMode 确定数据源的位点类型：配置优先，其次沿用已持久化的类型，最后按 gtid_mode 自动识别
+// 已持久化的位点无法在两种类型之间转换，配置与之冲突时返回错误
+func (b BinlogInitializer) PosMode(db *sql.DB, cfg *config.DataSourceConfig) (string, error) {
+	meta, err := model.GetTableMetaService().GetCDCMeta(cfg.ID)
+	if err != nil {
+		return "", fmt.Errorf("BinlogInitializer.PosMode load meta err: %w", err)
+	}
+	stored := ""
+	if meta != nil && meta.LastPos != "" {
+		stored = meta.PosMode
+		if stored == "" {
+			stored = model.PosModeGTID
+		}
+	}
+	mode := strings.ToLower(cfg.BinlogMode)
+	// MariaDB 的 GTID 与 MySQL 不兼容，gtid 模式统一映射为 mariadb_gtid
+	if cfg.Flavor() == mysql.MariaDBFlavor && mode == model.PosModeGTID {
+		mode = model.PosModeMariaDB
+	}
+	switch mode {
+	case model.PosModeGTID, model.PosModeFile, model.PosModeMariaDB:
+		if stored != "" && stored != mode {
+			return "", fmt.Errorf("binlog_mode %s of %s conflicts with persisted checkpoint mode %s", mode, cfg.ID, stored)
+		}
+		return mode, nil
+	case "", "auto":
+		if stored != "" {
+			return stored, nil
+		}
+		// MariaDB 10.0 起 GTID 始终开启
+		if cfg.Flavor() == mysql.MariaDBFlavor {
+			return model.PosModeMariaDB, nil
+		}
+		var gtidMode string
+		if err := db.QueryRow("SELECT @@GLOBAL.gtid_mode").Scan(&gtidMode); err != nil || strings.ToUpper(gtidMode) != "ON" {
+			return model.PosModeFile, nil
+		}
+		return model.PosModeGTID, nil
+	default:
+		return "", fmt.Errorf("unknown binlog_mode %s of %s", cfg.BinlogMode, cfg.ID)
+	}
+}
+
+// Checkpoint 获取数据源的增量同步起点，优先使用 go_cdc_meta 中持久化的位置，
+// 从未同步过的数据源才取当前 master 位置并立即落库
+func (b BinlogInitializer) Checkpoint(db *sql.DB, cfg *config.DataSourceConfig, mode string) (*model.Position, error) {
+	meta, err := model.GetTableMetaService().GetCDCMeta(cfg.ID)
 	if err != nil {
-		return nil, fmt.Errorf("BinlogInitializer.Init err: %w", err)
+		return nil, fmt.Errorf("BinlogInitializer.Checkpoint load meta err: %w", err)
 	}
-	split := strings.Split(strings.Replace(gtid, "\n", "", -1), ",")
-	m := make(map[string][]string, len(split))
-	for _, str := range split {
-		item := strings.Split(str, ":")
-		k, v := item[0], item[1:]
-		m[k] = v
+	if meta != nil && meta.LastPos != "" {
+		pos, err := model.ParsePosition(meta.PosMode, meta.LastPos)
+		if err != nil {
+			return nil, err
+		}
+		if !pos.IsEmpty() {
+			return pos, nil
+		}
 	}
-	return m, nil
+	pos, err := b.Position(db, mode)
+	if err != nil {
+		return nil, err
+	}
+	model.GetTableMetaService().SavaOrUpdateCDCMeta(cfg.ID, cfg.Type, pos)
+	return pos, nil
+}
+
+// Purged 判断从位点 pos 继续增量所需的 binlog 是否已被清理
+func (b BinlogInitializer) Purged(db *sql.DB, pos *model.Position) (bool, error) {
+	if pos.IsEmpty() {
+		return true, nil
+	}
+	switch pos.Mode {
+	case model.PosModeGTID:
+		var str sql.NullString
+		if err := db.QueryRow("SELECT @@GLOBAL.gtid_purged").Scan(&str); err != nil {
+			return false, fmt.Errorf("BinlogInitializer.Purged err: %w", err)
+		}
+		purged, err := model.ParseGTIDSet(str.String)
+		if err != nil {
+			return false, err
+		}
+		return !purged.IsSubsetOf(pos.GTID), nil
+	case model.PosModeFile:
+		first, err := b.firstBinlog(db)
+		if err != nil {
+			return false, err
+		}
+		return pos.BinlogPos.Compare(model.BinlogPos{File: first}) < 0, nil
+	case model.PosModeMariaDB:
+		first, err := b.firstBinlog(db)
+		if err != nil {
+			return false, err
+		}
+		// 最早一个 binlog 文件开头的 GTID 状态，位点落后于它的复制域已无法续传
+		var str sql.NullString
+		if err := db.QueryRow("SELECT BINLOG_GTID_POS(?, 4)", first).Scan(&str); err != nil {
+			return false, fmt.Errorf("BinlogInitializer.Purged err: %w", err)
+		}
+		oldest, err := model.ParseMariadbGTID(str.String)
+		if err != nil {
+			return false, err
+		}
+		for domain, item := range *oldest {
+			if !pos.MariadbGTID.Contains(domain, item.SeqNo) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown position mode %s", pos.Mode)
+}
+
+// firstBinlog 服务器上保留的最早的 binlog 文件
+func (b BinlogInitializer) firstBinlog(db *sql.DB) (string, error) {
+	rows, err := db.Query("SHOW BINARY LOGS")
+	if err != nil {
+		return "", fmt.Errorf("BinlogInitializer.firstBinlog err: %w", err)
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		return "", fmt.Errorf("BinlogInitializer.firstBinlog err: binlog is not enabled")
+	}
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", fmt.Errorf("BinlogInitializer.firstBinlog err: %w", err)
+	}
+	return values[0].String, nil
 }
 
 func InitOrGetDataSource() map[string]*DataSourceHolder {
@@ -81,7 +337,11 @@ func InitOrGetDataSource() map[string]*DataSourceHolder {
 		DataSourceMap = make(map[string]*DataSourceHolder)
 		for i, cfg := range dataSourceConfigs {
 			fmt.Printf("%s:%d/%s type=%s user=%s params=%v\n", cfg.Host, cfg.Port, cfg.Database, cfg.Type, cfg.User, cfg.Params)
-			if cfg.Type == "mysql" {
+			// 未启用的数据源不建立连接，仍占用序号以保持其余数据源的 server id 不变
+			if !cfg.IsEnabled() {
+				continue
+			}
+			if cfg.IsMysqlCompatible() {
 				dsn := db.GetMysqlDsn(cfg)
 
 				mysqlDB, err := sql.Open("mysql", dsn)
@@ -93,13 +353,17 @@ func InitOrGetDataSource() map[string]*DataSourceHolder {
 					panic(fmt.Errorf("failed to ping mysql %s:%s: %v", cfg.Host, cfg.Database, err))
 				}
 				source := NewMysqlDataSource(mysqlDB)
-				gtids, err := binlog.Init(mysqlDB)
+				source.Flavor = cfg.Flavor()
+				mode, err := binlog.PosMode(mysqlDB, cfg)
+				if err != nil {
+					panic(fmt.Errorf("failed to init mysql %s:%s: %v", cfg.Host, cfg.Database, err))
+				}
+				pos, err := binlog.Checkpoint(mysqlDB, cfg, mode)
 				if err != nil {
 					panic(fmt.Errorf("failed to init mysql %s:%s: %v", cfg.Host, cfg.Database, err))
 				}
-				gtid := model.ParseGTID(gtids)
-				source.LastGTID = gtid
-				model.GetTableMetaService().SavaOrUpdateCDCMeta(cfg.ID, cfg.Type, gtid)
+				source.PosMode = mode
+				source.LastPos = pos
 				DataSourceMap[cfg.ID] = &DataSourceHolder{
 					ID:     uint32(i + 1),
 					Source: source,
@@ -0,0 +1,128 @@
+package syncdb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// KeyColumn 分页键中的一列，键由按序排列的 KeyColumn 组成
+type KeyColumn struct {
+	Name      string
+	DataType  string // information_schema.columns.data_type
+	Collation string // 字符串列的排序规则，ORDER BY 与键比较都按列的排序规则进行
+	Unsigned  bool   // 整数列是否为 unsigned
+	Nullable  bool
+}
+
+// KeyNames 按键中的顺序返回列名
+func KeyNames(keys []*KeyColumn) []string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.Name
+	}
+	return names
+}
+
+// IsBinary 二进制类型的值以 []byte 保留原始字节
+func (k *KeyColumn) IsBinary() bool {
+	switch strings.ToLower(k.DataType) {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob", "bit":
+		return true
+	}
+	return false
+}
+
+// IsInteger 整数类型
+func (k *KeyColumn) IsInteger() bool {
+	switch strings.ToLower(k.DataType) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return true
+	}
+	return false
+}
+
+// normalizeKeyValue 从查询结果中取出键值，二进制列保留 []byte，其余 []byte 转为字符串
+func normalizeKeyValue(k *KeyColumn, v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		if k.IsBinary() {
+			return append([]byte(nil), b...)
+		}
+		return string(b)
+	}
+	return v
+}
+
+// EncodeKey 将键值序列化为 JSON 数组，二进制值以 base64 保存
+func EncodeKey(keys []*KeyColumn, values []interface{}) (string, error) {
+	if len(keys) != len(values) {
+		return "", fmt.Errorf("key has %d columns but got %d values", len(keys), len(values))
+	}
+	arr := make([]interface{}, len(values))
+	for i, v := range values {
+		arr[i] = EncodeKeyValue(keys[i], v)
+	}
+	b, err := json.Marshal(arr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// EncodeKeyValue 单个键值转为可 JSON 序列化的值
+func EncodeKeyValue(k *KeyColumn, v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		if k.IsBinary() {
+			return base64.StdEncoding.EncodeToString(b)
+		}
+		return string(b)
+	}
+	return v
+}
+
+// DecodeKey 解析 EncodeKey 的结果，列数与键不一致时返回错误
+func DecodeKey(keys []*KeyColumn, str string) ([]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(str))
+	decoder.UseNumber()
+	var arr []interface{}
+	if err := decoder.Decode(&arr); err != nil {
+		return nil, err
+	}
+	if len(arr) != len(keys) {
+		return nil, fmt.Errorf("key has %d columns but got %d values", len(keys), len(arr))
+	}
+	values := make([]interface{}, len(arr))
+	for i, v := range arr {
+		val, err := DecodeKeyValue(keys[i], v)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+// DecodeKeyValue 按列类型还原 JSON 解码后的键值，整数还原为 int64/uint64，二进制还原为 []byte
+func DecodeKeyValue(k *KeyColumn, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("key column %s is null", k.Name)
+	}
+	switch val := v.(type) {
+	case json.Number:
+		if k.IsInteger() {
+			if n, err := strconv.ParseInt(val.String(), 10, 64); err == nil {
+				return n, nil
+			}
+			return strconv.ParseUint(val.String(), 10, 64)
+		}
+		return val.String(), nil
+	case string:
+		if k.IsBinary() {
+			return base64.StdEncoding.DecodeString(val)
+		}
+		return val, nil
+	}
+	return v, nil
+}
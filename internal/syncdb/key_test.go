@@ -0,0 +1,137 @@
+package syncdb
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyRoundTrip(t *testing.T) {
+	cases := []struct {
+		name    string
+		keys    []*KeyColumn
+		values  []interface{}
+		encoded string
+		want    []interface{}
+	}{
+		{
+			name:    "signed integer",
+			keys:    []*KeyColumn{{Name: "id", DataType: "bigint"}},
+			values:  []interface{}{int64(math.MinInt64)},
+			encoded: `[-9223372036854775808]`,
+			want:    []interface{}{int64(math.MinInt64)},
+		},
+		{
+			name:    "unsigned above MaxInt64",
+			keys:    []*KeyColumn{{Name: "id", DataType: "bigint", Unsigned: true}},
+			values:  []interface{}{uint64(math.MaxUint64)},
+			encoded: `[18446744073709551615]`,
+			want:    []interface{}{uint64(math.MaxUint64)},
+		},
+		{
+			name:    "binary",
+			keys:    []*KeyColumn{{Name: "uuid", DataType: "binary"}},
+			values:  []interface{}{[]byte{0x00, 0xff, 0x80, '"'}},
+			encoded: `["AP+AIg=="]`,
+			want:    []interface{}{[]byte{0x00, 0xff, 0x80, '"'}},
+		},
+		{
+			name:    "string read as bytes",
+			keys:    []*KeyColumn{{Name: "code", DataType: "varchar"}},
+			values:  []interface{}{[]byte("007")},
+			encoded: `["007"]`,
+			want:    []interface{}{"007"},
+		},
+		{
+			// decimal 按字符串还原，避免转为浮点数丢失精度
+			name:    "composite",
+			keys:    []*KeyColumn{{Name: "tenant", DataType: "int"}, {Name: "code", DataType: "varchar"}, {Name: "amount", DataType: "decimal"}},
+			values:  []interface{}{int64(3), "a\"b", "12345678901234567890.123"},
+			encoded: `[3,"a\"b","12345678901234567890.123"]`,
+			want:    []interface{}{int64(3), "a\"b", "12345678901234567890.123"},
+		},
+		{
+			name:    "decimal read as number",
+			keys:    []*KeyColumn{{Name: "amount", DataType: "decimal"}},
+			values:  []interface{}{1.5},
+			encoded: `[1.5]`,
+			want:    []interface{}{"1.5"},
+		},
+	}
+	for _, c := range cases {
+		encoded, err := EncodeKey(c.keys, c.values)
+		if err != nil {
+			t.Errorf("%s: encode: %v", c.name, err)
+			continue
+		}
+		if encoded != c.encoded {
+			t.Errorf("%s: encoded %s, want %s", c.name, encoded, c.encoded)
+		}
+		got, err := DecodeKey(c.keys, encoded)
+		if err != nil {
+			t.Errorf("%s: decode: %v", c.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: decoded %#v, want %#v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestKeyErrors(t *testing.T) {
+	keys := []*KeyColumn{{Name: "id", DataType: "bigint"}, {Name: "uuid", DataType: "varbinary"}}
+	if _, err := EncodeKey(keys, []interface{}{int64(1)}); err == nil || !strings.Contains(err.Error(), "2 columns but got 1") {
+		t.Errorf("encode with missing value: %v", err)
+	}
+	cases := []struct {
+		name string
+		str  string
+		err  string
+	}{
+		{"fewer columns", `[1]`, "2 columns but got 1"},
+		{"more columns", `[1,"AA==",2]`, "2 columns but got 3"},
+		{"null key", `[null,"AA=="]`, "key column id is null"},
+		{"integer out of range", `[18446744073709551616,"AA=="]`, "out of range"},
+		{"invalid base64", `[1,"!"]`, "illegal base64"},
+		{"not an array", `{"id":1}`, "cannot unmarshal"},
+		{"truncated", `[1,`, "EOF"},
+	}
+	for _, c := range cases {
+		_, err := DecodeKey(keys, c.str)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestKeyColumnTypes(t *testing.T) {
+	cases := []struct {
+		dataType string
+		binary   bool
+		integer  bool
+	}{
+		{"BIGINT", false, true},
+		{"tinyint", false, true},
+		{"decimal", false, false},
+		{"varchar", false, false},
+		{"VARBINARY", true, false},
+		{"blob", true, false},
+		{"bit", true, false},
+	}
+	for _, c := range cases {
+		k := &KeyColumn{Name: "c", DataType: c.dataType}
+		if k.IsBinary() != c.binary || k.IsInteger() != c.integer {
+			t.Errorf("%s: binary %v integer %v", c.dataType, k.IsBinary(), k.IsInteger())
+		}
+	}
+	if got := normalizeKeyValue(&KeyColumn{DataType: "varchar"}, []byte("x")); got != "x" {
+		t.Errorf("normalize varchar got %#v", got)
+	}
+	raw := []byte{1, 2}
+	got := normalizeKeyValue(&KeyColumn{DataType: "binary"}, raw)
+	raw[0] = 9
+	if !reflect.DeepEqual(got, []byte{1, 2}) {
+		t.Errorf("normalize binary should copy the bytes, got %#v", got)
+	}
+}
@@ -3,16 +3,23 @@ package syncdb
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"go-cdc/internal/model"
+	"reflect"
+	"strconv"
 	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
+const consistentLockWaitTimeout = 10 // 一致性快照加全局读锁的等待上限（秒）
+
 type MysqlDataSource struct {
-	Db       *sql.DB
-	LastGTID *model.GTID
+	Db      *sql.DB
+	Flavor  string          // binlog 协议类型 mysql/mariadb
+	PosMode string          // 位点类型 gtid/file/mariadb_gtid
+	LastPos *model.Position // 增量同步起点
 }
 
 func NewMysqlDataSource(db *sql.DB) *MysqlDataSource {
@@ -83,11 +90,11 @@ func (mysql *MysqlDataSource) ListTables(db *sql.DB, schemas ...string) (map[str
 	return tables, nil
 }
 
-func (mysql *MysqlDataSource) GetTableDDL(tx *sql.Tx, schema, table string) (string, error) {
+func (mysql *MysqlDataSource) GetTableDDL(tx Querier, schema, table string) (string, error) {
 
 	var tableName, ddl string
 	query := fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", schema, table)
-	err := tx.QueryRow(query).Scan(&tableName, &ddl)
+	err := tx.QueryRowContext(context.Background(), query).Scan(&tableName, &ddl)
 	if err != nil {
 		return "", fmt.Errorf("show create table `%s`.`%s` err: %v", schema, table, err)
 	}
@@ -95,69 +102,261 @@ func (mysql *MysqlDataSource) GetTableDDL(tx *sql.Tx, schema, table string) (str
 	return ddl, nil
 }
 
-func (mysql *MysqlDataSource) GetTablePrimaryKeys(tx *sql.Tx, schema, table string) ([]string, error) {
-	// 先查询是否有pri 没有的直接放弃同步
+func (mysql *MysqlDataSource) GetTablePrimaryKeys(tx Querier, schema, table string) ([]*KeyColumn, error) {
+	// 没有主键时由调用方退回唯一索引、代理键或全表读取
+	query := `
+		select k.column_name, c.data_type, c.column_type, coalesce(c.collation_name, ''), c.is_nullable
+		from information_schema.key_column_usage k
+		join information_schema.columns c
+			on c.table_schema = k.table_schema and c.table_name = k.table_name and c.column_name = k.column_name
+		where k.table_schema = ? and k.table_name = ? and k.constraint_name = 'PRIMARY'
+		order by k.ordinal_position
+	`
+	rows, err := tx.QueryContext(context.Background(), query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	keys := make([]*KeyColumn, 0)
+	for rows.Next() {
+		key, err := scanKeyColumn(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (mysql *MysqlDataSource) GetTableUniqueKeys(tx Querier, schema, table string) ([]*KeyColumn, error) {
+	query := `
+		select s.index_name, s.column_name, c.data_type, c.column_type, coalesce(c.collation_name, ''), c.is_nullable
+		from information_schema.statistics s
+		join information_schema.columns c
+			on c.table_schema = s.table_schema and c.table_name = s.table_name and c.column_name = s.column_name
+		where s.table_schema = ? and s.table_name = ? and s.non_unique = 0 and s.index_name <> 'PRIMARY'
+		order by s.index_name, s.seq_in_index
+	`
+	rows, err := tx.QueryContext(context.Background(), query, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	var order []string
+	columns := make(map[string][]*KeyColumn)
+	nullable := make(map[string]bool)
+	for rows.Next() {
+		var index string
+		key, err := scanKeyColumn(rows, &index)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := columns[index]; !ok {
+			order = append(order, index)
+		}
+		columns[index] = append(columns[index], key)
+		if key.Nullable {
+			nullable[index] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// 含可空列的唯一索引允许多行 NULL，不能唯一标识行
+	for _, index := range order {
+		if !nullable[index] {
+			return columns[index], nil
+		}
+	}
+	return nil, nil
+}
+
+func (mysql *MysqlDataSource) GetKeyColumns(tx Querier, schema, table string, names []string) ([]*KeyColumn, error) {
 	query := `
-		select column_name from information_schema.columns where table_name = ? and table_schema = ?
-		and column_key = 'PRI'
+		select column_name, data_type, column_type, coalesce(collation_name, ''), is_nullable
+		from information_schema.columns
+		where table_schema = ? and table_name = ?
 	`
-	rows, err := tx.Query(query, table, schema)
+	rows, err := tx.QueryContext(context.Background(), query, schema, table)
 	if err != nil {
 		return nil, err
 	}
 	defer func(rows *sql.Rows) {
 		_ = rows.Close()
 	}(rows)
-	pris := make([]string, 0)
 
+	columns := make(map[string]*KeyColumn)
 	for rows.Next() {
-		var columnName string
-		if err := rows.Scan(&columnName); err != nil {
+		key, err := scanKeyColumn(rows)
+		if err != nil {
 			return nil, err
 		}
-		pris = append(pris, columnName)
+		columns[strings.ToLower(key.Name)] = key
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	keys := make([]*KeyColumn, 0, len(names))
+	for _, name := range names {
+		key, ok := columns[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("column `%s` not found in `%s`.`%s`", name, schema, table)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// scanKeyColumn 依次扫描 prefix、列名、类型、完整类型、排序规则、是否可空
+func scanKeyColumn(rows *sql.Rows, prefix ...interface{}) (*KeyColumn, error) {
+	key := &KeyColumn{}
+	var columnType, isNullable string
+	dest := append(prefix, &key.Name, &key.DataType, &columnType, &key.Collation, &isNullable)
+	if err := rows.Scan(dest...); err != nil {
+		return nil, err
+	}
+	key.Unsigned = strings.Contains(strings.ToLower(columnType), "unsigned")
+	key.Nullable = strings.ToUpper(isNullable) == "YES"
+	return key, nil
+}
+
+func (mysql *MysqlDataSource) FetchTableStream(tx Querier, schema, table, filter string, batchSize int, fn func(rows []map[string]interface{}) error) error {
+	query := fmt.Sprintf("SELECT * FROM `%s`.`%s`", schema, table)
+	if filter != "" {
+		query += " WHERE " + filter
+	}
+	rows, err := tx.QueryContext(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sql.Rows) {
+		_ = rows.Close()
+	}(rows)
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	bits, err := bitColumns(rows)
+	if err != nil {
+		return err
+	}
+	batch := make([]map[string]interface{}, 0, batchSize)
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		batch = append(batch, rowData(cols, bits, values))
+		if len(batch) >= batchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = make([]map[string]interface{}, 0, batchSize)
+		}
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
 
-	if len(pris) == 0 {
-		return nil, fmt.Errorf("table %s.%s has no primary key", schema, table)
+// bitColumns 结果集中 BIT 类型的列
+func bitColumns(rows *sql.Rows) ([]bool, error) {
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
 	}
-	return pris, nil
+	bits := make([]bool, len(colTypes))
+	for i, ct := range colTypes {
+		bits[i] = ct.DatabaseTypeName() == "BIT"
+	}
+	return bits, nil
+}
+
+// rowData 查询结果转为行数据：字符串和二进制列转为 string，
+// BIT 列的大端字节转为 int64，与 binlog 解析出的取值一致
+func rowData(cols []string, bits []bool, values []interface{}) map[string]interface{} {
+	row := make(map[string]interface{}, len(cols))
+	for i, col := range cols {
+		b, ok := values[i].([]byte)
+		switch {
+		case !ok:
+			row[col] = values[i]
+		case bits[i]:
+			var n int64
+			for _, c := range b {
+				n = n<<8 | int64(c)
+			}
+			row[col] = n
+		default:
+			row[col] = string(b)
+		}
+	}
+	return row
+}
+
+func (mysql *MysqlDataSource) FetchTableChunk(tx Querier, schema, table string, keys []*KeyColumn, lastPK []interface{}, filter string, chunkSize int) (data []map[string]interface{}, newLastPK []interface{}, err error) {
+	return mysql.FetchTableRangeChunk(tx, schema, table, keys, lastPK, nil, filter, chunkSize)
 }
 
-func (mysql *MysqlDataSource) FetchTableChunk(tx *sql.Tx, schema, table string, lastPK map[string]interface{}, chunkSize int) (data []map[string]interface{}, newLastPK map[string]interface{}, err error) {
-	//pkMap, ok := lastPK.(map[string]string)
-	if len(lastPK) == 0 {
-		return nil, nil, fmt.Errorf("lastPK is empty")
+// FetchTableRangeChunk 按键列顺序做 keyset 分页：ORDER BY 与行比较使用同一列序，
+// 字符串参数的可强制性低于列，比较按列的排序规则进行，与 ORDER BY 的顺序一致。
+// 键列必须非空，否则行比较结果为 NULL 会漏掉数据
+func (mysql *MysqlDataSource) FetchTableRangeChunk(tx Querier, schema, table string, keys []*KeyColumn, lastPK []interface{}, r *ChunkRange, filter string, chunkSize int) (data []map[string]interface{}, newLastPK []interface{}, err error) {
+	if len(keys) == 0 {
+		return nil, nil, fmt.Errorf("keys is empty")
 	}
-	var pkCols []string
-	var pkVals []interface{}
-	flag := true
-	for k, v := range lastPK {
-		pkCols = append(pkCols, k)
-		pkVals = append(pkVals, v)
-		if v == nil {
-			flag = false
+	if lastPK != nil && len(lastPK) != len(keys) {
+		return nil, nil, fmt.Errorf("key has %d columns but lastPK has %d values", len(keys), len(lastPK))
+	}
+	pkCols := make([]string, len(keys))
+	for i, k := range keys {
+		if k.Nullable {
+			return nil, nil, fmt.Errorf("key column `%s` is nullable", k.Name)
 		}
+		pkCols[i] = fmt.Sprintf("`%s`", k.Name)
 	}
-	var query string
+	var conds []string
 	var args []interface{}
-	if flag {
-		query = fmt.Sprintf("SELECT * FROM `%s`.`%s` WHERE (%s) > (%s) ORDER BY %s LIMIT ?",
-			schema, table,
-			strings.Join(pkCols, ","),
-			strings.Repeat("?,", len(pkCols)-1)+"?",
-			strings.Join(pkCols, ","),
-		)
-		args = append(pkVals, chunkSize)
-	} else {
-		query = fmt.Sprintf("SELECT * FROM `%s`.`%s` ORDER BY %s LIMIT ?",
-			schema, table,
-			strings.Join(pkCols, ","),
-		)
-		args = []interface{}{chunkSize}
+	if lastPK != nil {
+		conds = append(conds, fmt.Sprintf("(%s) > (%s)", strings.Join(pkCols, ","), strings.Repeat("?,", len(pkCols)-1)+"?"))
+		args = append(args, lastPK...)
 	}
+	if r != nil && r.Lower != nil {
+		conds = append(conds, fmt.Sprintf("`%s` >= ?", r.Column))
+		args = append(args, r.Lower)
+	}
+	if r != nil && r.Upper != nil {
+		conds = append(conds, fmt.Sprintf("`%s` < ?", r.Column))
+		args = append(args, r.Upper)
+	}
+	if filter != "" {
+		conds = append(conds, filter)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = " WHERE " + strings.Join(conds, " AND ")
+	}
+	query := fmt.Sprintf("SELECT * FROM `%s`.`%s`%s ORDER BY %s LIMIT ?",
+		schema, table, where,
+		strings.Join(pkCols, ","),
+	)
+	args = append(args, chunkSize)
 
-	rows, err := tx.Query(query, args...)
+	rows, err := tx.QueryContext(context.Background(), query, args...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -169,7 +368,25 @@ func (mysql *MysqlDataSource) FetchTableChunk(tx *sql.Tx, schema, table string,
 	if err != nil {
 		return nil, nil, err
 	}
+	bits, err := bitColumns(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyIdx := make([]int, len(keys))
+	for i, k := range keys {
+		keyIdx[i] = -1
+		for j, col := range cols {
+			if strings.EqualFold(col, k.Name) {
+				keyIdx[i] = j
+				break
+			}
+		}
+		if keyIdx[i] < 0 {
+			return nil, nil, fmt.Errorf("key column `%s` not found in result", k.Name)
+		}
+	}
 
+	var last []interface{}
 	for rows.Next() {
 		values := make([]interface{}, len(cols))
 		ptrs := make([]interface{}, len(cols))
@@ -179,42 +396,148 @@ func (mysql *MysqlDataSource) FetchTableChunk(tx *sql.Tx, schema, table string,
 		if err := rows.Scan(ptrs...); err != nil {
 			return nil, nil, err
 		}
-		row := make(map[string]interface{})
-		for i, col := range cols {
-			if b, ok := values[i].([]byte); ok {
-				row[col] = string(b)
-			} else {
-				row[col] = values[i]
-			}
+		data = append(data, rowData(cols, bits, values))
+		last = values
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if last != nil {
+		// 下一分块的起点取原始值，二进制键保留原始字节
+		newLastPK = make([]interface{}, len(keys))
+		for i, k := range keys {
+			newLastPK[i] = normalizeKeyValue(k, last[keyIdx[i]])
 		}
-		data = append(data, row)
 	}
-	if len(data) > 0 {
-		for k, v := range data[len(data)-1] {
-			_, ok := lastPK[k]
-			if ok {
-				lastPK[k] = v
+	return data, newLastPK, nil
+}
+
+func (mysql *MysqlDataSource) EstimateRows(tx Querier, schema, table string) (int64, error) {
+	query := "select coalesce(table_rows, 0) from information_schema.tables where table_schema = ? and table_name = ?"
+	var rows int64
+	if err := tx.QueryRowContext(context.Background(), query, schema, table).Scan(&rows); err != nil {
+		return 0, err
+	}
+	return rows, nil
+}
+
+// SplitTableRanges 整数列按 MIN/MAX 等分，其余类型按估算行数等间隔采样边界
+func (mysql *MysqlDataSource) SplitTableRanges(tx Querier, schema, table string, key *KeyColumn, n int, estimatedRows int64) ([]*ChunkRange, error) {
+	column := key.Name
+	if n <= 1 {
+		return []*ChunkRange{{Column: column}}, nil
+	}
+	var bounds []interface{}
+	switch {
+	case key.IsInteger():
+		// 按字符串读取 MIN/MAX，BIGINT UNSIGNED 超过 MaxInt64 时无法扫描到 int64
+		var lo, hi sql.NullString
+		query := fmt.Sprintf("SELECT MIN(`%s`), MAX(`%s`) FROM `%s`.`%s`", column, column, schema, table)
+		if err := tx.QueryRowContext(context.Background(), query).Scan(&lo, &hi); err != nil {
+			return nil, err
+		}
+		if !lo.Valid || !hi.Valid {
+			break
+		}
+		var err error
+		bounds, err = splitIntegerRange(key.Unsigned, lo.String, hi.String, n)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		if estimatedRows < int64(n) {
+			break
+		}
+		query := fmt.Sprintf("SELECT `%s` FROM `%s`.`%s` ORDER BY `%s` LIMIT 1 OFFSET ?", column, schema, table, column)
+		var last interface{}
+		for i := 1; i < n; i++ {
+			var bound interface{}
+			err := tx.QueryRowContext(context.Background(), query, estimatedRows*int64(i)/int64(n)).Scan(&bound)
+			if errors.Is(err, sql.ErrNoRows) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			// 重复值较多时跳过相同的边界，保证范围非空且互不重叠
+			bound = normalizeKeyValue(key, bound)
+			if bound == nil || (len(bounds) > 0 && reflect.DeepEqual(bound, last)) {
+				continue
 			}
+			last = bound
+			bounds = append(bounds, bound)
 		}
-		newLastPK = lastPK
 	}
-	return data, newLastPK, nil
+	ranges := make([]*ChunkRange, 0, len(bounds)+1)
+	var lower interface{}
+	for _, b := range bounds {
+		ranges = append(ranges, &ChunkRange{Column: column, Lower: lower, Upper: b})
+		lower = b
+	}
+	return append(ranges, &ChunkRange{Column: column, Lower: lower}), nil
 }
 
-func (mysql *MysqlDataSource) getTableGTID(tx *sql.Tx) (map[string][]string, error) {
-	query := fmt.Sprintf("SELECT @@GLOBAL.gtid_executed;")
+// splitIntegerRange 将 [lo, hi] 等分为 n 段，返回 n-1 个边界。
+// 跨度按 uint64 计算：有符号列的 hi-lo 最大为 2^64-1，在 uint64 中不会溢出
+func splitIntegerRange(unsigned bool, lo, hi string, n int) ([]interface{}, error) {
+	var base, span uint64
+	if unsigned {
+		l, err := strconv.ParseUint(lo, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		h, err := strconv.ParseUint(hi, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		base, span = l, h-l
+	} else {
+		l, err := strconv.ParseInt(lo, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		h, err := strconv.ParseInt(hi, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		base, span = uint64(l), uint64(h)-uint64(l)
+	}
+	step := span / uint64(n)
+	if step == 0 {
+		return nil, nil
+	}
+	bounds := make([]interface{}, 0, n-1)
+	for i := 1; i < n; i++ {
+		// 有符号列按补码回绕相加，结果仍落在 [lo, hi] 内
+		b := base + step*uint64(i)
+		if unsigned {
+			bounds = append(bounds, b)
+		} else {
+			bounds = append(bounds, int64(b))
+		}
+	}
+	return bounds, nil
+}
+
+func (mysql *MysqlDataSource) getTableGTID(tx Querier) (*model.GTID, error) {
+	query := "SELECT @@GLOBAL.gtid_executed;"
 	var str string
-	if err := tx.QueryRow(query).Scan(&str); err != nil {
+	if err := tx.QueryRowContext(context.Background(), query).Scan(&str); err != nil {
 		return nil, err
 	}
-	split := strings.Split(strings.Replace(str, "\n", "", -1), ",")
-	m := make(map[string][]string, len(split))
-	for _, str := range split {
-		item := strings.Split(str, ":")
-		k, v := item[0], item[1:]
-		m[k] = v
+	return model.ParseGTIDSet(str)
+}
+
+// getTablePos 按位点类型获取表快照对应的位点
+func (mysql *MysqlDataSource) getTablePos(tx Querier) (*model.Position, error) {
+	if mysql.PosMode == model.PosModeFile || mysql.PosMode == model.PosModeMariaDB {
+		return BinlogInitializer{}.Position(tx, mysql.PosMode)
+	}
+	gtid, err := mysql.getTableGTID(tx)
+	if err != nil {
+		return nil, err
 	}
-	return m, nil
+	return model.NewGTIDPosition(gtid), nil
 }
 
 func (mysql *MysqlDataSource) BeginTransactionSnapshot() (*TxSnapshot, error) {
@@ -226,14 +549,91 @@ func (mysql *MysqlDataSource) BeginTransactionSnapshot() (*TxSnapshot, error) {
 	if err != nil {
 		return nil, err
 	}
-	gtid, err := mysql.getTableGTID(tx)
+	pos, err := mysql.getTablePos(tx)
 	if err != nil {
+		_ = tx.Rollback()
 		return nil, err
 	}
-	snapshot := &TxSnapshot{DB: mysql.Db, Tx: tx, Pos: gtid}
+	snapshot := &TxSnapshot{DB: mysql.Db, Tx: tx, Pos: pos, commit: tx.Commit}
 	return snapshot, nil
 }
 
+// BeginConsistentSnapshots 加 FLUSH TABLES WITH READ LOCK 阻塞提交，在锁内为每个连接开启一致性快照并读取位点，
+// 随后立即释放锁，所有快照看到的数据都恰好对应该位点。
+// 驱动开启的事务不带 WITH CONSISTENT SNAPSHOT，读视图要到首次读表时才建立，
+// 因此每个快照独占一个连接，在连接上直接执行 START TRANSACTION 和 COMMIT
+func (mysql *MysqlDataSource) BeginConsistentSnapshots(n int) (snapshots []*TxSnapshot, err error) {
+	if n <= 0 {
+		n = 1
+	}
+	ctx := context.Background()
+	conn, err := mysql.Db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	// 等待长查询时不无限期阻塞其他会话
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("SET SESSION lock_wait_timeout = %d", consistentLockWaitTimeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "FLUSH TABLES WITH READ LOCK"); err != nil {
+		return nil, fmt.Errorf("flush tables with read lock err: %w", err)
+	}
+	defer func() {
+		if _, unlockErr := conn.ExecContext(ctx, "UNLOCK TABLES"); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+		if err != nil {
+			for _, snap := range snapshots {
+				_ = snap.Commit()
+			}
+			snapshots = nil
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		snap, err := mysql.beginConnSnapshot(ctx)
+		if err != nil {
+			return snapshots, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+	pos, err := mysql.getTablePos(snapshots[0].Tx)
+	if err != nil {
+		return snapshots, err
+	}
+	for _, snap := range snapshots {
+		snap.Pos = pos.Clone()
+	}
+	return snapshots, nil
+}
+
+// beginConnSnapshot 取出独占连接并开启只读的一致性快照，Commit 时提交并归还连接
+func (mysql *MysqlDataSource) beginConnSnapshot(ctx context.Context) (*TxSnapshot, error) {
+	conn, err := mysql.Db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY"); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	commit := func() error {
+		_, err := conn.ExecContext(context.Background(), "COMMIT")
+		if closeErr := conn.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+	return &TxSnapshot{DB: mysql.Db, Tx: conn, commit: commit}, nil
+}
+
 func (mysql *MysqlDataSource) GetDataSourceTemplate() *sql.DB {
 	return mysql.Db
 }
@@ -0,0 +1,56 @@
+package syncdb
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestSplitIntegerRange(t *testing.T) {
+	cases := []struct {
+		name     string
+		unsigned bool
+		lo, hi   string
+		n        int
+		want     []interface{}
+	}{
+		{"signed", false, "0", "100", 4, []interface{}{int64(25), int64(50), int64(75)}},
+		{"narrower than n", false, "1", "3", 4, nil},
+		{"full signed range", false, strconv.FormatInt(math.MinInt64, 10), strconv.FormatInt(math.MaxInt64, 10), 2, []interface{}{int64(-1)}},
+		{"negative", false, "-100", "-20", 4, []interface{}{int64(-80), int64(-60), int64(-40)}},
+		{"unsigned above MaxInt64", true, "0", strconv.FormatUint(math.MaxUint64, 10), 2, []interface{}{uint64(math.MaxUint64 / 2)}},
+		{"unsigned high", true, "18446744073709551000", "18446744073709551400", 4,
+			[]interface{}{uint64(18446744073709551100), uint64(18446744073709551200), uint64(18446744073709551300)}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := splitIntegerRange(c.unsigned, c.lo, c.hi, c.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("got %v, want %v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRowData(t *testing.T) {
+	cols := []string{"id", "flag", "mask", "big", "name", "blob", "note"}
+	bits := []bool{false, true, true, true, false, false, false}
+	values := []interface{}{int64(7), []byte{0x01}, []byte{0x01, 0x02}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, []byte("abc"), []byte{0xff, 0x00}, nil}
+	got := rowData(cols, bits, values)
+	want := map[string]interface{}{
+		"id":   int64(7),
+		"flag": int64(1),
+		"mask": int64(258),
+		"big":  int64(-1),
+		"name": "abc",
+		"blob": "\xff\x00",
+		"note": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v, want %#v", got, want)
+	}
+}
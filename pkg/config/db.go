@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strings"
 	"sync"
@@ -20,16 +21,152 @@ type DataSourceConfig struct {
 	Global     *FilterConfig            `toml:"global_filter"`
 	Schemas    map[string]*FilterConfig `toml:"schema_filters"`
 	FilterRule *FilterRule
+
+	TxBufferSize       int    `toml:"tx_buffer_size"`      // 单个事务在内存中缓存的事件数上限，超过后溢写到磁盘
+	TxSpillDir         string `toml:"tx_spill_dir"`        // 大事务溢写目录，默认系统临时目录
+	CheckpointInterval int    `toml:"checkpoint_interval"` // 增量位点持久化间隔（秒），默认 5 秒
+	BinlogMode         string `toml:"binlog_mode"`         // 位点类型 gtid/file，为空时自动识别
+	Enabled            *bool  `toml:"enabled"`             // 是否启用该数据源，默认启用
+	SnapshotMode       string `toml:"snapshot_mode"`       // 全量模式 initial/never/always/when_needed/schema_only，默认 initial
+	SnapshotSplitRows  int64  `toml:"snapshot_split_rows"` // 估算行数超过该值的表按主键范围切分并行读取，默认 1000000
+	SnapshotRanges     int    `toml:"snapshot_ranges"`     // 大表切分的范围数即单表并行度，默认 4，1 表示不切分
+	SnapshotConsistent bool   `toml:"snapshot_consistent"` // 所有表在同一位点读取，需要 RELOAD 权限短暂加全局读锁，开启后不切分大表、中断后重新全量
+	SignalTable        string `toml:"signal_table"`        // 源库中的信号表 schema.table，配置后可在增量同步运行中按水位线分块补全量
+	IncrementalChunk   int    `toml:"incremental_chunk"`   // 增量快照每个水位线窗口读取的行数，默认 1024
+
+	SurrogateKeys map[string]string `toml:"surrogate_keys"` // 没有主键和非空唯一索引的表的代理键（需唯一且非空），schema.table = "col1,col2"
+	RowFilters    map[string]string `toml:"row_filters"`    // 表的行过滤条件，schema.table = "tenant_id in (3,7) and deleted = 0"
+
+	ColumnRules map[string]*ColumnConfig `toml:"column_rules"` // 表的列裁剪与脱敏规则，key 为 schema.table
+	HashSalt    string                   `toml:"hash_salt"`    // hash 脱敏的盐，同一数据源内相同的值得到相同的摘要，配置了 hash 列时必填
+}
+
+// ColumnConfig 表的列规则，列名逗号分隔，不区分大小写
+type ColumnConfig struct {
+	Include  string         `toml:"include"`  // 只同步这些列，为空表示全部列
+	Exclude  string         `toml:"exclude"`  // 不同步的列，优先于 include
+	Mask     string         `toml:"mask"`     // 保留前 3 位和后 4 位，其余字符替换为 *
+	Hash     string         `toml:"hash"`     // 替换为加盐的 SHA-256 十六进制摘要
+	Truncate map[string]int `toml:"truncate"` // 列 = 保留的字符数
+}
+
+// CheckColumnRules 校验列规则：配置了 hash 列时必须设置 hash_salt，否则短值（手机号、身份证号）可被字典还原
+func (cfg *DataSourceConfig) CheckColumnRules() error {
+	if strings.TrimSpace(cfg.HashSalt) != "" {
+		return nil
+	}
+	for name, cc := range cfg.ColumnRules {
+		if cc != nil && strings.Trim(cc.Hash, ", ") != "" {
+			return fmt.Errorf("column_rules %s of %s: hash columns require hash_salt", name, cfg.ID)
+		}
+	}
+	return nil
+}
+
+// ColumnRule 表配置的列规则，未配置时返回 nil
+func (cfg *DataSourceConfig) ColumnRule(schema, table string) *ColumnConfig {
+	return cfg.ColumnRules[schema+"."+table]
+}
+
+// RowFilter 表配置的行过滤条件，未配置时返回空
+func (cfg *DataSourceConfig) RowFilter(schema, table string) string {
+	return strings.TrimSpace(cfg.RowFilters[schema+"."+table])
+}
+
+// SignalTableName 信号表的库名和表名，未写库名时取 database，未配置时返回空
+func (cfg *DataSourceConfig) SignalTableName() (string, string) {
+	name := strings.TrimSpace(cfg.SignalTable)
+	if name == "" {
+		return "", ""
+	}
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return schema, table
+	}
+	return cfg.Database, name
+}
+
+// SurrogateKey 表配置的代理键列
+func (cfg *DataSourceConfig) SurrogateKey(schema, table string) []string {
+	return splitComma(cfg.SurrogateKeys[schema+"."+table])
+}
+
+const (
+	SnapshotInitial    = "initial"     // 首次启动时全量一次，完成后只做增量
+	SnapshotNever      = "never"       // 不做全量，只做增量
+	SnapshotAlways     = "always"      // 每次启动都重新全量
+	SnapshotWhenNeeded = "when_needed" // 未完成过全量或增量位点已被清理时全量
+	SnapshotSchemaOnly = "schema_only" // 首次启动时只下发建表 DDL，不读取数据
+)
+
+// GetSnapshotMode 全量模式，未配置时为 initial
+func (cfg *DataSourceConfig) GetSnapshotMode() (string, error) {
+	mode := strings.ToLower(strings.TrimSpace(cfg.SnapshotMode))
+	switch mode {
+	case "":
+		return SnapshotInitial, nil
+	case SnapshotInitial, SnapshotNever, SnapshotAlways, SnapshotWhenNeeded, SnapshotSchemaOnly:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown snapshot_mode %s of %s", cfg.SnapshotMode, cfg.ID)
 }
-type FilterConfig struct {
-	IncludeSchemas string `toml:"include_schemas"`
-	IncludeTables  string `toml:"include_tables"`
-	ExcludeTables  string `toml:"exclude_tables"`
+
+// IsEnabled 未配置 enabled 时默认启用
+func (cfg *DataSourceConfig) IsEnabled() bool {
+	return cfg.Enabled == nil || *cfg.Enabled
+}
+
+// IsMysqlCompatible 是否为 MySQL 协议兼容的数据源
+func (cfg *DataSourceConfig) IsMysqlCompatible() bool {
+	t := strings.ToLower(cfg.Type)
+	return t == "mysql" || t == "mariadb"
+}
+
+// Flavor binlog 协议类型，type = "mariadb" 时为 mariadb，其余为 mysql
+func (cfg *DataSourceConfig) Flavor() string {
+	if strings.ToLower(cfg.Type) == "mariadb" {
+		return "mariadb"
+	}
+	return "mysql"
 }
 
 type CdcConfig struct {
 	DataSourceConfigs []*DataSourceConfig `toml:"DATASOURCE"`
 	CDCDataSource     *DataSourceConfig   `toml:"CDC_DATASOURCE"`
+	Kafka             *KafkaConfig        `toml:"KAFKA"`
+	MysqlSink         *MysqlSinkConfig    `toml:"MYSQL_SINK"`
+	PostgresSink      *PostgresSinkConfig `toml:"POSTGRES_SINK"`
+}
+
+// Warnings 各数据源过滤规则中的弃用写法，加载配置后由调用方输出
+func (cfg *CdcConfig) Warnings() []string {
+	var warnings []string
+	for _, ds := range cfg.DataSourceConfigs {
+		if ds.FilterRule == nil {
+			continue
+		}
+		for _, w := range ds.FilterRule.Warnings {
+			warnings = append(warnings, fmt.Sprintf("filter of %s: %s", ds.ID, w))
+		}
+	}
+	return warnings
+}
+
+// CheckSinks 下游只能配置一个，各下游在自己的库中记录位点，不支持同时写入多个
+func (cfg *CdcConfig) CheckSinks() error {
+	var sinks []string
+	if cfg.Kafka != nil && cfg.Kafka.Brokers != "" {
+		sinks = append(sinks, "KAFKA")
+	}
+	if cfg.MysqlSink != nil && cfg.MysqlSink.Host != "" {
+		sinks = append(sinks, "MYSQL_SINK")
+	}
+	if cfg.PostgresSink != nil && cfg.PostgresSink.Host != "" {
+		sinks = append(sinks, "POSTGRES_SINK")
+	}
+	if len(sinks) > 1 {
+		return fmt.Errorf("only one sink can be configured, got %s", strings.Join(sinks, ", "))
+	}
+	return nil
 }
 
 var (
@@ -50,43 +187,26 @@ func LoadConfig(configPath string) (*CdcConfig, error) {
 			cfgErr = err
 			return
 		}
+		// 过滤规则中的正则在加载时编译，列规则在加载时校验，配置错误在启动时暴露
+		for _, ds := range cfg.DataSourceConfigs {
+			if _, err := ds.ParseFilterConfig(); err != nil {
+				cfgErr = err
+				return
+			}
+			if err := ds.CheckColumnRules(); err != nil {
+				cfgErr = err
+				return
+			}
+		}
+		if err := cfg.CheckSinks(); err != nil {
+			cfgErr = err
+			return
+		}
 		Cnf = cfg
 	})
 	return Cnf, cfgErr
 }
 
-type FilterRule struct {
-	Global   *FilterPattern
-	BySchema map[string]*FilterPattern
-}
-
-type FilterPattern struct {
-	IncludeSchemas []string
-	IncludeTables  []string
-	ExcludeTables  []string
-}
-
-func (cfg *DataSourceConfig) ParseFilterConfig() *FilterRule {
-	rule := &FilterRule{BySchema: make(map[string]*FilterPattern)}
-	cfg.FilterRule = rule
-
-	if cfg.Global != nil {
-		rule.Global = toPattern(cfg.Global)
-	}
-	for schema, fc := range cfg.Schemas {
-		rule.BySchema[schema] = toPattern(fc)
-	}
-	return cfg.FilterRule
-}
-
-func toPattern(fc *FilterConfig) *FilterPattern {
-	return &FilterPattern{
-		IncludeSchemas: splitComma(fc.IncludeSchemas),
-		IncludeTables:  splitComma(fc.IncludeTables),
-		ExcludeTables:  splitComma(fc.ExcludeTables),
-	}
-}
-
 func splitComma(s string) []string {
 	if s == "" {
 		return nil
@@ -97,69 +217,3 @@ func splitComma(s string) []string {
 	}
 	return parts
 }
-
-func (r *FilterRule) AllowSchemas(schemas []string) []string {
-	var ans []string
-	for _, schema := range schemas {
-		if r.Allow(schema, "") {
-			ans = append(ans, schema)
-		}
-	}
-	return ans
-}
-
-func (r *FilterRule) Allow(schema, table string) bool {
-	// schema 级别规则（优先）
-	if sr, ok := r.BySchema[schema]; ok {
-		return sr.allow("", table)
-	}
-
-	// 全局规则（退回）
-	if r.Global != nil {
-		return r.Global.allow(schema, table)
-	}
-
-	// 无配置默认全部允许
-	return true
-}
-
-func (p *FilterPattern) allow(schema, table string) bool {
-	// schema 限制
-	if schema != "" {
-		if len(p.IncludeSchemas) > 0 && !contains(p.IncludeSchemas, schema) {
-			return false
-		}
-	}
-	if table != "" {
-		// 排除表优先
-		if containsPrefix(p.ExcludeTables, table) {
-			return false
-		}
-		// 若设置 include_tables，仅允许其中
-		if len(p.IncludeTables) > 0 {
-			return containsPrefix(p.IncludeTables, table)
-		}
-	}
-	return true
-}
-
-func contains(list []string, s string) bool {
-	for _, v := range list {
-		if v == s {
-			return true
-		}
-	}
-	return false
-}
-
-func containsPrefix(list []string, s string) bool {
-	for _, v := range list {
-		if strings.HasSuffix(v, "_") && strings.HasPrefix(s, strings.TrimSuffix(v, "_")) {
-			return true // 支持前缀匹配
-		}
-		if v == s {
-			return true
-		}
-	}
-	return false
-}
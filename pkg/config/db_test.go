@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckSinks(t *testing.T) {
+	kafka := &KafkaConfig{Brokers: "127.0.0.1:9092"}
+	mysql := &MysqlSinkConfig{Host: "127.0.0.1"}
+	pg := &PostgresSinkConfig{Host: "127.0.0.1"}
+	cases := []struct {
+		name string
+		cfg  *CdcConfig
+		err  string
+	}{
+		{"none", &CdcConfig{}, ""},
+		{"kafka", &CdcConfig{Kafka: kafka}, ""},
+		{"empty sections", &CdcConfig{Kafka: &KafkaConfig{}, MysqlSink: mysql, PostgresSink: &PostgresSinkConfig{}}, ""},
+		{"kafka and mysql", &CdcConfig{Kafka: kafka, MysqlSink: mysql}, "KAFKA, MYSQL_SINK"},
+		{"all", &CdcConfig{Kafka: kafka, MysqlSink: mysql, PostgresSink: pg}, "KAFKA, MYSQL_SINK, POSTGRES_SINK"},
+	}
+	for _, c := range cases {
+		err := c.cfg.CheckSinks()
+		if c.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: got error %v, want %q", c.name, err, c.err)
+		}
+	}
+}
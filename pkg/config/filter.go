@@ -0,0 +1,391 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FilterConfig 库表过滤配置，各项为逗号分隔的模式：
+//   - 普通名称精确匹配
+//   - 含 * ? [] 的按通配符匹配，如 order_*、log_20??
+//   - 以 / 包围的按正则整体匹配，如 /^tenant_\d+$/，正则内可以包含逗号
+//
+// 兼容旧配置：include_tables、exclude_tables 中以 _ 结尾的普通名称（如 log_）在旧版本中按前缀匹配，
+// 加载时改写为通配符 log_* 并记录到 FilterRule.Warnings，由调用方输出弃用日志，请改用通配符。旧版本实际按去掉 _ 后的前缀匹配（log_ 也会匹配 login），改写后不再匹配这类表。
+//
+// schema_filters 中的 key 同样可以是通配符或正则，其 include_schemas 不生效，exclude_schemas 可用于从模式匹配的库中排除个别库
+type FilterConfig struct {
+	IncludeSchemas string `toml:"include_schemas"`
+	ExcludeSchemas string `toml:"exclude_schemas"`
+	IncludeTables  string `toml:"include_tables"`
+	ExcludeTables  string `toml:"exclude_tables"`
+}
+
+const (
+	filterGlobal         = "global_filter"
+	filterIncludeSchemas = "include_schemas"
+	filterExcludeSchemas = "exclude_schemas"
+	filterIncludeTables  = "include_tables"
+	filterExcludeTables  = "exclude_tables"
+)
+
+// FilterRule 编译后的过滤规则，schema 级规则与全局规则合并生效，判定顺序：
+//  1. exclude_schemas：命中任一 schema 级或全局规则即排除
+//  2. include_schemas：库配置了 schema 级规则视为包含；否则全局配置了 include_schemas 时必须命中
+//  3. exclude_tables：命中任一 schema 级或全局规则即排除
+//  4. include_tables：schema 级规则配置了 include_tables 时以其为准，否则取全局的 include_tables，配置了则必须命中
+//  5. 以上都未排除时默认同步
+type FilterRule struct {
+	Global   *FilterPattern
+	BySchema map[string]*FilterPattern // 精确的库名
+	Warnings []string                  // 编译时发现的弃用写法，由调用方输出
+
+	schemaPatterns []*schemaPattern // 通配符或正则形式的库名，按配置 key 排序
+}
+
+type schemaPattern struct {
+	key     string
+	name    *NamePattern
+	pattern *FilterPattern
+}
+
+type FilterPattern struct {
+	IncludeSchemas []*NamePattern
+	ExcludeSchemas []*NamePattern
+	IncludeTables  []*NamePattern
+	ExcludeTables  []*NamePattern
+}
+
+// NamePattern 单个库名或表名模式
+type NamePattern struct {
+	Raw string
+	re  *regexp.Regexp // 通配符或正则编译的结果，nil 表示精确匹配
+}
+
+// FilterDecision 过滤判定结果及命中的规则
+type FilterDecision struct {
+	Allow   bool
+	Rule    string // global_filter 或 schema_filters.<key>，为空表示没有规则命中
+	Field   string // 命中的配置项，如 exclude_tables
+	Pattern string // 命中的模式，include 未命中导致排除时为空
+}
+
+func (d FilterDecision) String() string {
+	verdict := "deny"
+	if d.Allow {
+		verdict = "allow"
+	}
+	switch {
+	case d.Rule == "":
+		return verdict + " (no rule matched, default allow)"
+	case d.Field == "":
+		return fmt.Sprintf("%s (%s configured for the schema)", verdict, d.Rule)
+	case d.Pattern == "":
+		return fmt.Sprintf("%s (%s.%s matches nothing)", verdict, d.Rule, d.Field)
+	}
+	return fmt.Sprintf("%s (%s.%s %q)", verdict, d.Rule, d.Field, d.Pattern)
+}
+
+// ParseFilterConfig 编译过滤规则并缓存到 FilterRule
+func (cfg *DataSourceConfig) ParseFilterConfig() (*FilterRule, error) {
+	rule, err := NewFilterRule(cfg.Global, cfg.Schemas)
+	if err != nil {
+		return nil, fmt.Errorf("filter of %s: %w", cfg.ID, err)
+	}
+	cfg.FilterRule = rule
+	return rule, nil
+}
+
+// Filter 已编译的过滤规则，未编译时先编译
+func (cfg *DataSourceConfig) Filter() (*FilterRule, error) {
+	if cfg.FilterRule != nil {
+		return cfg.FilterRule, nil
+	}
+	return cfg.ParseFilterConfig()
+}
+
+// NewFilterRule 编译全局规则和 schema 级规则
+func NewFilterRule(global *FilterConfig, schemas map[string]*FilterConfig) (*FilterRule, error) {
+	rule := &FilterRule{BySchema: make(map[string]*FilterPattern)}
+	if global != nil {
+		p, warnings, err := toPattern(global)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filterGlobal, err)
+		}
+		rule.Global = p
+		for _, w := range warnings {
+			rule.Warnings = append(rule.Warnings, filterGlobal+": "+w)
+		}
+	}
+	for key, fc := range schemas {
+		if fc == nil {
+			continue
+		}
+		p, warnings, err := toPattern(fc)
+		if err != nil {
+			return nil, fmt.Errorf("schema_filters.%s: %w", key, err)
+		}
+		for _, w := range warnings {
+			rule.Warnings = append(rule.Warnings, "schema_filters."+key+": "+w)
+		}
+		name, err := CompileNamePattern(key)
+		if err != nil {
+			return nil, fmt.Errorf("schema_filters.%s: %w", key, err)
+		}
+		if name.re == nil {
+			rule.BySchema[key] = p
+			continue
+		}
+		rule.schemaPatterns = append(rule.schemaPatterns, &schemaPattern{key: key, name: name, pattern: p})
+	}
+	sort.Slice(rule.schemaPatterns, func(i, j int) bool {
+		return rule.schemaPatterns[i].key < rule.schemaPatterns[j].key
+	})
+	// schema_filters 按 map 遍历，排序后输出顺序稳定
+	sort.Strings(rule.Warnings)
+	return rule, nil
+}
+
+// toPattern 编译一组过滤配置，返回改写旧写法产生的弃用提示
+func toPattern(fc *FilterConfig) (*FilterPattern, []string, error) {
+	p := &FilterPattern{}
+	var warnings []string
+	for _, item := range []struct {
+		field string
+		value string
+		dest  *[]*NamePattern
+	}{
+		{filterIncludeSchemas, fc.IncludeSchemas, &p.IncludeSchemas},
+		{filterExcludeSchemas, fc.ExcludeSchemas, &p.ExcludeSchemas},
+		{filterIncludeTables, fc.IncludeTables, &p.IncludeTables},
+		{filterExcludeTables, fc.ExcludeTables, &p.ExcludeTables},
+	} {
+		for _, raw := range splitPatterns(item.value) {
+			if item.field == filterIncludeTables || item.field == filterExcludeTables {
+				if rewritten := rewriteLegacyPrefix(raw); rewritten != raw {
+					warnings = append(warnings, fmt.Sprintf("%s: table prefix %q ending with _ is deprecated, rewritten to %q, use a glob pattern instead",
+						item.field, raw, rewritten))
+					raw = rewritten
+				}
+			}
+			np, err := CompileNamePattern(raw)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", item.field, err)
+			}
+			*item.dest = append(*item.dest, np)
+		}
+	}
+	return p, warnings, nil
+}
+
+// rewriteLegacyPrefix 旧配置中以 _ 结尾的表名表示前缀匹配，改写为等价的通配符
+func rewriteLegacyPrefix(raw string) string {
+	if len(raw) < 2 || !strings.HasSuffix(raw, "_") || strings.HasPrefix(raw, "/") || strings.ContainsAny(raw, "*?[") {
+		return raw
+	}
+	return raw + "*"
+}
+
+// splitPatterns 按逗号拆分模式，/.../ 正则内的逗号不拆分
+func splitPatterns(s string) []string {
+	var out []string
+	var regex []string
+	for _, part := range strings.Split(s, ",") {
+		if regex != nil {
+			regex = append(regex, part)
+			if p := strings.TrimSpace(part); strings.HasSuffix(p, "/") {
+				out = append(out, strings.TrimSpace(strings.Join(regex, ",")))
+				regex = nil
+			}
+			continue
+		}
+		p := strings.TrimSpace(part)
+		if p == "" {
+			continue
+		}
+		if strings.HasPrefix(p, "/") && (len(p) == 1 || !strings.HasSuffix(p, "/")) {
+			regex = []string{part}
+			continue
+		}
+		out = append(out, p)
+	}
+	if regex != nil {
+		// 未闭合的正则原样保留，编译时报错
+		out = append(out, strings.TrimSpace(strings.Join(regex, ",")))
+	}
+	return out
+}
+
+// CompileNamePattern 编译单个模式，正则和通配符都按整个名称匹配
+func CompileNamePattern(raw string) (*NamePattern, error) {
+	np := &NamePattern{Raw: raw}
+	switch {
+	case strings.HasPrefix(raw, "/"):
+		if len(raw) < 3 || !strings.HasSuffix(raw, "/") {
+			return nil, fmt.Errorf("invalid regex pattern %q", raw)
+		}
+		re, err := regexp.Compile("^(?:" + raw[1:len(raw)-1] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern %q: %w", raw, err)
+		}
+		np.re = re
+	case strings.ContainsAny(raw, "*?["):
+		re, err := globRegexp(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", raw, err)
+		}
+		np.re = re
+	}
+	return np, nil
+}
+
+// globRegexp 通配符转正则：* 任意个字符，? 单个字符，[abc]、[a-z]、[!abc] 字符集合
+func globRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	runes := []rune(glob)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		case '[':
+			end := i + 1
+			if end < len(runes) && runes[end] == '!' {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unclosed character class")
+			}
+			class := string(runes[i+1 : end])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// Match 名称是否命中模式
+func (p *NamePattern) Match(name string) bool {
+	if p.re != nil {
+		return p.re.MatchString(name)
+	}
+	return p.Raw == name
+}
+
+func matchAny(list []*NamePattern, name string) *NamePattern {
+	for _, p := range list {
+		if p.Match(name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// scopedPattern 带规则名的 FilterPattern
+type scopedPattern struct {
+	rule    string
+	pattern *FilterPattern
+}
+
+// schemaRules 作用于库的 schema 级规则，精确库名在前
+func (r *FilterRule) schemaRules(schema string) []scopedPattern {
+	var rules []scopedPattern
+	if p, ok := r.BySchema[schema]; ok {
+		rules = append(rules, scopedPattern{rule: "schema_filters." + schema, pattern: p})
+	}
+	for _, sp := range r.schemaPatterns {
+		if sp.name.Match(schema) {
+			rules = append(rules, scopedPattern{rule: "schema_filters." + sp.key, pattern: sp.pattern})
+		}
+	}
+	return rules
+}
+
+func (r *FilterRule) AllowSchemas(schemas []string) []string {
+	var ans []string
+	for _, schema := range schemas {
+		if r.Allow(schema, "") {
+			ans = append(ans, schema)
+		}
+	}
+	return ans
+}
+
+// Allow table 为空时只判断库
+func (r *FilterRule) Allow(schema, table string) bool {
+	return r.Explain(schema, table).Allow
+}
+
+// Explain 按 FilterRule 的判定顺序给出结果和命中的规则
+func (r *FilterRule) Explain(schema, table string) FilterDecision {
+	scoped := r.schemaRules(schema)
+	all := scoped
+	if r.Global != nil {
+		all = append(all[:len(all):len(all)], scopedPattern{rule: filterGlobal, pattern: r.Global})
+	}
+	// 1. 排除库
+	for _, sp := range all {
+		if p := matchAny(sp.pattern.ExcludeSchemas, schema); p != nil {
+			return FilterDecision{Rule: sp.rule, Field: filterExcludeSchemas, Pattern: p.Raw}
+		}
+	}
+	// 2. 包含库
+	var matched FilterDecision
+	switch {
+	case len(scoped) > 0:
+		matched = FilterDecision{Allow: true, Rule: scoped[0].rule}
+	case r.Global != nil && len(r.Global.IncludeSchemas) > 0:
+		p := matchAny(r.Global.IncludeSchemas, schema)
+		if p == nil {
+			return FilterDecision{Rule: filterGlobal, Field: filterIncludeSchemas}
+		}
+		matched = FilterDecision{Allow: true, Rule: filterGlobal, Field: filterIncludeSchemas, Pattern: p.Raw}
+	}
+	if table == "" {
+		matched.Allow = true
+		return matched
+	}
+	// 3. 排除表
+	for _, sp := range all {
+		if p := matchAny(sp.pattern.ExcludeTables, table); p != nil {
+			return FilterDecision{Rule: sp.rule, Field: filterExcludeTables, Pattern: p.Raw}
+		}
+	}
+	// 4. 包含表，schema 级规则优先
+	var includes []scopedPattern
+	for _, sp := range scoped {
+		if len(sp.pattern.IncludeTables) > 0 {
+			includes = append(includes, sp)
+		}
+	}
+	if len(includes) == 0 && r.Global != nil && len(r.Global.IncludeTables) > 0 {
+		includes = append(includes, scopedPattern{rule: filterGlobal, pattern: r.Global})
+	}
+	if len(includes) > 0 {
+		for _, sp := range includes {
+			if p := matchAny(sp.pattern.IncludeTables, table); p != nil {
+				return FilterDecision{Allow: true, Rule: sp.rule, Field: filterIncludeTables, Pattern: p.Raw}
+			}
+		}
+		return FilterDecision{Rule: includes[0].rule, Field: filterIncludeTables}
+	}
+	// 5. 默认同步
+	matched.Allow = true
+	return matched
+}
@@ -0,0 +1,193 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLegacyTablePrefix(t *testing.T) {
+	rule, err := NewFilterRule(&FilterConfig{IncludeTables: "log_, user", ExcludeTables: "log_tmp_"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		table string
+		want  bool
+	}{
+		{"log_2024", true},
+		{"log_", true},
+		{"user", true},
+		{"login", false},
+		{"log_tmp_1", false},
+		{"order", false},
+	}
+	for _, c := range cases {
+		if got := rule.Allow("db", c.table); got != c.want {
+			t.Errorf("allow %s got %v, want %v", c.table, got, c.want)
+		}
+	}
+	if raw := rule.Global.IncludeTables[0].Raw; raw != "log_*" {
+		t.Errorf("rewritten pattern got %q, want %q", raw, "log_*")
+	}
+	if len(rule.Warnings) != 2 || !strings.HasPrefix(rule.Warnings[0], "global_filter: exclude_tables:") ||
+		!strings.Contains(rule.Warnings[1], `"log_" ending with _ is deprecated, rewritten to "log_*"`) {
+		t.Errorf("unexpected warnings %q", rule.Warnings)
+	}
+	// 通配符、正则与库名不改写
+	for _, raw := range []string{"log_*", "/log_/", "_"} {
+		if got := rewriteLegacyPrefix(raw); got != raw {
+			t.Errorf("rewrite %q got %q", raw, got)
+		}
+	}
+	rule, err = NewFilterRule(&FilterConfig{IncludeSchemas: "db_"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Allow("db_1", "t") {
+		t.Error("schema names ending with _ should match exactly")
+	}
+}
+
+func TestNamePattern(t *testing.T) {
+	cases := []struct {
+		raw   string
+		name  string
+		match bool
+	}{
+		{"orders", "orders", true},
+		{"orders", "orders_1", false},
+		{"order_*", "order_2024", true},
+		{"order_*", "orders", false},
+		{"log_20??", "log_2024", true},
+		{"log_20??", "log_20245", false},
+		{"t[0-9]", "t7", true},
+		{"t[!0-9]", "t7", false},
+		{"t[!0-9]", "tx", true},
+		{"a.b", "axb", false},
+		{"/^tenant_\\d+$/", "tenant_12", true},
+		{"/tenant_\\d+/", "tenant_12_bak", false},
+		{"/a|b/", "b", true},
+		{"/a|b/", "ab", false},
+		{"/x{1,2}/", "xx", true},
+	}
+	for _, c := range cases {
+		p, err := CompileNamePattern(c.raw)
+		if err != nil {
+			t.Fatalf("compile %q: %v", c.raw, err)
+		}
+		if got := p.Match(c.name); got != c.match {
+			t.Errorf("%q match %q got %v, want %v", c.raw, c.name, got, c.match)
+		}
+	}
+	for _, raw := range []string{"/", "/abc", "/[/", "t[0-9"} {
+		if _, err := CompileNamePattern(raw); err == nil {
+			t.Errorf("compile %q should fail", raw)
+		}
+	}
+	got := splitPatterns(" a, /x{1,2}/ ,b*,, /c/")
+	want := []string{"a", "/x{1,2}/", "b*", "/c/"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("split got %q, want %q", got, want)
+	}
+}
+
+func TestFilterRule(t *testing.T) {
+	global := &FilterConfig{
+		IncludeSchemas: "shop, /^tenant_\\d+$/",
+		ExcludeSchemas: "tenant_0",
+		IncludeTables:  "order*, user",
+		ExcludeTables:  "*_bak",
+	}
+	schemas := map[string]*FilterConfig{
+		// schema 级规则使库被包含，include_tables 覆盖全局的 include_tables
+		"crm": {IncludeTables: "customer, order_bak", ExcludeTables: "customer_tmp"},
+		// 模式形式的 key，exclude_schemas 从中排除个别库
+		"log_*":    {ExcludeSchemas: "log_secret", ExcludeTables: "debug"},
+		"tenant_1": {ExcludeTables: "user"},
+	}
+	rule, err := NewFilterRule(global, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		schema, table string
+		want          bool
+	}{
+		{"shop", "", true},
+		{"other", "", false},
+		{"tenant_7", "orders", true},
+		{"tenant_7", "stock", false},
+		// 全局 exclude_schemas 优先于 include_schemas
+		{"tenant_0", "orders", false},
+		{"tenant_0", "", false},
+		// 全局 exclude_tables 优先于 include_tables，对 schema 级规则也生效
+		{"shop", "order_bak", false},
+		{"crm", "order_bak", false},
+		{"crm", "customer", true},
+		{"crm", "orders", false},
+		{"crm", "customer_tmp", false},
+		// 模式 key 的 schema 级规则没有 include_tables，取全局的 include_tables
+		{"log_app", "orders", true},
+		{"log_app", "debug", false},
+		{"log_app", "stock", false},
+		{"log_secret", "", false},
+		{"log_secret", "orders", false},
+		// 精确 key 与全局规则合并
+		{"tenant_1", "user", false},
+		{"tenant_1", "orders", true},
+	}
+	for _, c := range cases {
+		if got := rule.Allow(c.schema, c.table); got != c.want {
+			t.Errorf("allow %s.%s got %v, want %v (%s)", c.schema, c.table, got, c.want, rule.Explain(c.schema, c.table))
+		}
+	}
+	if got := rule.AllowSchemas([]string{"shop", "other", "crm", "tenant_0", "tenant_3"}); strings.Join(got, ",") != "shop,crm,tenant_3" {
+		t.Errorf("allow schemas got %v", got)
+	}
+	if _, err := NewFilterRule(&FilterConfig{ExcludeTables: "/(/"}, nil); err == nil || !strings.Contains(err.Error(), "global_filter: exclude_tables") {
+		t.Errorf("invalid regex error got %v", err)
+	}
+	if _, err := NewFilterRule(nil, map[string]*FilterConfig{"/(/": {}}); err == nil || !strings.Contains(err.Error(), "schema_filters./(/") {
+		t.Errorf("invalid schema key error got %v", err)
+	}
+	empty, err := NewFilterRule(nil, nil)
+	if err != nil || !empty.Allow("any", "table") {
+		t.Errorf("empty rule should allow everything: %v", err)
+	}
+}
+
+func TestFilterExplain(t *testing.T) {
+	rule, err := NewFilterRule(
+		&FilterConfig{IncludeSchemas: "shop", ExcludeSchemas: "/tmp_.*/", IncludeTables: "order*", ExcludeTables: "*_bak"},
+		map[string]*FilterConfig{"crm": {IncludeTables: "customer"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		schema, table string
+		want          string
+	}{
+		{"tmp_1", "orders", `deny (global_filter.exclude_schemas "/tmp_.*/")`},
+		{"other", "orders", "deny (global_filter.include_schemas matches nothing)"},
+		{"shop", "", `allow (global_filter.include_schemas "shop")`},
+		{"shop", "orders", `allow (global_filter.include_tables "order*")`},
+		{"shop", "order_bak", `deny (global_filter.exclude_tables "*_bak")`},
+		{"shop", "stock", "deny (global_filter.include_tables matches nothing)"},
+		{"crm", "", "allow (schema_filters.crm configured for the schema)"},
+		{"crm", "customer", `allow (schema_filters.crm.include_tables "customer")`},
+		{"crm", "orders", "deny (schema_filters.crm.include_tables matches nothing)"},
+	}
+	for _, c := range cases {
+		if got := rule.Explain(c.schema, c.table).String(); got != c.want {
+			t.Errorf("explain %s.%s got %q, want %q", c.schema, c.table, got, c.want)
+		}
+	}
+	open, err := NewFilterRule(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := open.Explain("any", "t").String(); got != "allow (no rule matched, default allow)" {
+		t.Errorf("explain without rules got %q", got)
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import "strings"
+
+// KafkaConfig Kafka 下游配置
+type KafkaConfig struct {
+	Brokers         string            `toml:"brokers"`           // 逗号分隔的 broker 地址
+	ClientID        string            `toml:"client_id"`         // 默认 go-cdc
+	Topic           string            `toml:"topic"`             // 默认的 topic 模板，支持 {datasource}、{schema}、{table}，默认 cdc.{datasource}.{schema}.{table}
+	Topics          map[string]string `toml:"topics"`            // 覆盖的 topic 模板，key 为 datasource、datasource.schema 或 datasource.schema.table，越具体越优先
+	AutoCreateTopic bool              `toml:"auto_create_topic"` // topic 不存在时由 broker 自动创建
+	DeliveryTimeout int               `toml:"delivery_timeout"`  // 消息等待 broker 确认的超时（秒），默认 30 秒
+}
+
+// DefaultKafkaTopic 未配置 topic 时的模板
+const DefaultKafkaTopic = "cdc.{datasource}.{schema}.{table}"
+
+// BrokerList broker 地址列表
+func (cfg *KafkaConfig) BrokerList() []string {
+	return splitComma(cfg.Brokers)
+}
+
+// TopicTemplate 按 datasource.schema.table、datasource.schema、datasource 的顺序查找 topic 模板，都没有时取默认模板
+func (cfg *KafkaConfig) TopicTemplate(datasource, schema, table string) string {
+	for _, key := range []string{datasource + "." + schema + "." + table, datasource + "." + schema, datasource} {
+		if tpl := strings.TrimSpace(cfg.Topics[key]); tpl != "" {
+			return tpl
+		}
+	}
+	if tpl := strings.TrimSpace(cfg.Topic); tpl != "" {
+		return tpl
+	}
+	return DefaultKafkaTopic
+}
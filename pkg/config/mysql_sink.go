@@ -0,0 +1,55 @@
+package config
+
+import "strings"
+
+// MysqlSinkConfig 目标 MySQL 配置，选定的表按源库结构回放到目标库
+type MysqlSinkConfig struct {
+	Host            string            `toml:"host"`
+	Port            int               `toml:"port"`
+	User            string            `toml:"user"`
+	Password        string            `toml:"password"`
+	Database        string            `toml:"database"` // 位点表所在的库
+	Params          map[string]string `toml:"params"`
+	SchemaMapping   map[string]string `toml:"schema_mapping"`   // 源库 = 目标库，未配置时库名不变
+	TableMapping    map[string]string `toml:"table_mapping"`    // 源 schema.table = 目标 schema.table 或只写目标表名，优先于 schema_mapping
+	CheckpointTable string            `toml:"checkpoint_table"` // 目标库中记录已应用位点的表，默认 go_cdc_checkpoint
+	BatchSize       int               `toml:"batch_size"`       // 快照行合并写入的行数，默认 500
+}
+
+// DataSource 按数据源配置的形式返回连接信息
+func (cfg *MysqlSinkConfig) DataSource() *DataSourceConfig {
+	return &DataSourceConfig{
+		ID:       "mysql_sink",
+		Type:     "mysql",
+		Host:     cfg.Host,
+		Port:     cfg.Port,
+		User:     cfg.User,
+		Password: cfg.Password,
+		Database: cfg.Database,
+		Params:   cfg.Params,
+	}
+}
+
+// Target 源表在目标库中的库名和表名
+func (cfg *MysqlSinkConfig) Target(schema, table string) (string, string) {
+	return mapTarget(cfg.SchemaMapping, cfg.TableMapping, schema, table)
+}
+
+// mapTarget 按 table_mapping、schema_mapping 的顺序映射库表名，table 为空时只映射库名
+func mapTarget(schemaMapping, tableMapping map[string]string, schema, table string) (string, string) {
+	targetSchema := schema
+	if s := strings.TrimSpace(schemaMapping[schema]); s != "" {
+		targetSchema = s
+	}
+	if table == "" {
+		return targetSchema, ""
+	}
+	mapped := strings.TrimSpace(tableMapping[schema+"."+table])
+	if mapped == "" {
+		return targetSchema, table
+	}
+	if s, t, ok := strings.Cut(mapped, "."); ok {
+		return s, t
+	}
+	return targetSchema, mapped
+}
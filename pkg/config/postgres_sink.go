@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// PostgresSinkConfig 目标 PostgreSQL 配置，源库映射为目标库中的 schema
+type PostgresSinkConfig struct {
+	Host            string            `toml:"host"`
+	Port            int               `toml:"port"`
+	User            string            `toml:"user"`
+	Password        string            `toml:"password"`
+	Database        string            `toml:"database"`
+	Params          map[string]string `toml:"params"`           // 连接参数，如 sslmode = "disable"
+	SchemaMapping   map[string]string `toml:"schema_mapping"`   // 源库 = 目标 schema，未配置时同名
+	TableMapping    map[string]string `toml:"table_mapping"`    // 源 schema.table = 目标 schema.table 或只写目标表名，优先于 schema_mapping
+	CheckpointTable string            `toml:"checkpoint_table"` // public 下记录已应用位点的表，默认 go_cdc_checkpoint
+	BatchSize       int               `toml:"batch_size"`       // 快照行合并写入的行数，默认 500
+}
+
+// Dsn lib/pq 的连接串
+func (cfg *PostgresSinkConfig) Dsn() string {
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Path:   "/" + cfg.Database,
+	}
+	q := url.Values{}
+	for k, v := range cfg.Params {
+		q.Set(k, v)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// Target 源表在目标库中的 schema 和表名
+func (cfg *PostgresSinkConfig) Target(schema, table string) (string, string) {
+	return mapTarget(cfg.SchemaMapping, cfg.TableMapping, schema, table)
+}